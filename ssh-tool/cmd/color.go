@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"os"
+	"ssh-tool/internal/ansi"
+
+	"golang.org/x/term"
+)
+
+const (
+	colorReset   = ansi.Reset
+	colorBlue    = ansi.Blue
+	colorCyan    = ansi.Cyan
+	colorGreen   = ansi.Green
+	colorMagenta = ansi.Magenta
+	colorRed     = ansi.Red
+	colorYellow  = ansi.Yellow
+	colorBold    = ansi.Bold
+)
+
+// colorEnabled is off when stdout is not a terminal, NO_COLOR is set
+// (https://no-color.org) or --no-color is given.
+var colorEnabled = os.Getenv("NO_COLOR") == "" && term.IsTerminal(int(os.Stdout.Fd()))
+
+func colorize(text, color string) string {
+	if !colorEnabled {
+		return text
+	}
+	return color + text + colorReset
+}
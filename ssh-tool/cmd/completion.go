@@ -0,0 +1,414 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/panes"
+	"ssh-tool/internal/ssh"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// remotePathTimeout bounds listing remote directories while completing,
+// which opens a connection if none is shared yet.
+const remotePathTimeout = 5 * time.Second
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Print or install shell completions",
+	Long: `Print the completion script for a shell, or install it with
+'ssh-tool completion install'. Completions cover server names, groups,
+environments, tags, sessions and, for cp, paths on the server.`,
+	Example: `  ssh-tool completion install
+  source <(ssh-tool completion bash)`,
+	Args:      cobra.ExactArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return writeCompletion(args[0], os.Stdout)
+	},
+}
+
+var completionInstallCmd = &cobra.Command{
+	Use:   "install [bash|zsh|fish|powershell]",
+	Short: "Install the completion script for your shell",
+	Long: `Write the completion script where the shell picks it up, for the shell
+in $SHELL unless one is given. Shell startup files are never edited; if
+one needs a line added, it is printed.`,
+	Args:      cobra.MaximumNArgs(1),
+	ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		shell := filepath.Base(os.Getenv("SHELL"))
+		if len(args) > 0 {
+			shell = args[0]
+		}
+		if shell == "pwsh" {
+			shell = "powershell"
+		}
+
+		path, hint, err := completionPath(shell)
+		if err != nil {
+			return err
+		}
+
+		var script bytes.Buffer
+		if err := writeCompletion(shell, &script); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("error creating completion directory: %v", err)
+		}
+		if err := os.WriteFile(path, script.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("error writing completion script: %v", err)
+		}
+
+		fmt.Printf("Installed %s completion to %s\n", shell, path)
+		if hint != "" {
+			fmt.Println(hint)
+		}
+		fmt.Println("Start a new shell to use it")
+		return nil
+	},
+}
+
+func writeCompletion(shell string, out io.Writer) error {
+	switch shell {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(out, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(out)
+	case "fish":
+		return rootCmd.GenFishCompletion(out, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(out)
+	}
+	return fmt.Errorf("unsupported shell %q, use bash, zsh, fish or powershell", shell)
+}
+
+// completionPath returns where shell loads completions from, and a line
+// the user has to add to their shell config if it doesn't do so by itself.
+func completionPath(shell string) (string, string, error) {
+	data, err := xdgDir("XDG_DATA_HOME", ".local/share")
+	if err != nil {
+		return "", "", err
+	}
+	name := rootCmd.Name()
+
+	switch shell {
+	case "bash":
+		// bash-completion loads these on demand
+		return filepath.Join(data, "bash-completion", "completions", name), "", nil
+	case "zsh":
+		dir := filepath.Join(data, "zsh", "site-functions")
+		return filepath.Join(dir, "_"+name), fmt.Sprintf("Unless it's there already, add this to ~/.zshrc before compinit:\n  fpath=(%s $fpath)", dir), nil
+	case "fish":
+		configDir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+		if err != nil {
+			return "", "", err
+		}
+		return filepath.Join(configDir, "fish", "completions", name+".fish"), "", nil
+	case "powershell":
+		path := filepath.Join(data, "powershell", name+".ps1")
+		return path, fmt.Sprintf("Unless it's there already, add this to your $PROFILE:\n  . %s", path), nil
+	case "", ".":
+		return "", "", fmt.Errorf("can't tell the shell from $SHELL, give one of bash, zsh, fish or powershell")
+	}
+	return "", "", fmt.Errorf("unsupported shell %q, use bash, zsh, fish or powershell", shell)
+}
+
+func xdgDir(env, fallback string) (string, error) {
+	if dir := os.Getenv(env); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return filepath.Join(home, fallback), nil
+}
+
+// completionConfig loads the config for completions, which have no way to
+// report errors and offer nothing instead.
+func completionConfig() *config.Config {
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+// completeServers completes server names matching sel, if given, with
+// their description, or the `list` numbers of servers once a digit is
+// typed. max limits how many arguments are servers, 0 means any number.
+func completeServers(sel *config.Selector, max int) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if max > 0 && len(args) >= max {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		cfg := completionConfig()
+		if cfg == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		filter := config.Selector{}
+		if sel != nil {
+			filter = *sel
+		}
+		given := make(map[string]bool)
+		for _, arg := range args {
+			given[arg] = true
+		}
+
+		var completions []string
+		if _, err := strconv.Atoi(toComplete); err == nil {
+			// Numbers are positions in the unfiltered `list`
+			for i, server := range cfg.GetServersList() {
+				id := strconv.Itoa(i + 1)
+				if filter.Matches(server) && strings.HasPrefix(id, toComplete) {
+					completions = append(completions, id+"\t"+server.Name)
+				}
+			}
+			return completions, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		for _, server := range cfg.Select(filter) {
+			if !given[server.Name] && strings.HasPrefix(server.Name, toComplete) {
+				completions = append(completions, server.Name+"\t"+serverSummary(server))
+			}
+		}
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+func serverSummary(server config.Server) string {
+	if server.Description != "" {
+		return fmt.Sprintf("%s (%s)", server.Description, server.Hostname)
+	}
+	return server.Hostname
+}
+
+// completeFieldValues completes a flag from the values a server field
+// takes across the config, with the number of servers using each.
+func completeFieldValues(field func(config.Server) []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cfg := completionConfig()
+		if cfg == nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+
+		// Slice flags arrive as "a,b,c" with only the last value unfinished
+		prefix := ""
+		if i := strings.LastIndex(toComplete, ","); i >= 0 {
+			prefix, toComplete = toComplete[:i+1], toComplete[i+1:]
+		}
+
+		// Values are matched ignoring case, so "Prod" and "prod" are one
+		counts := make(map[string]int)
+		spelling := make(map[string]string)
+		for _, server := range cfg.GetServersList() {
+			for _, value := range field(server) {
+				if value == "" {
+					continue
+				}
+				key := strings.ToLower(value)
+				if _, ok := spelling[key]; !ok {
+					spelling[key] = value
+				}
+				counts[key]++
+			}
+		}
+
+		var completions []string
+		for key, count := range counts {
+			if value := spelling[key]; strings.HasPrefix(value, toComplete) {
+				completions = append(completions, fmt.Sprintf("%s%s\t%d server(s)", prefix, value, count))
+			}
+		}
+		sort.Strings(completions)
+		return completions, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+var (
+	completeGroups = completeFieldValues(func(s config.Server) []string { return []string{s.Group} })
+	completeEnvs   = completeFieldValues(func(s config.Server) []string { return []string{s.Environment} })
+	completeTags   = completeFieldValues(func(s config.Server) []string { return s.Tags })
+)
+
+// completeSessions completes configured sessions and group names for
+// `session open`.
+func completeSessions(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg := completionConfig()
+	if cfg == nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, name := range cfg.SessionNames() {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name+"\tsession")
+		}
+	}
+	for _, group := range config.Groups(cfg.GetServersList()) {
+		if _, ok := cfg.Sessions[group]; !ok && group != "" && strings.HasPrefix(group, toComplete) {
+			completions = append(completions, group+"\tgroup")
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeServersAndGroups completes the group names and servers matching
+// sel, for commands that take either.
+func completeServersAndGroups(sel *config.Selector) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	servers := completeServers(sel, 1)
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		completions, directive := servers(cmd, args, toComplete)
+		if len(args) > 0 {
+			return completions, directive
+		}
+		cfg := completionConfig()
+		if cfg == nil {
+			return completions, directive
+		}
+		for _, group := range config.Groups(cfg.Select(*sel)) {
+			if group != "" && strings.HasPrefix(group, toComplete) {
+				completions = append(completions, group+"\tgroup")
+			}
+		}
+		return completions, directive
+	}
+}
+
+// completeExtends completes the templates and servers --extends can name.
+// Templates are gone once the config is expanded, so the layers are read
+// as they are.
+func completeExtends(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	layers, err := config.Layers(configFile)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	cfg, err := config.LoadLayers(layers)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for name := range cfg.Templates {
+		if strings.HasPrefix(name, toComplete) {
+			completions = append(completions, name+"\ttemplate")
+		}
+	}
+	for name, server := range cfg.Servers {
+		if strings.HasPrefix(name, toComplete) && !strings.Contains(name, "{") {
+			completions = append(completions, name+"\t"+serverSummary(server))
+		}
+	}
+	sort.Strings(completions)
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeCopyArgs completes local files, <server>: prefixes and, once a
+// server is given, the paths on it.
+func completeCopyArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if toComplete == "" || strings.ContainsAny(toComplete[:1], "./~") {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	cfg := completionConfig()
+	if cfg == nil {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+
+	if name, path, ok := strings.Cut(toComplete, ":"); ok && !strings.Contains(name, "/") {
+		server, err := cfg.Find(cpSelector, name)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var completions []string
+		for _, remote := range remotePaths(server, path) {
+			completions = append(completions, name+":"+remote)
+		}
+		return completions, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var completions []string
+	for _, server := range cfg.Select(cpSelector) {
+		if strings.HasPrefix(server.Name, toComplete) {
+			completions = append(completions, server.Name+":\t"+serverSummary(server))
+		}
+	}
+	if len(completions) == 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return completions, cobra.ShellCompDirectiveNoSpace | cobra.ShellCompDirectiveNoFileComp
+}
+
+// remotePaths lists the paths on server starting with prefix, directories
+// with a trailing slash. It never prompts, so servers that need a
+// passphrase or confirmation complete nothing.
+func remotePaths(server config.Server, prefix string) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), remotePathTimeout)
+	defer cancel()
+
+	client := ssh.NewClient(server)
+	client.Mux = true
+	client.Batch = true
+	cleanup, err := client.Prepare(ctx)
+	if err != nil {
+		return nil
+	}
+	defer cleanup()
+
+	args, err := client.Options()
+	if err != nil {
+		return nil
+	}
+	// The glob must stay outside the quotes to expand
+	glob := panes.ShellJoin([]string{prefix}) + "*"
+	args = append(args, "-o", "BatchMode=yes", "-o", "ConnectTimeout=3",
+		client.Destination(), "ls -1dp -- "+glob+" 2>/dev/null")
+
+	out, err := exec.CommandContext(ctx, "ssh", args...).Output()
+	if err != nil && len(out) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n")
+}
+
+func init() {
+	connectCmd.ValidArgsFunction = completeServers(&connectSelector, 1)
+	execCmd.ValidArgsFunction = completeServers(&execSelector, 1)
+	tunnelCmd.ValidArgsFunction = completeServers(&tunnelSelector, 1)
+	infoCmd.ValidArgsFunction = completeServersAndGroups(&infoSelector)
+	cpCmd.ValidArgsFunction = completeCopyArgs
+	sessionOpenCmd.ValidArgsFunction = completeSessions
+	historyCmd.ValidArgsFunction = completeServers(nil, 1)
+
+	for _, cmd := range []*cobra.Command{configEditCmd, configRemoveCmd} {
+		cmd.ValidArgsFunction = completeServers(nil, 1)
+	}
+	configShowCmd.ValidArgsFunction = completeServers(nil, 0)
+	favAddCmd.ValidArgsFunction = completeServers(nil, 0)
+	favRemoveCmd.ValidArgsFunction = completeServers(nil, 0)
+	keysListCmd.ValidArgsFunction = completeServers(&keysSelector, 0)
+	keysCheckCmd.ValidArgsFunction = completeServers(&keysSelector, 0)
+	keysAddCmd.ValidArgsFunction = completeServers(&keysSelector, 0)
+	hostkeysScanCmd.ValidArgsFunction = completeServers(&hostkeysSelector, 0)
+	hostkeysCheckCmd.ValidArgsFunction = completeServers(&hostkeysSelector, 0)
+	muxStatusCmd.ValidArgsFunction = completeServers(&muxSelector, 0)
+	muxStopCmd.ValidArgsFunction = completeServers(&muxSelector, 0)
+
+	completionCmd.AddCommand(completionInstallCmd)
+	rootCmd.AddCommand(completionCmd)
+}
@@ -0,0 +1,694 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"ssh-tool/internal/config"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// serverFlags holds the field flags shared by `config add` and `config edit`.
+type serverFlags struct {
+	hostname       string
+	extends        string
+	user           string
+	pemFile        string
+	description    string
+	group          string
+	environment    string
+	tags           []string
+	port           int
+	proxyJump      string
+	options        map[string]string
+	identityAgent  string
+	setEnv         map[string]string
+	remoteCommand  string
+	muxIdle        string
+	caKey          string
+	caURL          string
+	principals     []string
+	certTTL        string
+	preConnect     []string
+	postDisconnect []string
+	transport      string
+	instanceID     string
+	awsProfile     string
+	awsRegion      string
+}
+
+func (f *serverFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.hostname, "hostname", "", "hostname or IP address")
+	cmd.Flags().StringVar(&f.user, "user", "", "login user")
+	cmd.Flags().StringVar(&f.extends, "extends", "", "template or server to inherit unset fields from")
+	cmd.Flags().StringVar(&f.pemFile, "pem-file", "", "private key file, or a secret such as vault://secret/ssh/prod, env://VAR or keychain://service/account")
+	cmd.Flags().StringVar(&f.description, "description", "", "free-form description")
+	cmd.Flags().StringVar(&f.group, "group", "", "server group")
+	cmd.Flags().StringVar(&f.environment, "env", "", "environment, e.g. prod or staging")
+	cmd.Flags().StringSliceVar(&f.tags, "tag", nil, "tag (repeatable, replaces existing tags)")
+	cmd.Flags().IntVar(&f.port, "port", 0, "SSH port (default 22)")
+	cmd.Flags().StringVar(&f.proxyJump, "proxy-jump", "", "jump host, as for ssh -J")
+	cmd.Flags().StringToStringVar(&f.options, "option", nil, "ssh option as key=value (repeatable, replaces existing options)")
+	cmd.Flags().StringVar(&f.identityAgent, "identity-agent", "", "ssh-agent socket to use for this server")
+	cmd.Flags().StringToStringVar(&f.setEnv, "set-env", nil, "environment variable to send as KEY=VALUE (repeatable, replaces existing)")
+	cmd.Flags().StringVar(&f.remoteCommand, "remote-command", "", "command to run on connect instead of a login shell")
+	cmd.Flags().StringVar(&f.transport, "transport", "", "ssh (default) or ssm to connect through AWS Session Manager")
+	cmd.Flags().StringVar(&f.instanceID, "instance-id", "", "EC2 instance ID, for transport ssm")
+	cmd.Flags().StringVar(&f.awsProfile, "aws-profile", "", "AWS profile for transport ssm")
+	cmd.Flags().StringVar(&f.awsRegion, "aws-region", "", "AWS region for transport ssm")
+	cmd.Flags().StringVar(&f.muxIdle, "mux-idle", "", `how long a shared connection stays open unused, e.g. 30m, or "off"`)
+	cmd.Flags().StringVar(&f.caKey, "ca-key", "", "CA private key that signs certificates for this server")
+	cmd.Flags().StringVar(&f.caURL, "ca-url", "", "endpoint that signs certificates for this server")
+	cmd.Flags().StringSliceVar(&f.principals, "principal", nil, "certificate principal (repeatable, default the login user)")
+	cmd.Flags().StringVar(&f.certTTL, "cert-ttl", "", "certificate lifetime, e.g. 8h (default 1h)")
+	cmd.Flags().StringArrayVar(&f.preConnect, "pre-connect", nil, "shell command to run before connecting (repeatable, replaces existing)")
+	cmd.Flags().StringArrayVar(&f.postDisconnect, "post-disconnect", nil, "shell command to run after disconnecting (repeatable, replaces existing)")
+
+	cmd.RegisterFlagCompletionFunc("group", completeGroups)
+	cmd.RegisterFlagCompletionFunc("env", completeEnvs)
+	cmd.RegisterFlagCompletionFunc("tag", completeTags)
+	cmd.RegisterFlagCompletionFunc("extends", completeExtends)
+}
+
+// apply copies every flag the user actually set onto server.
+func (f *serverFlags) apply(cmd *cobra.Command, server *config.Server) {
+	changed := cmd.Flags().Changed
+	if changed("hostname") {
+		server.Hostname = f.hostname
+	}
+	if changed("user") {
+		server.User = f.user
+	}
+	if changed("extends") {
+		server.Extends = f.extends
+	}
+	if changed("pem-file") {
+		server.PemFile = f.pemFile
+	}
+	if changed("description") {
+		server.Description = f.description
+	}
+	if changed("group") {
+		server.Group = f.group
+	}
+	if changed("env") {
+		server.Environment = f.environment
+	}
+	if changed("tag") {
+		server.Tags = f.tags
+	}
+	if changed("port") {
+		server.Port = f.port
+	}
+	if changed("proxy-jump") {
+		server.ProxyJump = f.proxyJump
+	}
+	if changed("option") {
+		server.Options = f.options
+	}
+	if changed("identity-agent") {
+		server.IdentityAgent = f.identityAgent
+	}
+	if changed("set-env") {
+		server.Env = f.setEnv
+	}
+	if changed("remote-command") {
+		server.RemoteCommand = f.remoteCommand
+	}
+	if changed("transport") {
+		server.Transport = f.transport
+	}
+	if changed("instance-id") {
+		server.InstanceID = f.instanceID
+	}
+	if changed("aws-profile") {
+		server.AWSProfile = f.awsProfile
+	}
+	if changed("aws-region") {
+		server.AWSRegion = f.awsRegion
+	}
+	if changed("mux-idle") {
+		server.MuxIdle = f.muxIdle
+	}
+	if f.changesCA(cmd) {
+		ca := config.CA{}
+		if server.CA != nil {
+			ca = *server.CA
+		}
+		if changed("ca-key") {
+			ca.Key, ca.URL = f.caKey, ""
+		}
+		if changed("ca-url") {
+			ca.URL, ca.Key = f.caURL, ""
+		}
+		if changed("principal") {
+			ca.Principals = f.principals
+		}
+		if changed("cert-ttl") {
+			ca.TTL = f.certTTL
+		}
+		server.CA = &ca
+	}
+	if changed("pre-connect") || changed("post-disconnect") {
+		hooks := config.Hooks{}
+		if server.Hooks != nil {
+			hooks = *server.Hooks
+		}
+		if changed("pre-connect") {
+			hooks.PreConnect = f.preConnect
+		}
+		if changed("post-disconnect") {
+			hooks.PostDisconnect = f.postDisconnect
+		}
+		server.Hooks = &hooks
+	}
+}
+
+// changed reports whether any field flag was set. It doesn't count the
+// persistent flags, such as --config, inherited from the root command.
+func (f *serverFlags) changed(cmd *cobra.Command) bool {
+	changed := false
+	cmd.LocalNonPersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		changed = changed || flag.Changed
+	})
+	return changed
+}
+
+func (f *serverFlags) changesCA(cmd *cobra.Command) bool {
+	for _, name := range []string{"ca-key", "ca-url", "principal", "cert-ttl"} {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	addFlags   serverFlags
+	editFlags  serverFlags
+	strict     bool
+	showOrigin bool
+	revoke     bool
+
+	configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Manage the user server configuration",
+		Long: `Add, edit, remove and validate servers in the user config file
+(~/.config/ssh-tool/servers.json, or servers.yaml, servers.yml or
+servers.toml).
+
+Configuration is layered, later layers overriding fields of entries with
+the same name in earlier ones:
+
+  1. embedded defaults
+  2. /etc/ssh-tool/servers.json, .yaml, .yml or .toml
+  3. ~/.config/ssh-tool/servers.json, .yaml, .yml or .toml
+  4. .ssh-tool.json, .ssh-tool.yaml, .ssh-tool.yml or .ssh-tool.toml in
+     the current directory or a parent
+  5. the file given with --config
+
+A project config comes with whatever repository is checked out, so its
+hooks and the ssh options that run local commands, such as ProxyCommand
+and LocalCommand, are ignored with a warning until you review the file
+and run 'config trust'. Trust is recorded for the file's exact content:
+after any change it has to be trusted again.
+
+Each file is read as JSON, YAML or TOML as its extension says; where a
+directory has several, the first of .json, .yaml, .yml and .toml is used.
+'config schema' prints a JSON Schema for editors. The add, edit and remove
+flags only rewrite JSON files, so that comments in YAML and TOML are kept:
+edit those with 'config edit' and no flags.
+
+Near-identical servers can share fields: "defaults" are inherited by every
+server, "templates" by the entries that name them in "extends", and a name
+such as web-{1..8} or api-{use1,euw2} defines one server per value, with
+the same {...} in its hostname replaced too. ${VAR} in hostname, user,
+pem_file, proxy_jump and description is taken from "vars", ${env:VAR} from
+the environment and ${name} is the server's name:
+
+  "vars": {"domain": "prod.internal"},
+  "templates": {"base-prod": {"user": "deploy", "environment": "prod"}},
+  "servers": {
+    "web-{1..8}": {"extends": "base-prod", "hostname": "web-{1..8}.${domain}"}
+  }
+
+An entry that can't be expanded, such as one using an undefined variable,
+is skipped with a warning rather than failing every command, and 'config
+validate' reports it as an error.`,
+	}
+
+	configAddCmd = &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add a server to the user config",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := updateUserConfig(func(user *config.Config) error {
+				name := args[0]
+				if _, exists := user.Servers[name]; exists {
+					return fmt.Errorf("server %s already exists, use 'ssh-tool config edit'", name)
+				}
+
+				server := config.Server{Name: name}
+				addFlags.apply(cmd, &server)
+				user.Servers[name] = server
+				return nil
+			})
+			if err == nil {
+				fmt.Printf("Added %s\n", args[0])
+			}
+			return err
+		},
+	}
+
+	configEditCmd = &cobra.Command{
+		Use:   "edit [name]",
+		Short: "Edit a server, or open the user config in $EDITOR",
+		Long: `With field flags, update a single server in the user config. For a
+server defined in another layer, only the changed fields are stored as an
+override in the user config. Without flags, the user config file is opened in $EDITOR and
+validated before it is saved.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !editFlags.changed(cmd) {
+				return editUserConfigFile()
+			}
+			if len(args) == 0 {
+				return fmt.Errorf("a server name is required when editing fields")
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			err = updateUserConfig(func(user *config.Config) error {
+				name := args[0]
+				if _, ok := cfg.Servers[name]; !ok {
+					return fmt.Errorf("server %s not found", name)
+				}
+
+				// Only the changed fields go into the user config, the rest
+				// keeps coming from the layer that defines the server
+				server := user.Servers[name]
+				server.Name = name
+
+				// Layers replace the ca and hooks as a whole, so editing
+				// one of their fields has to carry the others over
+				if server.CA == nil && editFlags.changesCA(cmd) {
+					server.CA = cfg.Servers[name].CA
+				}
+				if server.Hooks == nil && (cmd.Flags().Changed("pre-connect") || cmd.Flags().Changed("post-disconnect")) {
+					server.Hooks = cfg.Servers[name].Hooks
+				}
+
+				editFlags.apply(cmd, &server)
+				user.Servers[name] = server
+				return nil
+			})
+			if err == nil {
+				fmt.Printf("Updated %s\n", args[0])
+			}
+			return err
+		},
+	}
+
+	configRemoveCmd = &cobra.Command{
+		Use:     "remove <name>",
+		Aliases: []string{"rm"},
+		Short:   "Remove a server from the user config",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			err = updateUserConfig(func(user *config.Config) error {
+				name := args[0]
+				if _, ok := user.Servers[name]; !ok {
+					if origins, ok := cfg.Origins[name]; ok {
+						return fmt.Errorf("server %s is defined in %s, not in the user config", name, strings.Join(origins, ", "))
+					}
+					return fmt.Errorf("server %s not found", name)
+				}
+				delete(user.Servers, name)
+				return nil
+			})
+			if err == nil {
+				fmt.Printf("Removed %s\n", args[0])
+			}
+			return err
+		},
+	}
+
+	configValidateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration for problems",
+		Long: `Check every config file in use for keys the config doesn't define, such
+as a misspelt field, which loading the files ignores, and every server
+for problems. Exits non-zero on errors, and with --strict on warnings.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+
+			issues, err := unknownKeyIssues()
+			if err != nil {
+				return err
+			}
+			issues = append(issues, cfg.Validate()...)
+			printIssues(issues)
+			if len(issues) == 0 {
+				fmt.Printf("Configuration OK (%d servers)\n", len(cfg.Servers))
+				return nil
+			}
+			if config.HasErrors(issues) || strict {
+				return fmt.Errorf("configuration has %d problem(s)", len(issues))
+			}
+			return nil
+		},
+	}
+
+	configTrustCmd = &cobra.Command{
+		Use:   "trust [file]",
+		Short: "Allow a project config to run commands",
+		Long: `Trust the project config, by default the .ssh-tool.* file found in the
+current directory or a parent, to set hooks and ssh options that run
+local commands. Review the file first: trust is recorded for its current
+content, and any later change has to be trusted again. --revoke forgets
+the file.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file := config.ProjectConfigPath()
+			if len(args) > 0 {
+				file = args[0]
+			}
+			if file == "" {
+				return fmt.Errorf("no project config in the current directory or a parent, name the file to trust")
+			}
+
+			if revoke {
+				trusted, err := config.Untrust(file)
+				if err != nil {
+					return err
+				}
+				if !trusted {
+					return fmt.Errorf("%s is not trusted", file)
+				}
+				fmt.Printf("No longer trusting %s\n", file)
+				return nil
+			}
+			if err := config.Trust(file); err != nil {
+				return err
+			}
+			fmt.Printf("Trusted %s\n", file)
+			return nil
+		},
+	}
+
+	configShowCmd = &cobra.Command{
+		Use:   "show [name...]",
+		Short: "Print the effective configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			if showOrigin {
+				printOrigins(cfg, args)
+				return nil
+			}
+
+			out := cfg
+			if len(args) > 0 {
+				out = &config.Config{Servers: make(map[string]config.Server)}
+				for _, name := range args {
+					server, ok := cfg.Servers[name]
+					if !ok {
+						return fmt.Errorf("server %s not found", name)
+					}
+					out.Servers[name] = server
+				}
+			}
+
+			data, err := json.MarshalIndent(out, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(data))
+			return nil
+		},
+	}
+
+	configSchemaCmd = &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schema of the config file",
+		Long: `Print a JSON Schema (draft-07) describing the config file, so editors
+can check and complete it. Save it somewhere and point a JSON file at it
+with a "$schema" key, or a YAML file with a first-line comment:
+
+  {"$schema": "/path/to/ssh-tool.schema.json", "servers": {...}}
+
+  # yaml-language-server: $schema=/path/to/ssh-tool.schema.json`,
+		Example: `  ssh-tool config schema > ~/.config/ssh-tool/schema.json`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, err := os.Stdout.Write(config.JSONSchema)
+			return err
+		},
+	}
+)
+
+// errDryRun lets an updateUserConfig callback stop before anything is saved.
+var errDryRun = errors.New("dry run")
+
+// updateUserConfig loads the user config file, lets update modify it and
+// writes it back atomically if every entry still passes validation.
+func updateUserConfig(update func(*config.Config) error) error {
+	path, err := config.UserConfigPath()
+	if err != nil {
+		return err
+	}
+
+	user, err := config.ReadFileOrEmpty(path)
+	if err != nil {
+		return err
+	}
+
+	if err := update(user); err != nil {
+		return err
+	}
+
+	return writeUserConfig(user, path)
+}
+
+func writeUserConfig(user *config.Config, path string) error {
+	if err := checkUserConfig(user, path); err != nil {
+		return err
+	}
+	return user.WriteFile(path)
+}
+
+// checkUserConfig reports every validation issue but only refuses to save
+// entries that break the schema; a key that is not on disk yet is fine.
+// Entries may override single fields of a lower layer, so they are checked
+// after merging.
+func checkUserConfig(user *config.Config, path string) error {
+	base, err := config.LoadLayers(config.BaseLayers())
+	if err != nil {
+		return err
+	}
+
+	merged, err := config.MergeOnto(base, user)
+	if err != nil {
+		return fmt.Errorf("not saving %s: %v", path, err)
+	}
+	printIssues(merged.Validate())
+
+	for _, server := range merged.GetServersList() {
+		if len(config.ValidateServer(server)) > 0 {
+			return fmt.Errorf("not saving %s: server %s is invalid", path, server.Name)
+		}
+	}
+	return nil
+}
+
+// editUserConfigFile opens a copy of the user config in $EDITOR and only
+// replaces the real file once the edited copy parses and validates. The
+// copy is the file as it is, in its own format and with its comments.
+func editUserConfigFile() error {
+	path, err := config.UserConfigPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		data, err = json.MarshalIndent(&config.Config{Servers: make(map[string]config.Server)}, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return err
+	}
+
+	tmpDir, err := os.MkdirTemp("", "ssh-tool-edit-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, filepath.Base(path))
+	if err := os.WriteFile(tmpFile, data, 0o600); err != nil {
+		return err
+	}
+
+	for {
+		if err := runEditor(tmpFile); err != nil {
+			return err
+		}
+
+		edited, err := config.ReadFile(tmpFile)
+		if err == nil {
+			err = checkUnknownKeys(tmpFile)
+		}
+		if err == nil {
+			err = checkUserConfig(edited, path)
+		}
+		if err == nil {
+			if data, err = os.ReadFile(tmpFile); err == nil {
+				err = config.ReplaceFile(path, data)
+			}
+		}
+		if err == nil {
+			fmt.Printf("Saved %s\n", path)
+			return nil
+		}
+
+		fmt.Printf("%v\n", err)
+		if !confirm("Edit again?") {
+			return fmt.Errorf("changes discarded")
+		}
+	}
+}
+
+// unknownKeyIssues checks every config file in use for keys the config
+// doesn't define, which loading it ignores.
+func unknownKeyIssues() ([]config.Issue, error) {
+	layers, err := config.Layers(configFile)
+	if err != nil {
+		return nil, err
+	}
+	var issues []config.Issue
+	for _, layer := range layers {
+		if layer.Path == "" {
+			continue
+		}
+		unknown, err := config.UnknownKeys(layer.Path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, perr := range unknown {
+			issues = append(issues, config.Issue{Severity: config.SeverityError, Message: perr.Error()})
+		}
+	}
+	return issues, nil
+}
+
+// checkUnknownKeys refuses a file with keys the config doesn't define.
+func checkUnknownKeys(file string) error {
+	unknown, err := config.UnknownKeys(file)
+	if err != nil || len(unknown) == 0 {
+		return err
+	}
+	messages := make([]string, len(unknown))
+	for i, perr := range unknown {
+		messages[i] = perr.Error()
+	}
+	return fmt.Errorf("%s", strings.Join(messages, "\n"))
+}
+
+func runEditor(file string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	cmd := exec.Command("sh", "-c", editor+` "$1"`, "sh", file)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running editor: %v", err)
+	}
+	return nil
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	var answer string
+	fmt.Scanln(&answer)
+	return answer == "y" || answer == "Y" || answer == "yes"
+}
+
+func printOrigins(cfg *config.Config, names []string) {
+	if len(names) == 0 {
+		for _, server := range cfg.GetServersList() {
+			names = append(names, server.Name)
+		}
+	}
+
+	width := 0
+	for _, name := range names {
+		if len(name) > width {
+			width = len(name)
+		}
+	}
+	for _, name := range names {
+		origins, ok := cfg.Origins[name]
+		if !ok {
+			fmt.Printf("%s  %s\n", colorize(fmt.Sprintf("%-*s", width, name), colorGreen), colorize("not found", colorMagenta))
+			continue
+		}
+		// Later layers win, so list them from highest priority down
+		layers := make([]string, len(origins))
+		for i, origin := range origins {
+			layers[len(origins)-1-i] = origin
+		}
+		fmt.Printf("%s  %s\n", colorize(fmt.Sprintf("%-*s", width, name), colorGreen), strings.Join(layers, " < "))
+	}
+}
+
+func printIssues(issues []config.Issue) {
+	for _, issue := range issues {
+		color := colorYellow
+		if issue.Severity == config.SeverityError {
+			color = colorMagenta
+		}
+		fmt.Println(colorize(issue.String(), color))
+	}
+}
+
+func init() {
+	addFlags.register(configAddCmd)
+	editFlags.register(configEditCmd)
+	configShowCmd.Flags().BoolVar(&showOrigin, "origin", false, "show which config layers define each server")
+	configValidateCmd.Flags().BoolVar(&strict, "strict", false, "treat warnings as errors")
+	configTrustCmd.Flags().BoolVar(&revoke, "revoke", false, "stop trusting the file")
+
+	configCmd.AddCommand(configAddCmd, configEditCmd, configRemoveCmd, configValidateCmd, configShowCmd, configSchemaCmd, configTrustCmd)
+	rootCmd.AddCommand(configCmd)
+}
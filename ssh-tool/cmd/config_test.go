@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestServerFlagsChanged(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{nil, false},
+		{[]string{"--config", "servers.json", "--no-color"}, false},
+		{[]string{"--config", "servers.json", "--user", "deploy"}, true},
+		{[]string{"--tag", "web"}, true},
+	}
+	for _, tt := range tests {
+		root := &cobra.Command{Use: "ssh-tool"}
+		root.PersistentFlags().String("config", "", "")
+		root.PersistentFlags().Bool("no-color", false, "")
+		edit := &cobra.Command{Use: "edit"}
+		root.AddCommand(edit)
+		var flags serverFlags
+		flags.register(edit)
+
+		if err := edit.ParseFlags(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if got := flags.changed(edit); got != tt.want {
+			t.Errorf("changed(%q) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
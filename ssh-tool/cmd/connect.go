@@ -1,48 +1,140 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"ssh-tool/internal/config"
-	"ssh-tool/internal/ssh"
-	"strconv"
+	"ssh-tool/internal/picker"
+	"ssh-tool/internal/state"
 
 	"github.com/spf13/cobra"
 )
 
-var connectCmd = &cobra.Command{
-	Use:   "connect [server number]",
-	Short: "Connect to a server by its number",
-	Args:  cobra.ExactArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
-		cfg, err := config.LoadConfig(configFile)
-		if err != nil {
-			fmt.Printf("Error loading config: %v\n", err)
-			return
+var (
+	connectSelector config.Selector
+	connectRecord   bool
+	connectCmd      = &cobra.Command{
+		Use:   "connect [server]",
+		Short: "Connect to a server by name, number or fuzzy match",
+		Long: `Connect to a server. The argument may be an exact server name, the number
+shown by 'ssh-tool list', a unique name prefix or a fuzzy match, or '-'
+for the server used last, which must still exist under the same name.
+Without an argument an interactive picker is opened.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := loadConfig()
+			if err != nil {
+				fmt.Printf("Error loading config: %v\n", err)
+				return
+			}
+
+			query := ""
+			if len(args) > 0 {
+				query = args[0]
+			}
+
+			server, err := selectServer(cfg, connectSelector, query)
+			if err != nil {
+				fmt.Printf("Error selecting server: %v\n", err)
+				return
+			}
+
+			fmt.Printf("Connecting to %s (%s)...\n", server.Name, server.Hostname)
+
+			opts := sessionOptions{command: "connect", record: connectRecord, hooks: cfg.HooksFor(server)}
+			if _, err := runSession(server, opts); err != nil {
+				fmt.Printf("Error connecting to server: %v\n", err)
+				return
+			}
+		},
+	}
+)
+
+// selectServer resolves query among the servers matching sel. "-" picks
+// the most recently used server. An empty query, or one that matches
+// several servers, falls through to the interactive picker when a terminal
+// is available; favourites are listed first there.
+func selectServer(cfg *config.Config, sel config.Selector, query string) (config.Server, error) {
+	st := loadState()
+
+	if query == "-" {
+		last, ok := st.Last()
+		if !ok {
+			return config.Server{}, fmt.Errorf("no previous connection to return to")
 		}
+		// Only the exact name will do: a lookup would fall back to
+		// matching and connect to a different server if it was renamed
+		server, ok := cfg.Servers[last]
+		if !ok {
+			return config.Server{}, fmt.Errorf("last server %s no longer exists", last)
+		}
+		server.Name = last
+		if !sel.Matches(server) {
+			return config.Server{}, fmt.Errorf("server %s does not match %s", last, sel)
+		}
+		return server, nil
+	}
 
-		num, err := strconv.Atoi(args[0])
-		if err != nil {
-			fmt.Printf("Invalid server number: %v\n", err)
-			return
+	var candidates []config.Server
+	filter := ""
+	if query != "" {
+		server, err := cfg.Find(sel, query)
+		if err == nil {
+			return server, nil
 		}
 
-		servers := cfg.GetServersList()
-		if num < 1 || num > len(servers) {
-			fmt.Printf("Invalid server number. Please choose between 1 and %d\n", len(servers))
-			return
+		var ambiguous *config.AmbiguousError
+		if !errors.As(err, &ambiguous) || !picker.Available() {
+			return config.Server{}, err
+		}
+		candidates = ambiguous.Matches
+		// Start the picker on what was typed, so it can be refined
+		filter = query
+	} else {
+		candidates = cfg.Select(sel)
+		if len(candidates) == 0 {
+			if sel.Empty() {
+				return config.Server{}, fmt.Errorf("no servers configured")
+			}
+			return config.Server{}, fmt.Errorf("no servers match %s", sel)
 		}
+	}
 
-		server := servers[num-1]
-		fmt.Printf("Connecting to %s (%s)...\n", server.Name, server.Hostname)
+	if !picker.Available() {
+		return config.Server{}, fmt.Errorf("no server given and no terminal for the interactive picker")
+	}
 
-		client := ssh.NewClient(server)
-		if err := client.Connect(); err != nil {
-			fmt.Printf("Error connecting to server: %v\n", err)
-			return
+	st.SortFavoritesFirst(candidates)
+	items := make([]picker.Item, 0, len(candidates))
+	for _, s := range candidates {
+		name := s.Name
+		if st.IsFavorite(s.Name) {
+			name = favoriteMark + name
 		}
-	},
+		items = append(items, picker.Item{Name: name, Hostname: s.Hostname, Description: s.Description})
+	}
+
+	index, err := picker.Run(items, filter)
+	if err != nil {
+		return config.Server{}, err
+	}
+	return candidates[index], nil
+}
+
+// loadState returns the user state, or empty state with a warning if it
+// can't be read; history and favourites are never worth failing over.
+func loadState() *state.State {
+	st, err := state.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return &state.State{}
+	}
+	return st
 }
 
 func init() {
+	connectCmd.Flags().BoolVar(&connectRecord, "record", false, "record the session as an asciinema cast file")
+	addSelectorFlags(connectCmd, &connectSelector)
 	rootCmd.AddCommand(connectCmd)
 }
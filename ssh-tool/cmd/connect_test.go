@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/state"
+)
+
+func TestSelectServerLast(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	cfg := &config.Config{Servers: map[string]config.Server{
+		"prod-api-2": {Name: "prod-api-2", Environment: "prod"},
+		"prod-db":    {Name: "prod-db", Environment: "prod"},
+	}}
+
+	tests := []struct {
+		last    string
+		sel     config.Selector
+		want    string
+		wantErr string
+	}{
+		{last: "", wantErr: "no previous connection"},
+		{last: "prod-db", want: "prod-db"},
+		// prod-api was removed: its prefix must not pick prod-api-2
+		{last: "prod-api", wantErr: "last server prod-api no longer exists"},
+		{last: "prod-db", sel: config.Selector{Environment: "staging"}, wantErr: "server prod-db does not match env=staging"},
+	}
+	for _, tt := range tests {
+		err := state.Update(func(st *state.State) error {
+			st.Recent = nil
+			if tt.last != "" {
+				st.RecordVisit(tt.last, time.Now())
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := selectServer(cfg, tt.sel, "-")
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("last %q: error = %v, want one containing %q", tt.last, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("last %q: %v", tt.last, err)
+		} else if got.Name != tt.want {
+			t.Errorf("last %q: got %s, want %s", tt.last, got.Name, tt.want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/ssh"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	cpSelector  config.Selector
+	cpRecursive bool
+
+	cpCmd = &cobra.Command{
+		Use:   "cp <source>... <target>",
+		Short: "Copy files to or from a server with scp",
+		Long: `Copy files between this machine and a server. Remote paths are written
+as <server>:<path>, where the server is chosen as for 'ssh-tool connect'.
+All remote paths must be on the same server. The copy reuses the shared
+connection to the server if there is one.`,
+		Example: `  ssh-tool cp prod-api:/var/log/app.log .
+  ssh-tool cp -r ./dist prod-api:/srv/app/`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			code, err := copyFiles(cfg, cpSelector, args, cpRecursive)
+			if code > 0 {
+				os.Exit(code)
+			}
+			if err != nil {
+				return fmt.Errorf("error copying: %v", err)
+			}
+			return nil
+		},
+	}
+)
+
+// copyFiles runs scp for args, where remote paths are <server>:<path> on
+// a single server.
+func copyFiles(cfg *config.Config, sel config.Selector, args []string, recursive bool) (int, error) {
+	var server config.Server
+	remote := make(map[int]string)
+	for i, arg := range args {
+		query, path, ok := strings.Cut(arg, ":")
+		// ./a:b and /a:b are local files, as with scp
+		if !ok || query == "" || strings.Contains(query, "/") {
+			continue
+		}
+		s, err := cfg.Find(sel, query)
+		if err != nil {
+			return 0, err
+		}
+		if server.Name != "" && s.Name != server.Name {
+			return 0, fmt.Errorf("can't copy between %s and %s, use one server at a time", server.Name, s.Name)
+		}
+		server = s
+		remote[i] = path
+	}
+	if server.Name == "" {
+		return 0, fmt.Errorf("no remote path given, write it as <server>:<path>")
+	}
+
+	opts := sessionOptions{
+		command: "cp",
+		remote:  args,
+		hooks:   cfg.HooksFor(server),
+		build: func(client *ssh.Client) (*exec.Cmd, error) {
+			scpArgs, err := client.ScpOptions()
+			if err != nil {
+				return nil, err
+			}
+			if recursive {
+				scpArgs = append(scpArgs, "-r")
+			}
+			for i, arg := range args {
+				if path, ok := remote[i]; ok {
+					arg = client.Destination() + ":" + path
+				}
+				scpArgs = append(scpArgs, arg)
+			}
+			return exec.Command("scp", scpArgs...), nil
+		},
+	}
+	return runSession(server, opts)
+}
+
+func init() {
+	cpCmd.Flags().BoolVarP(&cpRecursive, "recursive", "r", false, "copy directories recursively")
+	addSelectorFlags(cpCmd, &cpSelector)
+	rootCmd.AddCommand(cpCmd)
+}
@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"path/filepath"
+	"ssh-tool/internal/audit"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/panes"
+	"ssh-tool/internal/ssh"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// statScript prints "mtime size mode owner:group" of $1, or of the file it
+// links to, with GNU or BSD stat, which tells whether the file changed
+// since it was opened.
+const statScript = `stat -L -c '%Y %s %a %u:%g' -- "$1" 2>/dev/null || stat -L -f '%m %z %Lp %u:%g' -- "$1"`
+
+// fetchScript copies $1 to the temporary file $2, which sftp can read,
+// and its stat line to $2.stat; both are empty for a new file. %[1]s is
+// sudo or nothing, %[2]s the quoted statScript.
+const fetchScript = `umask 077
+: > "$2.stat"
+: > "$2"
+if %[1]s test -e "$1"; then
+	%[1]s sh -c %[2]s sh "$1" > "$2.stat" && %[1]s cat -- "$1" > "$2"
+fi`
+
+// installScript moves the uploaded $1 over $2 with a rename in the same
+// directory, so the file is never half written. A symlink is resolved
+// first and the file it points to replaced, so the link stays. It exits
+// with errRemoteChanged's code if $2 no longer has the stat line $3,
+// unless $5 forces it. $4 is the backup path, $6 the mode and $7 the owner.
+const installScript = `umask 022
+current=$(%[1]s sh -c %[2]s sh "$2" 2>/dev/null) || current=
+if [ -z "$5" ] && [ "$current" != "$3" ]; then
+	rm -f "$1"
+	exit 75
+fi
+target=$(%[1]s readlink -f -- "$2" 2>/dev/null || %[1]s realpath -- "$2" 2>/dev/null) || target=
+[ -n "$target" ] || target=$2
+stage="$target.ssh-tool-$$"
+trap '%[1]s rm -f "$stage"; rm -f "$1"' EXIT
+set -e
+%[1]s cp -- "$1" "$stage"
+if [ -n "$6" ]; then %[1]s chmod "$6" "$stage"; fi
+if [ -n "$7" ]; then %[1]s chown "$7" "$stage"; fi
+if [ -n "$4" ] && [ -e "$target" ]; then %[1]s cp -p -- "$target" "$4"; fi
+%[1]s mv -f -- "$stage" "$target"`
+
+// remoteChangedCode is the exit code of installScript when the file was
+// changed by someone else.
+const remoteChangedCode = 75
+
+var errRemoteChanged = errors.New("changed on the server since it was opened")
+
+var (
+	editSelector config.Selector
+	editSudo     bool
+	editBackup   bool
+	editYes      bool
+
+	editCmd = &cobra.Command{
+		Use:   "edit <server>:<path>",
+		Short: "Edit a remote file in the local $EDITOR",
+		Long: `Download a file over SFTP, open it in $VISUAL or $EDITOR and, once the
+editor exits, show the changes and upload them. The new version is copied
+next to the file and renamed over it, so the file is never half written,
+and its mode and owner are kept. A symlink is followed and the file it
+points to replaced. If the file changed on the server while it was being
+edited, nothing is overwritten without asking.
+
+With --sudo the file is read and written through sudo, for files the
+login user can't access; sudo may ask for a password. A path that doesn't
+exist yet is created.`,
+		Example: `  ssh-tool edit web-1:/etc/nginx/nginx.conf --sudo --backup
+  ssh-tool edit prod-api:app/.env`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query, remotePath, ok := strings.Cut(args[0], ":")
+			if !ok || query == "" || remotePath == "" {
+				return fmt.Errorf("write the file as <server>:<path>")
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			server, err := selectServer(cfg, editSelector, query)
+			if err != nil {
+				return err
+			}
+
+			finish, err := startHooks(server, "edit", cfg.HooksFor(server))
+			if err != nil {
+				return err
+			}
+			code := 0
+			defer func() { finish(code) }()
+
+			entry := audit.Entry{
+				Command:  "edit",
+				Server:   server.Name,
+				Hostname: server.Hostname,
+				User:     server.User,
+				Remote:   remotePath,
+				Start:    time.Now(),
+			}
+			if u, err := user.Current(); err == nil {
+				entry.LocalUser = u.Username
+			}
+
+			err = editRemoteFile(server, remotePath)
+			entry.End = time.Now()
+			if err != nil {
+				code = 1
+				entry.ExitCode, entry.Error = code, err.Error()
+			}
+			appendAudit(entry)
+			return err
+		},
+	}
+)
+
+// remoteFile is a file being edited on a server.
+type remoteFile struct {
+	client *ssh.Client
+	path   string
+	sudo   string
+	// tmp is a file only the login user can read, which sftp transfers
+	// the contents through
+	tmp string
+}
+
+func editRemoteFile(server config.Server, remotePath string) error {
+	client := ssh.NewClient(server)
+	client.Mux = true
+	cleanup, err := client.Prepare(context.Background())
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	// One shared connection serves the several ssh and sftp runs
+	if client.Multiplexed() {
+		if err := client.StartMaster(); err != nil {
+			if server.Transport == config.TransportSSM {
+				explainSSMFailure(server)
+			}
+			return err
+		}
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	file := &remoteFile{client: client, path: remotePath, tmp: "/tmp/ssh-tool-edit-" + hex.EncodeToString(id)}
+	if editSudo {
+		file.sudo = "sudo"
+	}
+
+	dir, err := os.MkdirTemp("", "ssh-tool-edit-")
+	if err != nil {
+		return err
+	}
+	// Keep the file's name so the editor picks the right syntax
+	local := filepath.Join(dir, path.Base(remotePath))
+	keep := false
+	defer func() {
+		if !keep {
+			os.RemoveAll(dir)
+		}
+	}()
+
+	stat, err := file.fetch(local)
+	if err != nil {
+		return err
+	}
+	original, err := os.ReadFile(local)
+	if err != nil {
+		return err
+	}
+	recordVisit(server.Name, time.Now())
+	if stat == "" {
+		fmt.Printf("%s:%s does not exist yet, it is created on save\n", server.Name, remotePath)
+	}
+
+	target := server.Name + ":" + remotePath
+	for {
+		if err := runEditor(local); err != nil {
+			return err
+		}
+		edited, err := os.ReadFile(local)
+		if err != nil {
+			return err
+		}
+		if bytes.Equal(edited, original) {
+			fmt.Println("No changes, nothing uploaded")
+			return nil
+		}
+
+		printDiff(original, local, target)
+		if editYes || confirm(fmt.Sprintf("Upload to %s?", target)) {
+			break
+		}
+		if !confirm("Edit again?") {
+			return fmt.Errorf("changes discarded")
+		}
+	}
+
+	err = file.install(local, stat, false)
+	if errors.Is(err, errRemoteChanged) {
+		fmt.Printf("%s %v\n", colorize(target, colorYellow), err)
+		if confirm("Overwrite it anyway?") {
+			err = file.install(local, stat, true)
+		}
+	}
+	if err != nil {
+		keep = true
+		fmt.Printf("Your version is kept in %s\n", local)
+		return err
+	}
+	fmt.Printf("Saved %s\n", target)
+	return nil
+}
+
+// fetch downloads the file to local and returns its stat line, or "" if
+// it doesn't exist.
+func (f *remoteFile) fetch(local string) (string, error) {
+	if err := f.run(fmt.Sprintf(fetchScript, f.sudo, panes.ShellJoin([]string{statScript})), f.path, f.tmp); err != nil {
+		return "", fmt.Errorf("error reading %s: %v", f.path, err)
+	}
+	err := f.client.Sftp(
+		"get "+ssh.SftpQuote(f.tmp)+" "+ssh.SftpQuote(local),
+		"get "+ssh.SftpQuote(f.tmp+".stat")+" "+ssh.SftpQuote(local+".stat"),
+		"rm "+ssh.SftpQuote(f.tmp),
+		"rm "+ssh.SftpQuote(f.tmp+".stat"))
+	if err != nil {
+		return "", fmt.Errorf("error downloading %s: %v", f.path, err)
+	}
+
+	stat, err := os.ReadFile(local + ".stat")
+	if err != nil {
+		return "", err
+	}
+	os.Remove(local + ".stat")
+	return strings.TrimSpace(string(stat)), nil
+}
+
+// install uploads local and puts it in place of the file, provided the
+// file still has the stat line it was fetched with, or force is set.
+func (f *remoteFile) install(local, stat string, force bool) error {
+	if err := f.client.Sftp("put " + ssh.SftpQuote(local) + " " + ssh.SftpQuote(f.tmp)); err != nil {
+		return fmt.Errorf("error uploading %s: %v", f.path, err)
+	}
+
+	// A new file gets the usual mode; an existing one keeps its own, and
+	// its owner when sudo can set it
+	mode, owner := "644", ""
+	if fields := strings.Fields(stat); len(fields) == 4 {
+		mode = fields[2]
+		if f.sudo != "" {
+			owner = fields[3]
+		}
+	}
+	backup := ""
+	if editBackup {
+		backup = f.path + "." + time.Now().Format("20060102-150405") + ".bak"
+	}
+	forced := ""
+	if force {
+		forced = "force"
+	}
+
+	err := f.run(fmt.Sprintf(installScript, f.sudo, panes.ShellJoin([]string{statScript})),
+		f.tmp, f.path, stat, backup, forced, mode, owner)
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == remoteChangedCode {
+		return errRemoteChanged
+	}
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", f.path, err)
+	}
+	if backup != "" {
+		fmt.Printf("Backed up the previous version to %s\n", backup)
+	}
+	return nil
+}
+
+// run runs script with sh on the server. With sudo it gets the terminal,
+// so sudo can ask for a password.
+func (f *remoteFile) run(script string, args ...string) error {
+	sshArgs, err := f.client.Options()
+	if err != nil {
+		return err
+	}
+	if f.sudo != "" {
+		sshArgs = append(sshArgs, "-t")
+	}
+	remote := panes.ShellJoin(append([]string{"sh", "-c", script, "sh"}, args...))
+	sshArgs = append(sshArgs, f.client.Destination(), remote)
+
+	cmd := exec.Command("ssh", sshArgs...)
+	// Otherwise ssh would pass on, and use up, what is typed meanwhile
+	if f.sudo != "" {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// printDiff shows how the edited file differs from the original, with
+// diff -u if it is installed.
+func printDiff(original []byte, edited, target string) {
+	orig, err := os.CreateTemp("", "ssh-tool-orig-")
+	if err == nil {
+		defer os.Remove(orig.Name())
+		_, err = orig.Write(original)
+		orig.Close()
+	}
+	var out []byte
+	if err == nil {
+		out, err = exec.Command("diff", "-u", "--label", target, "--label", "edited", orig.Name(), edited).Output()
+	}
+	// diff exits with 1 when the files differ
+	var exit *exec.ExitError
+	if err != nil && !(errors.As(err, &exit) && exit.ExitCode() == 1) {
+		fmt.Printf("File changed (no diff available: %v)\n", err)
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			line = colorize(line, colorBold)
+		case strings.HasPrefix(line, "+"):
+			line = colorize(line, colorGreen)
+		case strings.HasPrefix(line, "-"):
+			line = colorize(line, colorRed)
+		case strings.HasPrefix(line, "@@"):
+			line = colorize(line, colorCyan)
+		}
+		fmt.Println(line)
+	}
+}
+
+func init() {
+	editCmd.Flags().BoolVar(&editSudo, "sudo", false, "read and write the file with sudo")
+	editCmd.Flags().BoolVar(&editBackup, "backup", false, "keep the previous version as <path>.<timestamp>.bak")
+	editCmd.Flags().BoolVarP(&editYes, "yes", "y", false, "upload without asking once the diff is shown")
+	addSelectorFlags(editCmd, &editSelector)
+	editCmd.ValidArgsFunction = completeCopyArgs
+	rootCmd.AddCommand(editCmd)
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ssh-tool/internal/panes"
+)
+
+// runEditScript runs one of the edit scripts, without sudo, as the server
+// would.
+func runEditScript(t *testing.T, script string, args ...string) (string, error) {
+	t.Helper()
+	script = fmt.Sprintf(script, "", panes.ShellJoin([]string{statScript}))
+	out, err := exec.Command("sh", append([]string{"-c", script, "sh"}, args...)...).Output()
+	return string(out), err
+}
+
+func statLine(t *testing.T, path string) string {
+	t.Helper()
+	out, err := exec.Command("sh", "-c", statScript, "sh", path).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func writeEditFile(t *testing.T, path, data string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), mode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readEditFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStatScript(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "nginx.conf")
+	writeEditFile(t, file, "worker_processes 4;\n", 0o640)
+	link := filepath.Join(dir, "link.conf")
+	if err := os.Symlink(file, link); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := strings.Fields(statLine(t, file))
+	if len(fields) != 4 {
+		t.Fatalf("stat line %q, want mtime size mode owner:group", fields)
+	}
+	if fields[1] != "20" || fields[2] != "640" || !strings.Contains(fields[3], ":") {
+		t.Errorf("stat line %q, want size 20, mode 640 and an owner", fields)
+	}
+	// A link reports the file it points to
+	if got, want := statLine(t, link), statLine(t, file); got != want {
+		t.Errorf("stat of the link = %q, want %q", got, want)
+	}
+}
+
+func TestFetchScript(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.env")
+	writeEditFile(t, file, "PORT=8080\n", 0o600)
+	tmp := filepath.Join(dir, "ssh-tool-edit-1")
+
+	if _, err := runEditScript(t, fetchScript, file, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if got := readEditFile(t, tmp); got != "PORT=8080\n" {
+		t.Errorf("fetched %q, want the file's content", got)
+	}
+	if got, want := strings.TrimSpace(readEditFile(t, tmp+".stat")), statLine(t, file); got != want {
+		t.Errorf("fetched stat %q, want %q", got, want)
+	}
+	if info, err := os.Stat(tmp); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("temporary copy is %v, %v, want it readable by the user only", info.Mode(), err)
+	}
+
+	// A new file fetches as empty, with no stat line
+	if _, err := runEditScript(t, fetchScript, filepath.Join(dir, "missing.env"), tmp); err != nil {
+		t.Fatal(err)
+	}
+	if got, stat := readEditFile(t, tmp), readEditFile(t, tmp+".stat"); got != "" || stat != "" {
+		t.Errorf("fetching a missing file gave %q with stat %q, want both empty", got, stat)
+	}
+}
+
+func TestInstallScript(t *testing.T) {
+	tests := []struct {
+		name string
+		// changed modifies the file after it was fetched
+		changed bool
+		force   bool
+		backup  bool
+		link    bool
+		missing bool
+		want    string
+		wantErr int
+	}{
+		{name: "unchanged", want: "new"},
+		{name: "backup", backup: true, want: "new"},
+		{name: "symlink", link: true, want: "new"},
+		{name: "new file", missing: true, want: "new"},
+		{name: "changed meanwhile", changed: true, wantErr: remoteChangedCode},
+		{name: "forced", changed: true, force: true, want: "new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := filepath.Join(dir, "app.conf")
+			// As install does, a new file gets the usual mode
+			stat, mode := "", "644"
+			if !tt.missing {
+				writeEditFile(t, file, "old", 0o640)
+				stat = statLine(t, file)
+				mode = strings.Fields(stat)[2]
+			}
+			path := file
+			if tt.link {
+				path = filepath.Join(dir, "current.conf")
+				if err := os.Symlink(file, path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.changed {
+				writeEditFile(t, file, "someone else's", 0o640)
+			}
+			upload := filepath.Join(dir, "upload")
+			writeEditFile(t, upload, "new", 0o600)
+			backup, forced := "", ""
+			if tt.backup {
+				backup = file + ".bak"
+			}
+			if tt.force {
+				forced = "force"
+			}
+
+			_, err := runEditScript(t, installScript, upload, path, stat, backup, forced, mode, "")
+			if _, statErr := os.Stat(upload); !os.IsNotExist(statErr) {
+				t.Errorf("the upload was left behind: %v", statErr)
+			}
+			if tt.wantErr != 0 {
+				var exit *exec.ExitError
+				if !errors.As(err, &exit) || exit.ExitCode() != tt.wantErr {
+					t.Fatalf("install = %v, want exit code %d", err, tt.wantErr)
+				}
+				if got := readEditFile(t, file); got != "someone else's" {
+					t.Errorf("file is %q, want it left alone", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := readEditFile(t, file); got != tt.want {
+				t.Errorf("file is %q, want %q", got, tt.want)
+			}
+			info, err := os.Stat(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantMode := os.FileMode(0o640)
+			if tt.missing {
+				wantMode = 0o644
+			}
+			if info.Mode().Perm() != wantMode {
+				t.Errorf("mode %v, want %v", info.Mode().Perm(), wantMode)
+			}
+			if tt.link {
+				if target, err := os.Readlink(path); err != nil || target != file {
+					t.Errorf("link points to %q, %v, want it kept pointing to %s", target, err, file)
+				}
+			}
+			if tt.backup {
+				if got := readEditFile(t, backup); got != "old" {
+					t.Errorf("backup is %q, want the previous version", got)
+				}
+			}
+			if matches, _ := filepath.Glob(filepath.Join(dir, "*.ssh-tool-*")); len(matches) > 0 {
+				t.Errorf("staging files left behind: %q", matches)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"ssh-tool/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	execSelector config.Selector
+	execRecord   bool
+
+	execCmd = &cobra.Command{
+		Use:   "exec <server> -- <command> [args...]",
+		Short: "Run a command on a server",
+		Long: `Run a command on a server and exit with its exit code. The server is
+chosen as for 'ssh-tool connect'.`,
+		Example: `  ssh-tool exec prod-api -- uptime
+  ssh-tool exec -g payments db -- sudo systemctl status postgresql`,
+		Args: cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			server, err := selectServer(cfg, execSelector, args[0])
+			if err != nil {
+				return err
+			}
+
+			opts := sessionOptions{command: "exec", remote: args[1:], record: execRecord, hooks: cfg.HooksFor(server)}
+			code, err := runSession(server, opts)
+			if code > 0 {
+				os.Exit(code)
+			}
+			if err != nil {
+				return fmt.Errorf("error running command on %s: %v", server.Name, err)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	execCmd.Flags().BoolVar(&execRecord, "record", false, "record the output as an asciinema cast file")
+	addSelectorFlags(execCmd, &execSelector)
+	rootCmd.AddCommand(execCmd)
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/secrets"
+	"ssh-tool/internal/ssh"
+	"ssh-tool/internal/sshconfig"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportOutput   string
+	exportSelector config.Selector
+
+	exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export servers for use by other tools",
+	}
+
+	exportSSHConfigCmd = &cobra.Command{
+		Use:   "ssh-config",
+		Short: "Print servers as OpenSSH Host blocks",
+		Long: `Generate an OpenSSH client config snippet for the configured servers.
+The output can be written to a file and pulled into ~/.ssh/config with
+an Include directive, e.g.
+
+  ssh-tool export ssh-config -o ~/.ssh/ssh-tool.conf
+  echo 'Include ssh-tool.conf' >> ~/.ssh/config`,
+		Args: cobra.NoArgs,
+		RunE: runExportSSHConfig,
+	}
+)
+
+func runExportSSHConfig(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	servers := cfg.Select(exportSelector)
+	hosts := make([]sshconfig.Host, 0, len(servers))
+	comments := make(map[string]string)
+	for _, server := range servers {
+		identityFile := server.PemFile
+		if secrets.IsReference(identityFile) {
+			// ssh can't read these itself, connect through ssh-tool instead
+			fmt.Fprintf(os.Stderr, "Warning: %s: key %s not exported\n", server.Name, identityFile)
+			identityFile = ""
+		}
+		proxyCommand := ""
+		if server.Transport == config.TransportSSM {
+			proxyCommand = ssh.SSMProxyCommand(server)
+		}
+		hosts = append(hosts, sshconfig.Host{
+			Alias:        server.Name,
+			HostName:     server.Hostname,
+			User:         server.User,
+			IdentityFile: identityFile,
+			ProxyJump:    server.ProxyJump,
+			ProxyCommand: proxyCommand,
+			Port:         server.Port,
+
+			IdentityAgent: server.IdentityAgent,
+			RemoteCommand: server.RemoteCommand,
+			SetEnv:        server.Env,
+			Options:       server.Options,
+		})
+		comments[server.Name] = server.Description
+	}
+
+	var out io.Writer = os.Stdout
+	if exportOutput != "" && exportOutput != "-" {
+		f, err := os.OpenFile(exportOutput, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	fmt.Fprintf(out, "# Generated by ssh-tool on %s, do not edit by hand.\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(out, "# Regenerate with: ssh-tool export ssh-config\n\n")
+	if err := sshconfig.Write(out, hosts, comments); err != nil {
+		return err
+	}
+
+	if out != os.Stdout {
+		fmt.Printf("Exported %d servers to %s\n", len(hosts), exportOutput)
+	}
+	return nil
+}
+
+func init() {
+	exportSSHConfigCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "write to this file instead of stdout")
+	addSelectorFlags(exportSSHConfigCmd, &exportSelector)
+
+	exportCmd.AddCommand(exportSSHConfigCmd)
+	rootCmd.AddCommand(exportCmd)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"ssh-tool/internal/state"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	favCmd = &cobra.Command{
+		Use:     "fav",
+		Aliases: []string{"favorite", "favourite"},
+		Short:   "Pin servers to the top of list and the picker",
+	}
+
+	favAddCmd = &cobra.Command{
+		Use:   "add <server>...",
+		Short: "Pin servers as favourites",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateFavorites(args, true)
+		},
+	}
+
+	favRemoveCmd = &cobra.Command{
+		Use:     "remove <server>...",
+		Aliases: []string{"rm"},
+		Short:   "Unpin favourite servers",
+		Args:    cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return updateFavorites(args, false)
+		},
+	}
+
+	favListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List favourite servers",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			st := loadState()
+			if len(st.Favorites) == 0 {
+				fmt.Println("No favourites yet, add one with 'ssh-tool fav add <server>'")
+				return nil
+			}
+			for _, name := range st.Favorites {
+				fmt.Println(colorize(name, colorGreen))
+			}
+			return nil
+		},
+	}
+)
+
+func updateFavorites(queries []string, add bool) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	return state.Update(func(st *state.State) error {
+		for _, query := range queries {
+			// Favourites of servers since removed from the config can
+			// still be unpinned by their exact name
+			name := query
+			if add || !st.IsFavorite(query) {
+				server, err := cfg.FindServer(query)
+				if err != nil {
+					return err
+				}
+				name = server.Name
+			}
+
+			switch {
+			case add && st.AddFavorite(name):
+				fmt.Printf("Pinned %s\n", name)
+			case add:
+				fmt.Printf("%s is already a favourite\n", name)
+			case st.RemoveFavorite(name):
+				fmt.Printf("Unpinned %s\n", name)
+			default:
+				fmt.Printf("%s is not a favourite\n", name)
+			}
+		}
+		return nil
+	})
+}
+
+func init() {
+	favCmd.AddCommand(favAddCmd, favRemoveCmd, favListCmd)
+	rootCmd.AddCommand(favCmd)
+}
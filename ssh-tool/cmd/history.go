@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"ssh-tool/internal/audit"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	historyLimit int
+	historyCmd   = &cobra.Command{
+		Use:   "history [server]",
+		Short: "Show past connect and exec sessions from the audit log",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path, err := audit.DefaultPath()
+			if err != nil {
+				return err
+			}
+
+			entries, err := audit.Read(path)
+			if err != nil {
+				return fmt.Errorf("error reading audit log: %v", err)
+			}
+
+			if len(args) > 0 {
+				var filtered []audit.Entry
+				for _, e := range entries {
+					if e.Server == args[0] {
+						filtered = append(filtered, e)
+					}
+				}
+				entries = filtered
+			}
+
+			if len(entries) == 0 {
+				fmt.Println("No sessions recorded yet")
+				return nil
+			}
+			if historyLimit > 0 && len(entries) > historyLimit {
+				entries = entries[len(entries)-historyLimit:]
+			}
+
+			printHistory(entries)
+			return nil
+		},
+	}
+)
+
+func printHistory(entries []audit.Entry) {
+	fmt.Printf("%-19s  %-9s  %-7s  %-24s  %-10s  %4s  %s\n",
+		"START", "DURATION", "COMMAND", "SERVER", "USER", "EXIT", "DETAILS")
+
+	for _, e := range entries {
+		exit := colorize(fmt.Sprintf("%4d", e.ExitCode), colorGreen)
+		if e.ExitCode != 0 {
+			exit = colorize(fmt.Sprintf("%4d", e.ExitCode), colorMagenta)
+		}
+
+		details := e.Remote
+		if e.Recording != "" {
+			details += " [recorded: " + e.Recording + "]"
+		}
+		if e.Error != "" {
+			details += " " + e.Error
+		}
+
+		fmt.Printf("%s  %-9s  %-7s  %s  %-10s  %s  %s\n",
+			colorize(e.Start.Local().Format("2006-01-02 15:04:05"), colorCyan),
+			e.Duration().Round(time.Second),
+			e.Command,
+			colorize(fmt.Sprintf("%-24s", truncateString(e.Server, 24)), colorGreen),
+			truncateString(e.User, 10),
+			exit,
+			details)
+	}
+}
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "n", 20, "show at most this many recent sessions (0 for all)")
+	rootCmd.AddCommand(historyCmd)
+}
@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/ssh"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	hostkeysSelector config.Selector
+	hostkeysYes      bool
+	hostkeysTimeout  time.Duration
+
+	hostkeysCmd = &cobra.Command{
+		Use:   "hostkeys",
+		Short: "Pin and verify server host keys",
+		Long: `Servers with pinned host keys (host_keys in the config) are only
+connected to if they present one of those keys. ssh never asks whether to
+trust them, and a changed key is refused with the old and new fingerprints.`,
+	}
+
+	hostkeysScanCmd = &cobra.Command{
+		Use:   "scan [server...]",
+		Short: "Fetch host keys and pin them after confirmation",
+		Long: `Fetch the host keys of servers and pin them in the user config.
+
+Keys of servers without pins are shown and pinned once confirmed, or
+straight away with --yes (trust on first use). A server presenting keys
+that don't match its pins is always shown as a diff and asked about.`,
+		Example: `  ssh-tool hostkeys scan web-1
+  ssh-tool hostkeys scan --group production --yes`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servers, err := selectedServers(args, hostkeysSelector)
+			if err != nil {
+				return err
+			}
+
+			pins := make(map[string][]string)
+			failed := 0
+			for _, server := range servers {
+				keys, err := ssh.ScanHostKeys(context.Background(), server, hostkeysTimeout)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", server.Name, err)
+					failed++
+					continue
+				}
+				if updated, ok := reviewHostKeys(server, keys); ok {
+					pins[server.Name] = updated
+				}
+			}
+
+			if len(pins) > 0 {
+				err := updateUserConfig(func(user *config.Config) error {
+					for name, keys := range pins {
+						server := user.Servers[name]
+						server.Name = name
+						server.HostKeys = keys
+						user.Servers[name] = server
+					}
+					return nil
+				})
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Pinned host keys of %d server(s)\n", len(pins))
+			}
+
+			if failed > 0 {
+				return fmt.Errorf("%d of %d servers could not be scanned", failed, len(servers))
+			}
+			return nil
+		},
+	}
+
+	hostkeysCheckCmd = &cobra.Command{
+		Use:   "check [server...]",
+		Short: "Check that servers still present their pinned host keys",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servers, err := selectedServers(args, hostkeysSelector)
+			if err != nil {
+				return err
+			}
+
+			checked, problems := 0, 0
+			for _, server := range servers {
+				if len(server.HostKeys) == 0 {
+					continue
+				}
+				checked++
+				if _, err := ssh.CheckHostKeys(context.Background(), server); err != nil {
+					fmt.Println(colorize(err.Error(), colorMagenta))
+					problems++
+					continue
+				}
+				fmt.Printf("%s: %s\n", server.Name, colorize("ok", colorGreen))
+			}
+
+			if checked == 0 {
+				fmt.Println("No pinned host keys, add them with 'ssh-tool hostkeys scan'")
+			}
+			if problems > 0 {
+				return fmt.Errorf("%d of %d servers failed the host key check", problems, checked)
+			}
+			return nil
+		},
+	}
+)
+
+// reviewHostKeys shows what a scan found against the current pins and
+// returns the new pins if the user accepts them.
+func reviewHostKeys(server config.Server, keys []ssh.HostKey) ([]string, bool) {
+	matched := ssh.MatchHostKeys(keys, server.HostKeys)
+	if len(server.HostKeys) > 0 && len(matched) == len(keys) {
+		fmt.Printf("%s: %s\n", server.Name, colorize("host keys match", colorGreen))
+		return nil, false
+	}
+
+	var newPins []string
+	for _, key := range keys {
+		newPins = append(newPins, key.Pin())
+	}
+
+	switch {
+	case len(server.HostKeys) == 0:
+		fmt.Printf("%s (%s) presents:\n", colorize(server.Name, colorGreen), server.Hostname)
+		for _, key := range keys {
+			fmt.Printf("  %s\n", key.Pin())
+		}
+		if hostkeysYes {
+			return newPins, true
+		}
+
+	case len(matched) == 0:
+		mismatch := &ssh.HostKeyMismatchError{Server: server, Expected: server.HostKeys, Presented: keys}
+		fmt.Print(colorize(mismatch.Diff(), colorMagenta))
+		// Changed keys are never replaced without asking, not even with --yes
+
+	default:
+		fmt.Printf("%s (%s) presents keys that are not pinned yet:\n", colorize(server.Name, colorGreen), server.Hostname)
+		for _, key := range keys {
+			if len(ssh.MatchHostKeys([]ssh.HostKey{key}, server.HostKeys)) == 0 {
+				fmt.Printf("  + %s\n", key.Pin())
+			}
+		}
+		if hostkeysYes {
+			return newPins, true
+		}
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s: not pinned, confirmation needs a terminal\n", server.Name)
+		return nil, false
+	}
+	if !confirm(fmt.Sprintf("Pin these keys for %s?", server.Name)) {
+		return nil, false
+	}
+	return newPins, true
+}
+
+// explainHostKeyFailure tells the user why ssh refused a server with pinned
+// keys, as ssh itself only says the verification failed.
+func explainHostKeyFailure(server config.Server) {
+	_, err := ssh.CheckHostKeys(context.Background(), server)
+	var mismatch *ssh.HostKeyMismatchError
+	if errors.As(err, &mismatch) {
+		fmt.Fprintln(os.Stderr, mismatch.Error())
+	}
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{hostkeysScanCmd, hostkeysCheckCmd} {
+		addSelectorFlags(cmd, &hostkeysSelector)
+	}
+	hostkeysScanCmd.Flags().BoolVarP(&hostkeysYes, "yes", "y", false, "pin keys of servers without pins without asking")
+	hostkeysScanCmd.Flags().DurationVar(&hostkeysTimeout, "timeout", 5*time.Second, "timeout per server")
+
+	hostkeysCmd.AddCommand(hostkeysScanCmd, hostkeysCheckCmd)
+	rootCmd.AddCommand(hostkeysCmd)
+}
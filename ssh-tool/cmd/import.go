@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/sshconfig"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	importOverwrite bool
+	importDryRun    bool
+	importGroup     string
+	importTags      []string
+
+	importCmd = &cobra.Command{
+		Use:   "import",
+		Short: "Import servers from other tools into the user config",
+	}
+
+	importSSHConfigCmd = &cobra.Command{
+		Use:   "ssh-config [path]",
+		Short: "Import Host blocks from an OpenSSH config file",
+		Long: `Import every concrete Host alias from an OpenSSH client config
+(~/.ssh/config by default, '-' for stdin) into the user config. HostName,
+User, IdentityFile, ProxyJump and Port become server fields and any other
+keyword is kept as an ssh option; values from matching wildcard blocks,
+and from files included inside them, apply as they would for ssh.
+Existing servers are skipped unless --overwrite is given, and so are
+aliases that aren't valid server names, such as user@host.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: runImportSSHConfig,
+	}
+)
+
+func runImportSSHConfig(cmd *cobra.Command, args []string) error {
+	var hosts []sshconfig.Host
+	var err error
+	switch {
+	case len(args) > 0 && args[0] == "-":
+		hosts, err = sshconfig.Parse(os.Stdin)
+	case len(args) > 0:
+		hosts, err = sshconfig.ParseFile(args[0])
+	default:
+		var home string
+		if home, err = os.UserHomeDir(); err == nil {
+			hosts, err = sshconfig.ParseFile(filepath.Join(home, ".ssh", "config"))
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error reading ssh config: %v", err)
+	}
+
+	if len(hosts) == 0 {
+		fmt.Println("No hosts found")
+		return nil
+	}
+
+	// ssh falls back to the local user name when User is not set
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+
+	var added, skipped []string
+	invalid := make(map[string]string)
+	err = updateUserConfig(func(cfg *config.Config) error {
+		for _, host := range hosts {
+			if _, exists := cfg.Servers[host.Alias]; exists && !importOverwrite {
+				skipped = append(skipped, host.Alias)
+				continue
+			}
+
+			server := config.Server{
+				Name:      host.Alias,
+				Hostname:  host.HostName,
+				User:      host.User,
+				PemFile:   host.IdentityFile,
+				ProxyJump: host.ProxyJump,
+				Port:      host.Port,
+				Group:     importGroup,
+				Tags:      importTags,
+
+				IdentityAgent: host.IdentityAgent,
+				Env:           host.SetEnv,
+				RemoteCommand: host.RemoteCommand,
+				Options:       host.Options,
+			}
+			if server.User == "" {
+				server.User = localUser
+			}
+			if server.Port == 22 {
+				server.Port = 0
+			}
+			// One alias ssh-tool can't use, such as user@host, must not
+			// stop the others from being imported
+			if issues := config.ValidateServer(server); len(issues) > 0 {
+				var problems []string
+				for _, issue := range issues {
+					problems = append(problems, issue.Message)
+				}
+				invalid[host.Alias] = strings.Join(problems, "; ")
+				continue
+			}
+
+			cfg.Servers[host.Alias] = server
+			added = append(added, host.Alias)
+		}
+
+		if importDryRun {
+			// Run the checks a real import would before saving, so a dry
+			// run fails where it would
+			path, err := config.UserConfigPath()
+			if err != nil {
+				return err
+			}
+			if err := checkUserConfig(cfg, path); err != nil {
+				return err
+			}
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return err
+	}
+
+	verb := "Imported"
+	if importDryRun {
+		verb = "Would import"
+	}
+	for _, name := range added {
+		fmt.Printf("%s %s\n", verb, colorize(name, colorGreen))
+	}
+	for _, name := range skipped {
+		fmt.Printf("Skipped %s (already exists, use --overwrite)\n", colorize(name, colorYellow))
+	}
+	for _, host := range hosts {
+		if problem, ok := invalid[host.Alias]; ok {
+			fmt.Printf("Skipped %s (%s)\n", colorize(host.Alias, colorMagenta), problem)
+		}
+	}
+	return nil
+}
+
+func init() {
+	importSSHConfigCmd.Flags().BoolVar(&importOverwrite, "overwrite", false, "replace servers that already exist in the user config")
+	importSSHConfigCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "show what would be imported without saving")
+	importSSHConfigCmd.Flags().StringVar(&importGroup, "group", "", "group to assign to imported servers")
+	importSSHConfigCmd.Flags().StringSliceVar(&importTags, "tag", nil, "tag to add to imported servers (repeatable)")
+
+	importCmd.AddCommand(importSSHConfigCmd)
+	rootCmd.AddCommand(importCmd)
+}
@@ -0,0 +1,295 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"ssh-tool/internal/audit"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/sysinfo"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// Shares of memory or disk in use from which info highlights them.
+const (
+	usageWarn     = 0.75
+	usageCritical = 0.9
+)
+
+var (
+	infoSelector    config.Selector
+	infoOutput      string
+	infoTimeout     time.Duration
+	infoConcurrency int
+	infoProcesses   int
+
+	infoCmd = &cobra.Command{
+		Use:   "info [server|group]",
+		Short: "Show OS, uptime, load, memory, disks and top processes of servers",
+		Long: `Connect to one server, every server of a group or every server matching
+--tag, --group and --env, and show a snapshot of each: OS and kernel,
+uptime, load, memory, the fullest disk and the busiest process. Servers
+are queried at the same time, with their usual keys, certificates and
+transport, using only standard tools, so nothing needs to be installed on
+them. With --output json every disk and the top processes are included.
+
+Logins run in batch mode: a server that would ask for a password or a key
+passphrase is reported as failing rather than waiting for input.`,
+		Example: `  ssh-tool info payments
+  ssh-tool info --env prod --tag web
+  ssh-tool info prod-api --output json --processes 10`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if infoOutput != "table" && infoOutput != "json" {
+				return fmt.Errorf("unknown output format %q, use table or json", infoOutput)
+			}
+			if infoTimeout < time.Second {
+				return fmt.Errorf("--timeout must be at least 1s")
+			}
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			servers, err := infoServers(cfg, args)
+			if err != nil {
+				return err
+			}
+
+			if infoOutput == "table" && len(servers) > 1 {
+				fmt.Fprintf(os.Stderr, "Querying %d servers...\n", len(servers))
+			}
+			start := time.Now()
+			opts := sysinfo.Options{Timeout: infoTimeout, Concurrency: infoConcurrency, Processes: infoProcesses}
+			infos := sysinfo.Gather(context.Background(), servers, opts)
+			auditInfo(infos, start)
+
+			if infoOutput == "json" {
+				if err := printInfoJSON(infos); err != nil {
+					return err
+				}
+			} else {
+				printInfoTable(infos)
+			}
+
+			failed := 0
+			for _, info := range infos {
+				if info.Error != "" {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d servers could not be queried", failed, len(infos))
+			}
+			return nil
+		},
+	}
+)
+
+// infoServers resolves the argument: a server name, a group, or any query
+// 'connect' accepts, narrowed by the selector flags. Without an argument
+// the selector flags alone pick the servers.
+func infoServers(cfg *config.Config, args []string) ([]config.Server, error) {
+	if len(args) == 0 {
+		if infoSelector.Empty() {
+			return nil, fmt.Errorf("name a server or group, or pick servers with --tag, --group or --env")
+		}
+		servers := cfg.Select(infoSelector)
+		if len(servers) == 0 {
+			return nil, fmt.Errorf("no servers match %s", infoSelector)
+		}
+		return servers, nil
+	}
+
+	query := args[0]
+	if _, ok := cfg.Servers[query]; !ok {
+		group := infoSelector
+		group.Group = query
+		if servers := cfg.Select(group); len(servers) > 0 {
+			return servers, nil
+		}
+	}
+	server, err := selectServer(cfg, infoSelector, query)
+	if err != nil {
+		return nil, err
+	}
+	return []config.Server{server}, nil
+}
+
+func auditInfo(infos []sysinfo.Info, start time.Time) {
+	localUser := ""
+	if u, err := user.Current(); err == nil {
+		localUser = u.Username
+	}
+	end := time.Now()
+	for _, info := range infos {
+		entry := audit.Entry{
+			Command:   "info",
+			Server:    info.Server.Name,
+			Hostname:  info.Server.Hostname,
+			User:      info.Server.User,
+			LocalUser: localUser,
+			Start:     start,
+			End:       end,
+		}
+		if info.Error != "" {
+			entry.ExitCode, entry.Error = 1, info.Error
+		}
+		appendAudit(entry)
+	}
+}
+
+// infoRecord is the JSON form of a snapshot.
+type infoRecord struct {
+	Name     string `json:"name"`
+	Hostname string `json:"hostname"`
+	sysinfo.Info
+}
+
+func printInfoJSON(infos []sysinfo.Info) error {
+	records := make([]infoRecord, len(infos))
+	for i, info := range infos {
+		records[i] = infoRecord{Name: info.Server.Name, Hostname: info.Server.Hostname, Info: info}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// printInfoTable draws one row per server in the style of list. Cells are
+// padded before they are coloured so escape codes don't count as width.
+func printInfoTable(infos []sysinfo.Info) {
+	headers := []string{"SERVER", "OS", "KERNEL", "UPTIME", "LOAD", "MEMORY", "DISK", "TOP PROCESS"}
+	rows := make([][]string, len(infos))
+	colors := make([][]string, len(infos))
+	for i, info := range infos {
+		if info.Error != "" {
+			rows[i] = []string{info.Server.Name, "", "", "", "", "", "", ""}
+			continue
+		}
+		load, loadColor := formatLoad(info)
+		memory, memoryColor := "", ""
+		if used, ok := info.MemUsed(); ok {
+			memory = fmt.Sprintf("%.0f%% of %s", used*100, formatBytes(info.MemTotal))
+			memoryColor = usageColor(used)
+		}
+		disk, diskColor := "", ""
+		if d, ok := info.FullestDisk(); ok {
+			disk = fmt.Sprintf("%.0f%% %s", d.UsedShare()*100, truncateString(d.Mount, 24))
+			diskColor = usageColor(d.UsedShare())
+		}
+		top := ""
+		if len(info.Processes) > 0 {
+			p := info.Processes[0]
+			top = fmt.Sprintf("%s (%.0f%%)", p.Command, p.CPU)
+		}
+		rows[i] = []string{info.Server.Name, truncateString(info.OS, 30), truncateString(info.Kernel, 30),
+			formatUptime(info.Uptime), load, memory, disk, truncateString(top, 30)}
+		colors[i] = []string{colorGreen, "", "", colorCyan, loadColor, memoryColor, diskColor, colorBlue}
+	}
+
+	widths := make([]int, len(headers))
+	for i, header := range headers {
+		widths[i] = utf8.RuneCountInString(header)
+		for j, row := range rows {
+			// An error is written across the row instead of the cells
+			if infos[j].Error == "" || i == 0 {
+				widths[i] = max(widths[i], utf8.RuneCountInString(row[i]))
+			}
+		}
+	}
+
+	border := "|"
+	for _, width := range widths {
+		border += "-" + strings.Repeat("-", width) + "-|"
+	}
+	fmt.Println(border)
+	fmt.Print("|")
+	for i, header := range headers {
+		fmt.Printf(" %s |", pad(header, widths[i]))
+	}
+	fmt.Println()
+	fmt.Println(border)
+
+	for i, row := range rows {
+		fmt.Printf("| %s |", colorize(pad(row[0], widths[0]), colorGreen))
+		if infos[i].Error != "" {
+			fmt.Printf(" %s\n", colorize(infos[i].Error, colorRed))
+			continue
+		}
+		for j := 1; j < len(row); j++ {
+			cell := pad(row[j], widths[j])
+			if colors[i][j] != "" {
+				cell = colorize(cell, colors[i][j])
+			}
+			fmt.Printf(" %s |", cell)
+		}
+		fmt.Println()
+	}
+	fmt.Println(border)
+}
+
+// formatLoad shows the 1, 5 and 15 minute load, coloured by the 1 minute
+// load per CPU.
+func formatLoad(info sysinfo.Info) (string, string) {
+	if len(info.Load) == 0 {
+		return "", ""
+	}
+	parts := make([]string, len(info.Load))
+	for i, load := range info.Load {
+		parts[i] = fmt.Sprintf("%.2f", load)
+	}
+	color := ""
+	if info.CPUs > 0 {
+		color = usageColor(info.Load[0] / float64(info.CPUs))
+	}
+	return strings.Join(parts, " "), color
+}
+
+func usageColor(share float64) string {
+	switch {
+	case share >= usageCritical:
+		return colorRed
+	case share >= usageWarn:
+		return colorYellow
+	}
+	return ""
+}
+
+func formatUptime(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return ""
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd %dh", int(d.Hours())/24, int(d.Hours())%24)
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n)/unit, "KMGTPE"
+	for value >= unit && len(suffix) > 1 {
+		value, suffix = value/unit, suffix[1:]
+	}
+	return fmt.Sprintf("%.1f%c", value, suffix[0])
+}
+
+func init() {
+	infoCmd.Flags().StringVarP(&infoOutput, "output", "o", "table", "output format: table or json")
+	infoCmd.Flags().DurationVar(&infoTimeout, "timeout", 10*time.Second, "timeout for connecting to each server, at least 1s")
+	infoCmd.Flags().IntVar(&infoConcurrency, "concurrency", 16, "number of servers queried at once")
+	infoCmd.Flags().IntVar(&infoProcesses, "processes", 5, "number of busiest processes to gather")
+	addSelectorFlags(infoCmd, &infoSelector)
+	rootCmd.AddCommand(infoCmd)
+}
@@ -0,0 +1,325 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/secrets"
+	"ssh-tool/internal/ssh"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// keyRef is one configured pem_file and the servers using it.
+type keyRef struct {
+	PemFile string
+	Servers []string
+	Issues  []config.Issue
+}
+
+var (
+	keysSelector config.Selector
+	keysLifetime time.Duration
+
+	keysCmd = &cobra.Command{
+		Use:   "keys",
+		Short: "Inspect configured keys and load them into ssh-agent",
+	}
+
+	keysListCmd = &cobra.Command{
+		Use:   "list [server...]",
+		Short: "Show each configured key with its type, fingerprint and agent status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servers, err := selectedServers(args, keysSelector)
+			if err != nil {
+				return err
+			}
+			keys := configuredKeys(servers)
+			if len(keys) == 0 {
+				fmt.Println("No keys configured")
+				return nil
+			}
+
+			loaded := agentFingerprints()
+			fmt.Printf("%-40s  %-12s  %-50s  %-6s  %-8s  %s\n",
+				"KEY FILE", "TYPE", "FINGERPRINT", "AGENT", "STATUS", "SERVERS")
+			for _, key := range keys {
+				keyType, fingerprint, agent := "", "", ""
+				if secrets.IsReference(key.PemFile) {
+					keyType = "secret"
+				} else if path, err := config.ExpandPath(key.PemFile); err == nil {
+					if info, err := ssh.InspectKey(path); err == nil {
+						keyType = fmt.Sprintf("%s %d", info.Type, info.Bits)
+						fingerprint = info.Fingerprint
+						if loaded[fingerprint] {
+							agent = "loaded"
+						}
+					}
+				}
+
+				status := colorize(fmt.Sprintf("%-8s", "ok"), colorGreen)
+				if len(key.Issues) > 0 {
+					color := colorYellow
+					if config.HasErrors(key.Issues) {
+						color = colorMagenta
+					}
+					status = colorize(fmt.Sprintf("%-8s", key.Issues[0].Severity), color)
+				}
+
+				fmt.Printf("%s  %-12s  %-50s  %-6s  %s  %s\n",
+					colorize(fmt.Sprintf("%-40s", truncateString(key.PemFile, 40)), colorBlue),
+					keyType, fingerprint, agent, status,
+					strings.Join(key.Servers, ", "))
+			}
+
+			var issues []config.Issue
+			for _, key := range keys {
+				issues = append(issues, key.Issues...)
+			}
+			printCertificates(servers)
+			if len(issues) > 0 {
+				fmt.Println()
+				printIssues(issues)
+			}
+			return nil
+		},
+	}
+
+	keysCheckCmd = &cobra.Command{
+		Use:   "check [server...]",
+		Short: "Check that configured keys exist, are valid keys and are only readable by you",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servers, err := selectedServers(args, keysSelector)
+			if err != nil {
+				return err
+			}
+			keys := configuredKeys(servers)
+
+			var issues []config.Issue
+			for _, key := range keys {
+				issues = append(issues, key.Issues...)
+			}
+			printIssues(issues)
+			if config.HasErrors(issues) {
+				return fmt.Errorf("%d key problem(s)", len(issues))
+			}
+			if len(issues) == 0 {
+				fmt.Printf("Keys OK (%d keys)\n", len(keys))
+			}
+			return nil
+		},
+	}
+
+	keysAddCmd = &cobra.Command{
+		Use:   "add [server...]",
+		Short: "Load the keys of servers into the running ssh-agent",
+		Example: `  ssh-tool keys add web-1
+  ssh-tool keys add --group production --lifetime 8h`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 && keysSelector.Empty() {
+				return fmt.Errorf("name servers or select them with --tag, --group or --env")
+			}
+
+			sock, err := ssh.AgentSocket()
+			if err != nil {
+				return err
+			}
+
+			servers, err := selectedServers(args, keysSelector)
+			if err != nil {
+				return err
+			}
+			keys := configuredKeys(servers)
+			if len(keys) == 0 {
+				return fmt.Errorf("the selected servers have no pem_file")
+			}
+
+			loaded := agentFingerprints()
+			failed := 0
+			for _, key := range keys {
+				if err := addKeyToAgent(sock, key.PemFile, loaded); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", key.PemFile, err)
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d keys not loaded", failed, len(keys))
+			}
+			return nil
+		},
+	}
+)
+
+// printCertificates lists the cached certificates of servers that use a CA.
+func printCertificates(servers []config.Server) {
+	header := false
+	for _, server := range servers {
+		if server.CA == nil {
+			continue
+		}
+		if !header {
+			fmt.Printf("\n%-24s  %-20s  %-19s  %s\n", "CERTIFICATE", "PRINCIPALS", "EXPIRES", "STATUS")
+			header = true
+		}
+
+		principals, expires, status := "", "", colorize("not signed yet", colorYellow)
+		if path, err := ssh.CertPath(server.Name); err == nil {
+			if info, err := ssh.InspectCert(path); err == nil {
+				principals = strings.Join(info.Principals, ",")
+				switch {
+				case !info.Expires():
+					expires, status = "never", colorize("valid", colorGreen)
+				case info.Valid(time.Now(), 0):
+					expires = info.ValidBefore.Format("2006-01-02 15:04:05")
+					status = colorize("valid for "+formatRemaining(time.Until(info.ValidBefore)), colorGreen)
+				default:
+					expires = info.ValidBefore.Format("2006-01-02 15:04:05")
+					status = colorize("expired, renewed on connect", colorMagenta)
+				}
+			}
+		}
+		fmt.Printf("%s  %-20s  %-19s  %s\n",
+			colorize(fmt.Sprintf("%-24s", truncateString(server.Name, 24)), colorGreen),
+			truncateString(principals, 20), expires, status)
+	}
+}
+
+func formatRemaining(d time.Duration) string {
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+func addKeyToAgent(sock, pemFile string, loaded map[string]bool) error {
+	if secrets.IsReference(pemFile) {
+		key, err := secrets.Fetch(context.Background(), pemFile)
+		if err != nil {
+			return err
+		}
+		if err := ssh.AddKey(sock, key, keysLifetime); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s\n", pemFile)
+		return nil
+	}
+
+	path, err := config.ExpandPath(pemFile)
+	if err != nil {
+		return err
+	}
+	info, err := ssh.InspectKey(path)
+	if err != nil {
+		return err
+	}
+	if loaded[info.Fingerprint] {
+		fmt.Printf("%s is already loaded\n", pemFile)
+		return nil
+	}
+	if err := ssh.AddKeyFile(sock, path, keysLifetime); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s (%s)\n", pemFile, info.Fingerprint)
+	return nil
+}
+
+// selectedServers returns the named servers, or all servers matching sel
+// when none are named.
+func selectedServers(queries []string, sel config.Selector) ([]config.Server, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(queries) == 0 {
+		return cfg.Select(sel), nil
+	}
+	var servers []config.Server
+	for _, query := range queries {
+		server, err := cfg.Find(sel, query)
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// configuredKeys collects the distinct pem_files of servers with their
+// problems.
+func configuredKeys(servers []config.Server) []keyRef {
+	byFile := make(map[string]*keyRef)
+	var keys []*keyRef
+	for _, server := range servers {
+		if server.PemFile == "" {
+			continue
+		}
+		key, ok := byFile[server.PemFile]
+		if !ok {
+			key = &keyRef{PemFile: server.PemFile, Issues: checkKey(server)}
+			byFile[server.PemFile] = key
+			keys = append(keys, key)
+		}
+		key.Servers = append(key.Servers, server.Name)
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i].PemFile < keys[j].PemFile })
+	result := make([]keyRef, len(keys))
+	for i, key := range keys {
+		result[i] = *key
+	}
+	return result
+}
+
+// checkKey adds a parse check to the file checks config validate does,
+// reported against the key rather than a single server.
+func checkKey(server config.Server) []config.Issue {
+	issues := config.CheckKeyFile(server)
+	if len(issues) == 0 && !secrets.IsReference(server.PemFile) {
+		if path, err := config.ExpandPath(server.PemFile); err == nil {
+			if _, err := ssh.InspectKey(path); err != nil {
+				issues = append(issues, config.Issue{
+					Severity: config.SeverityError,
+					Message:  fmt.Sprintf("key file %s is not a valid key: %v", server.PemFile, err),
+				})
+			}
+		}
+	}
+	for i := range issues {
+		issues[i].Server = ""
+	}
+	return issues
+}
+
+// agentFingerprints returns the fingerprints of the keys in the running
+// agent, or nothing if there is no agent.
+func agentFingerprints() map[string]bool {
+	loaded := make(map[string]bool)
+	sock, err := ssh.AgentSocket()
+	if err != nil {
+		return loaded
+	}
+	keys, err := ssh.AgentKeys(sock)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		return loaded
+	}
+	for _, key := range keys {
+		loaded[key.Fingerprint] = true
+	}
+	return loaded
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{keysListCmd, keysCheckCmd, keysAddCmd} {
+		addSelectorFlags(cmd, &keysSelector)
+	}
+	keysAddCmd.Flags().DurationVar(&keysLifetime, "lifetime", 0, "remove the keys from the agent after this long")
+
+	keysCmd.AddCommand(keysListCmd, keysCheckCmd, keysAddCmd)
+	rootCmd.AddCommand(keysCmd)
+}
@@ -2,30 +2,37 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"ssh-tool/internal/ansi"
 	"ssh-tool/internal/config"
+	"ssh-tool/internal/health"
+	"ssh-tool/internal/secrets"
 	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 )
 
-const (
-	colorReset   = "\033[0m"
-	colorBlue    = "\033[34m"
-	colorCyan    = "\033[36m"
-	colorGreen   = "\033[32m"
-	colorMagenta = "\033[35m"
-	colorYellow  = "\033[33m"
-	colorBold    = "\033[1m"
-)
+// favoriteMark prefixes pinned servers in list and the picker.
+const favoriteMark = "* "
+
+// maxDetailWidth caps the banner/error column of --check output.
+const maxDetailWidth = 40
 
 type columnConfig struct {
 	name      string
-	width     int
+	color     string
 	formatter func(string) string
 }
 
 func formatKeyPath(path string) string {
+	if secrets.IsReference(path) {
+		return path
+	}
 	parts := strings.Split(path, "/")
 	if len(parts) > 0 {
 		return parts[len(parts)-1]
@@ -34,130 +41,257 @@ func formatKeyPath(path string) string {
 }
 
 func truncateString(str string, length int) string {
-	if length <= 3 || len(str) <= length {
-		return str
-	}
-	return str[:length-3] + "..."
-}
-
-func colorize(text, color string) string {
-	return color + text + colorReset
+	return ansi.Truncate(str, length)
 }
 
 var (
-	showAll bool
-	listCmd = &cobra.Command{
+	showAll      bool
+	checkHealth  bool
+	checkAuth    bool
+	checkTimeout time.Duration
+	listOutput   string
+	listFormat   string
+	listSelector config.Selector
+	listCmd      = &cobra.Command{
 		Use:   "list",
 		Short: "List all available servers",
-		Run:   runList,
+		Long: `List the configured servers as a table, or for scripts as JSON, YAML,
+CSV or TSV with --output, or through a Go template with --format.
+
+Template fields: .ID .Name .Hostname .User .PemFile .Port .Description
+.Group .Environment .Tags .Favorite .Stale and, with --check, .Status
+.Latency .Banner .Error. The join function joins a list, e.g.
+{{join .Tags ","}}.`,
+		Example: `  ssh-tool list -a
+  ssh-tool list --tag prod --output json
+  ssh-tool list --format '{{.Name}} {{.Hostname}}'`,
+		RunE: runList,
 	}
 )
 
-func runList(cmd *cobra.Command, args []string) {
-	cfg, err := config.LoadConfig(configFile)
+func runList(cmd *cobra.Command, args []string) error {
+	if listOutput != "" && listOutput != "table" && listFormat != "" {
+		return fmt.Errorf("--output and --format can't be combined")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+
+	servers := cfg.Select(listSelector)
+	st := loadState()
+	st.SortFavoritesFirst(servers)
+
+	// IDs always come from the unfiltered list so they work with
+	// 'connect <id>' whatever filters are applied
+	ids := make(map[string]int)
+	for i, server := range cfg.GetServersList() {
+		ids[server.Name] = i + 1
+	}
+
+	var results map[string]health.Result
+	if checkHealth || checkAuth {
+		fmt.Fprintf(os.Stderr, "Checking %d servers...\n", len(servers))
+		results = make(map[string]health.Result)
+		opts := health.Options{Timeout: checkTimeout, Auth: checkAuth}
+		for _, result := range health.Check(context.Background(), servers, opts) {
+			results[result.Server.Name] = result
+		}
+	}
+
+	records := make([]serverRecord, 0, len(servers))
+	for _, server := range servers {
+		records = append(records, newServerRecord(server, ids[server.Name], st.IsFavorite(server.Name), results))
+	}
+
+	if listFormat != "" {
+		return printTemplate(records, listFormat)
+	}
+
+	switch listOutput {
+	case "", "table":
+		printTable(records, config.Groups(servers), listSelector, results != nil)
+		return nil
+	default:
+		return writeRecords(os.Stdout, records, listOutput)
+	}
+}
+
+func printTemplate(records []serverRecord, format string) error {
+	tmpl, err := template.New("format").Funcs(template.FuncMap{
+		"join": strings.Join,
+	}).Parse(format)
 	if err != nil {
-		fmt.Printf("Error loading config: %v\n", err)
-		return
+		return fmt.Errorf("invalid --format template: %v", err)
 	}
 
-	var columns []columnConfig
+	for _, r := range records {
+		if err := tmpl.Execute(os.Stdout, r); err != nil {
+			return err
+		}
+		fmt.Println()
+	}
+	return nil
+}
 
+// printTable draws the human-readable table, sectioned by group when
+// groups are in use. Column widths fit the widest value.
+func printTable(records []serverRecord, groups []string, sel config.Selector, checked bool) {
+	columns := []columnConfig{
+		{name: "ID", color: colorCyan},
+		{name: "SERVER NAME", color: colorGreen},
+		{name: "IP", color: colorMagenta},
+	}
 	if showAll {
 		// Detailed view columns
-		columns = []columnConfig{
-			{name: "ID", width: 4,
-				formatter: func(s string) string { return colorize(s, colorCyan) }},
-			{name: "SERVER NAME", width: 24,
-				formatter: func(s string) string { return colorize(s, colorGreen) }},
-			{name: "IP", width: 14,
-				formatter: func(s string) string { return colorize(s, colorMagenta) }},
-			{name: "USER", width: 6,
-				formatter: func(s string) string { return colorize(s, colorYellow) }},
-			{name: "KEY FILE", width: 24,
-				formatter: func(s string) string { return colorize(s, colorBlue) }},
+		columns = append(columns,
+			columnConfig{name: "USER", color: colorYellow},
+			columnConfig{name: "KEY FILE", color: colorBlue},
+			columnConfig{name: "PORT", color: colorCyan},
+			columnConfig{name: "ENV", color: colorYellow},
+			columnConfig{name: "TAGS", color: colorBlue})
+	}
+	if checked {
+		columns = append(columns,
+			columnConfig{name: "STATUS", formatter: colorizeStatus},
+			columnConfig{name: "LATENCY", color: colorCyan},
+			columnConfig{name: "BANNER", color: colorBlue})
+	}
+
+	rows := make([][]string, len(records))
+	for i, r := range records {
+		name := r.Name
+		if r.Favorite {
+			name = favoriteMark + name
 		}
-	} else {
-		// Default minimal view columns
-		columns = []columnConfig{
-			{name: "ID", width: 4,
-				formatter: func(s string) string { return colorize(s, colorCyan) }},
-			{name: "SERVER NAME", width: 24,
-				formatter: func(s string) string { return colorize(s, colorGreen) }},
-			{name: "IP", width: 14,
-				formatter: func(s string) string { return colorize(s, colorMagenta) }},
+		if r.Stale {
+			name += " (stale)"
+		}
+
+		row := []string{fmt.Sprintf("%d", r.ID), name, r.Hostname}
+		if showAll {
+			port := ""
+			if r.Port != 0 {
+				port = fmt.Sprintf("%d", r.Port)
+			}
+			row = append(row, r.User, formatKeyPath(r.PemFile), port, r.Environment, strings.Join(r.Tags, ","))
+		}
+		if checked {
+			detail := r.Banner
+			if r.Error != "" {
+				detail = r.Error
+			}
+			row = append(row, r.Status, r.Latency, truncateString(detail, maxDetailWidth))
+		}
+		rows[i] = row
+	}
+
+	widths := make([]int, len(columns))
+	for i, col := range columns {
+		widths[i] = utf8.RuneCountInString(col.name)
+		for _, row := range rows {
+			if n := utf8.RuneCountInString(row[i]); n > widths[i] {
+				widths[i] = n
+			}
 		}
 	}
 
 	fmt.Printf("\nAvailable Servers:\n")
-	printBorder(columns)
+	printBorder(widths)
 
 	// Print header row
 	fmt.Printf("|")
-	for _, col := range columns {
-		fmt.Printf(" %-*s |", col.width, col.name)
+	for i, col := range columns {
+		fmt.Printf(" %s |", pad(col.name, widths[i]))
 	}
 	fmt.Printf(" %s\n", "CUSTOMERS")
 
-	printBorder(columns)
-
-	// Print data rows
-	servers := cfg.GetServersList()
-	for i, server := range servers {
-		fmt.Printf("|")
-
-		// Print each column based on view type
-		if showAll {
-			fmt.Printf(" %-*s |", columns[0].width,
-				columns[0].formatter(fmt.Sprintf("%d", i+1)))
-
-			fmt.Printf(" %-*s |", columns[1].width,
-				columns[1].formatter(truncateString(server.Name, columns[1].width)))
+	printBorder(widths)
 
-			fmt.Printf(" %-*s |", columns[2].width,
-				columns[2].formatter(server.Hostname))
-
-			fmt.Printf(" %-*s |", columns[3].width,
-				columns[3].formatter(server.User))
+	for _, group := range groups {
+		if len(groups) > 1 || group != "" {
+			printGroupHeader(group)
+		}
 
-			fmt.Printf(" %-*s |", columns[4].width,
-				columns[4].formatter(truncateString(formatKeyPath(server.PemFile), columns[4].width)))
-		} else {
-			fmt.Printf(" %-*s |", columns[0].width,
-				columns[0].formatter(fmt.Sprintf("%d", i+1)))
+		for i, r := range records {
+			if !strings.EqualFold(r.Group, group) {
+				continue
+			}
 
-			fmt.Printf(" %-*s |", columns[1].width,
-				columns[1].formatter(truncateString(server.Name, columns[1].width)))
+			fmt.Printf("|")
+			for j, col := range columns {
+				// Pad before colouring so escape codes don't count as width
+				cell := pad(rows[i][j], widths[j])
+				if col.formatter != nil {
+					cell = col.formatter(cell)
+				} else {
+					cell = colorize(cell, col.color)
+				}
+				fmt.Printf(" %s |", cell)
+			}
 
-			fmt.Printf(" %-*s |", columns[2].width,
-				columns[2].formatter(server.Hostname))
+			// Always show customers
+			fmt.Printf(" %s\n", colorize(r.Description, colorCyan))
 		}
+	}
 
-		// Always show customers
-		fmt.Printf(" %s", colorize(server.Description, colorCyan))
-		fmt.Printf("\n")
+	if len(records) == 0 {
+		fmt.Printf("| no servers match %s\n", sel)
 	}
 
-	printBorder(columns)
+	printBorder(widths)
 
 	// Print usage based on view type
 	if showAll {
-		fmt.Printf("\nUsage: ssh-tool connect <id>\n")
+		fmt.Printf("\nUsage: ssh-tool connect <id|name>\n")
 		fmt.Printf("Use 'ssh-tool list' for minimal view\n\n")
 	} else {
-		fmt.Printf("\nUsage: ssh-tool connect <id>\n")
+		fmt.Printf("\nUsage: ssh-tool connect <id|name>\n")
 		fmt.Printf("Use 'ssh-tool list -a' for detailed view\n\n")
 	}
 }
 
-func printBorder(columns []columnConfig) {
+func pad(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+func colorizeStatus(status string) string {
+	switch health.Status(strings.TrimSpace(status)) {
+	case health.StatusReachable, health.StatusAuthOK:
+		return colorize(status, colorGreen)
+	case health.StatusSkipped, "":
+		return colorize(status, colorYellow)
+	default:
+		return colorize(status, colorMagenta)
+	}
+}
+
+func printGroupHeader(group string) {
+	if group == "" {
+		group = "(no group)"
+	}
+	fmt.Printf("| %s\n", colorize(group, colorBold+colorMagenta))
+}
+
+func printBorder(widths []int) {
 	fmt.Printf("|")
-	for _, col := range columns {
-		fmt.Printf("-%s-|", strings.Repeat("-", col.width))
+	for _, width := range widths {
+		fmt.Printf("-%s-|", strings.Repeat("-", width))
 	}
 	fmt.Printf("---\n")
 }
 
 func init() {
 	listCmd.Flags().BoolVarP(&showAll, "all", "a", false, "Show all fields")
+	listCmd.Flags().BoolVar(&checkHealth, "check", false, "probe each server's SSH port and show status, latency and banner")
+	listCmd.Flags().BoolVar(&checkAuth, "auth", false, "with --check, also test key authentication")
+	listCmd.Flags().DurationVar(&checkTimeout, "timeout", 5*time.Second, "timeout per check")
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", "table", "output format: table, json, yaml, csv or tsv")
+	listCmd.Flags().StringVar(&listFormat, "format", "", "print each server with a Go template")
+	addSelectorFlags(listCmd, &listSelector)
 	rootCmd.AddCommand(listCmd)
 }
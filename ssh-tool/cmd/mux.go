@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/ssh"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	muxSelector config.Selector
+
+	muxCmd = &cobra.Command{
+		Use:   "mux",
+		Short: "Manage shared connections to servers",
+		Long: `connect, exec, cp and tunnel share one authenticated connection per
+server through a control socket. It stays open in the background until it
+has been idle for the server's mux_idle (default 10m, "off" to disable).`,
+	}
+
+	muxStatusCmd = &cobra.Command{
+		Use:   "status [server...]",
+		Short: "Show which servers have a shared connection open",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servers, err := selectedServers(args, muxSelector)
+			if err != nil {
+				return err
+			}
+
+			open := 0
+			for _, server := range servers {
+				socket, err := ssh.MuxSocket(server)
+				if err != nil {
+					return err
+				}
+				if _, err := os.Stat(socket); err != nil {
+					continue
+				}
+
+				state, pid := colorize("running", colorGreen), ""
+				if p, ok := ssh.MuxCheck(socket); ok {
+					pid = strconv.Itoa(p)
+				} else {
+					// Left behind by a master that was killed
+					os.Remove(socket)
+					state = colorize("stale, removed", colorYellow)
+				}
+				idle := "off"
+				if persist, ok := server.MuxPersist(); ok {
+					idle = persist.String()
+				}
+
+				if open == 0 {
+					fmt.Printf("%-24s  %-8s  %-10s  %s\n", "SERVER", "PID", "IDLE", "STATE")
+				}
+				open++
+				fmt.Printf("%s  %-8s  %-10s  %s\n",
+					colorize(fmt.Sprintf("%-24s", truncateString(server.Name, 24)), colorGreen),
+					pid, idle, state)
+			}
+
+			if open == 0 {
+				fmt.Println("No shared connections")
+			}
+			return nil
+		},
+	}
+
+	muxStopCmd = &cobra.Command{
+		Use:   "stop [server...]",
+		Short: "Close shared connections",
+		Long: `Close the shared connections to the given servers, or to all servers.
+Sessions still using a connection are ended with it.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			servers, err := selectedServers(args, muxSelector)
+			if err != nil {
+				return err
+			}
+
+			stopped, failed := 0, 0
+			for _, server := range servers {
+				socket, err := ssh.MuxSocket(server)
+				if err != nil {
+					return err
+				}
+				if _, ok := ssh.MuxCheck(socket); !ok {
+					if len(args) > 0 {
+						fmt.Printf("%s: no shared connection\n", server.Name)
+					}
+					continue
+				}
+				if err := ssh.MuxStop(socket); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", server.Name, err)
+					failed++
+					continue
+				}
+				fmt.Printf("%s: %s\n", server.Name, colorize("closed", colorGreen))
+				stopped++
+			}
+
+			if stopped == 0 && failed == 0 && len(args) == 0 {
+				fmt.Println("No shared connections")
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d connection(s) could not be closed", failed)
+			}
+			return nil
+		},
+	}
+)
+
+func init() {
+	for _, cmd := range []*cobra.Command{muxStatusCmd, muxStopCmd} {
+		addSelectorFlags(cmd, &muxSelector)
+	}
+	muxCmd.AddCommand(muxStatusCmd, muxStopCmd)
+	rootCmd.AddCommand(muxCmd)
+}
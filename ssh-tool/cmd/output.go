@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/health"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serverRecord is the flattened view of a server used for machine-readable
+// output and --format templates.
+type serverRecord struct {
+	ID          int      `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	Hostname    string   `json:"hostname" yaml:"hostname"`
+	User        string   `json:"user" yaml:"user"`
+	PemFile     string   `json:"pem_file,omitempty" yaml:"pem_file,omitempty"`
+	Port        int      `json:"port,omitempty" yaml:"port,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Group       string   `json:"group,omitempty" yaml:"group,omitempty"`
+	Environment string   `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Favorite    bool     `json:"favorite" yaml:"favorite"`
+	Stale       bool     `json:"stale" yaml:"stale"`
+
+	Status  string `json:"status,omitempty" yaml:"status,omitempty"`
+	Latency string `json:"latency,omitempty" yaml:"latency,omitempty"`
+	Banner  string `json:"banner,omitempty" yaml:"banner,omitempty"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+func newServerRecord(server config.Server, id int, favorite bool, results map[string]health.Result) serverRecord {
+	r := serverRecord{
+		ID:          id,
+		Name:        server.Name,
+		Hostname:    server.Hostname,
+		User:        server.User,
+		PemFile:     server.PemFile,
+		Port:        server.Port,
+		Description: server.Description,
+		Group:       server.Group,
+		Environment: server.Environment,
+		Tags:        server.Tags,
+		Favorite:    favorite,
+		Stale:       server.Stale,
+	}
+
+	if result, ok := results[server.Name]; ok {
+		r.Status = string(result.Status)
+		if result.Latency > 0 {
+			r.Latency = fmt.Sprintf("%dms", result.Latency.Milliseconds())
+		}
+		r.Banner = result.Banner
+		r.Error = result.Error
+	}
+	return r
+}
+
+// writeRecords encodes records as json, yaml, csv or tsv.
+func writeRecords(w io.Writer, records []serverRecord, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	case "yaml":
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		defer enc.Close()
+		return enc.Encode(records)
+	case "csv", "tsv":
+		cw := csv.NewWriter(w)
+		if format == "tsv" {
+			cw.Comma = '\t'
+		}
+		cw.Write([]string{"id", "name", "hostname", "user", "pem_file", "port", "description",
+			"group", "environment", "tags", "favorite", "stale", "status", "latency", "banner", "error"})
+		for _, r := range records {
+			port := ""
+			if r.Port != 0 {
+				port = strconv.Itoa(r.Port)
+			}
+			cw.Write([]string{strconv.Itoa(r.ID), r.Name, r.Hostname, r.User, r.PemFile, port, r.Description,
+				r.Group, r.Environment, strings.Join(r.Tags, ","), strconv.FormatBool(r.Favorite),
+				strconv.FormatBool(r.Stale), r.Status, r.Latency, r.Banner, r.Error})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown output format %q, use table, json, yaml, csv or tsv", format)
+	}
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/health"
+)
+
+func testRecords() []serverRecord {
+	results := map[string]health.Result{
+		"prod-api": {Status: health.StatusReachable, Latency: 12 * time.Millisecond, Banner: "SSH-2.0-OpenSSH_9.6"},
+	}
+	return []serverRecord{
+		newServerRecord(config.Server{Name: "prod-api", Hostname: "10.0.1.10", User: "deploy", Port: 2222,
+			Group: "payments", Environment: "prod", Tags: []string{"web", "eu"}, Description: "API, primary"}, 1, true, results),
+		newServerRecord(config.Server{Name: "prod-db", Hostname: "10.0.1.20", User: "deploy", Stale: true}, 2, false, results),
+	}
+}
+
+func TestWriteRecords(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"json", `[
+  {
+    "id": 1,
+    "name": "prod-api",
+    "hostname": "10.0.1.10",
+    "user": "deploy",
+    "port": 2222,
+    "description": "API, primary",
+    "group": "payments",
+    "environment": "prod",
+    "tags": [
+      "web",
+      "eu"
+    ],
+    "favorite": true,
+    "stale": false,
+    "status": "reachable",
+    "latency": "12ms",
+    "banner": "SSH-2.0-OpenSSH_9.6"
+  },
+  {
+    "id": 2,
+    "name": "prod-db",
+    "hostname": "10.0.1.20",
+    "user": "deploy",
+    "favorite": false,
+    "stale": true
+  }
+]
+`},
+		{"yaml", `- id: 1
+  name: prod-api
+  hostname: 10.0.1.10
+  user: deploy
+  port: 2222
+  description: API, primary
+  group: payments
+  environment: prod
+  tags:
+    - web
+    - eu
+  favorite: true
+  stale: false
+  status: reachable
+  latency: 12ms
+  banner: SSH-2.0-OpenSSH_9.6
+- id: 2
+  name: prod-db
+  hostname: 10.0.1.20
+  user: deploy
+  favorite: false
+  stale: true
+`},
+		{"csv", `id,name,hostname,user,pem_file,port,description,group,environment,tags,favorite,stale,status,latency,banner,error
+1,prod-api,10.0.1.10,deploy,,2222,"API, primary",payments,prod,"web,eu",true,false,reachable,12ms,SSH-2.0-OpenSSH_9.6,
+2,prod-db,10.0.1.20,deploy,,,,,,,false,true,,,,
+`},
+		{"tsv", "id\tname\thostname\tuser\tpem_file\tport\tdescription\tgroup\tenvironment\ttags\tfavorite\tstale\tstatus\tlatency\tbanner\terror\n" +
+			"1\tprod-api\t10.0.1.10\tdeploy\t\t2222\tAPI, primary\tpayments\tprod\tweb,eu\ttrue\tfalse\treachable\t12ms\tSSH-2.0-OpenSSH_9.6\t\n" +
+			"2\tprod-db\t10.0.1.20\tdeploy\t\t\t\t\t\t\tfalse\ttrue\t\t\t\t\n"},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		if err := writeRecords(&out, testRecords(), tt.format); err != nil {
+			t.Errorf("%s: %v", tt.format, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s output:\n%s\nwant:\n%s", tt.format, out.String(), tt.want)
+		}
+	}
+
+	var out strings.Builder
+	err := writeRecords(&out, testRecords(), "xml")
+	if err == nil || !strings.Contains(err.Error(), `unknown output format "xml"`) {
+		t.Errorf("error = %v, want unknown output format", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("wrote %q for an unknown format", out.String())
+	}
+}
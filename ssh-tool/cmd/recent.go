@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	recentLimit int
+	recentCmd   = &cobra.Command{
+		Use:   "recent",
+		Short: "Show recently used servers",
+		Long: `Show the servers you connected to most recently, newest first.
+Use 'ssh-tool connect -' to reconnect to the first one.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			st := loadState()
+			if len(st.Recent) == 0 {
+				fmt.Println("No recent connections")
+				return nil
+			}
+
+			visits := st.Recent
+			if recentLimit > 0 && len(visits) > recentLimit {
+				visits = visits[:recentLimit]
+			}
+
+			fmt.Printf("%-3s  %-30s  %-15s  %-16s  %s\n", "#", "SERVER", "IP", "LAST USED", "COUNT")
+			for i, v := range visits {
+				host := colorize(fmt.Sprintf("%-15s", "(removed)"), colorYellow)
+				if server, ok := cfg.Servers[v.Server]; ok {
+					host = colorize(fmt.Sprintf("%-15s", server.Hostname), colorMagenta)
+				}
+				name := v.Server
+				if st.IsFavorite(v.Server) {
+					name = favoriteMark + name
+				}
+				fmt.Printf("%-3d  %s  %s  %-16s  %d\n",
+					i+1,
+					colorize(fmt.Sprintf("%-30s", truncateString(name, 30)), colorGreen),
+					host,
+					formatAge(time.Since(v.Time)),
+					v.Count)
+			}
+			return nil
+		},
+	}
+)
+
+// formatAge renders a duration the way people talk about recency.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d h ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%d days ago", int(d.Hours()/24))
+	}
+}
+
+func init() {
+	recentCmd.Flags().IntVarP(&recentLimit, "limit", "n", 10, "show at most this many servers (0 for all)")
+	rootCmd.AddCommand(recentCmd)
+}
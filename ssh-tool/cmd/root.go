@@ -1,23 +1,54 @@
 package cmd
 
 import (
+	"fmt"
+	"os"
+	"ssh-tool/internal/config"
+
 	"github.com/spf13/cobra"
 )
 
 var (
 	configFile string
+	noColor    bool
 	rootCmd    = &cobra.Command{
 		Use:   "ssh-tool",
 		Short: "A tool for managing SSH connections to servers in local machine with ssh connections",
 		Long: `A CLI tool that helps manage and connect to various servers 
                using embedded configuration with optional external config file support.`,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if noColor {
+				colorEnabled = false
+			}
+		},
 	}
 )
 
+// loadConfig loads the configuration and warns about entries that were
+// skipped because they couldn't be expanded, and about a project config
+// whose hooks were ignored. Commands naming a skipped entry get the reason
+// from Find.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range cfg.SkippedNames() {
+		fmt.Fprintf(os.Stderr, "Warning: %v, skipping it\n", cfg.Skipped[name])
+	}
+	if cfg.Untrusted != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", config.UntrustedMessage(cfg.Untrusted))
+	}
+	return cfg, nil
+}
+
 func Execute() error {
 	return rootCmd.Execute()
 }
 
 func init() {
 	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "optional external config file")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "disable coloured output")
 }
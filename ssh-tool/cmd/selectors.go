@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"ssh-tool/internal/config"
+
+	"github.com/spf13/cobra"
+)
+
+// addSelectorFlags registers the --tag/--group/--env flags shared by every
+// command that picks servers, completing them from the config.
+func addSelectorFlags(cmd *cobra.Command, sel *config.Selector) {
+	cmd.Flags().StringSliceVarP(&sel.Tags, "tag", "t", nil, "only servers with this tag (repeatable)")
+	cmd.Flags().StringVarP(&sel.Group, "group", "g", "", "only servers in this group")
+	cmd.Flags().StringVarP(&sel.Environment, "env", "e", "", "only servers in this environment")
+	cmd.RegisterFlagCompletionFunc("tag", completeTags)
+	cmd.RegisterFlagCompletionFunc("group", completeGroups)
+	cmd.RegisterFlagCompletionFunc("env", completeEnvs)
+}
@@ -0,0 +1,231 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"ssh-tool/internal/audit"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/hooks"
+	"ssh-tool/internal/record"
+	"ssh-tool/internal/ssh"
+	"ssh-tool/internal/state"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// sessionOptions describe one connect, exec, cp or tunnel invocation.
+type sessionOptions struct {
+	command string
+	remote  []string
+	record  bool
+	// hooks run around the session, see config.HooksFor
+	hooks config.Hooks
+	// build returns the process to run, by default ssh running remote
+	build func(client *ssh.Client) (*exec.Cmd, error)
+}
+
+// runSession runs ssh for server on the current terminal and writes an
+// audit record when it ends, or when it fails to start. It returns the exit
+// code of ssh, which is the remote command's exit code unless ssh itself
+// failed.
+func runSession(server config.Server, opts sessionOptions) (code int, err error) {
+	entry := audit.Entry{
+		Command:  opts.command,
+		Server:   server.Name,
+		Hostname: server.Hostname,
+		User:     server.User,
+		Remote:   strings.Join(opts.remote, " "),
+		Start:    time.Now(),
+	}
+	if u, err := user.Current(); err == nil {
+		entry.LocalUser = u.Username
+	}
+
+	// Attempts refused before ssh runs, by a pre_connect hook or a host key
+	// mismatch for example, are audited as well
+	started := false
+	defer func() {
+		if !started && err != nil {
+			auditFailure(entry, err)
+		}
+	}()
+
+	finish, err := startHooks(server, opts.command, opts.hooks)
+	if err != nil {
+		return -1, err
+	}
+	defer func() { finish(code) }()
+
+	client := ssh.NewClient(server)
+	client.TTY = opts.record && len(opts.remote) == 0
+	client.Mux = true
+
+	cleanup, err := client.Prepare(context.Background())
+	if err != nil {
+		return -1, err
+	}
+	defer cleanup()
+
+	build := opts.build
+	if build == nil {
+		build = func(client *ssh.Client) (*exec.Cmd, error) {
+			return client.Command(opts.remote...)
+		}
+	}
+	cmd, err := build(client)
+	if err != nil {
+		return -1, err
+	}
+
+	// Set up the command to use the current terminal
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if opts.record {
+		cast, path, err := startRecording(server)
+		if err != nil {
+			return -1, err
+		}
+		defer cast.Close()
+		cmd.Stdout = io.MultiWriter(os.Stdout, cast)
+		entry.Recording = path
+	}
+
+	// The terminal delivers Ctrl-C to ssh as well; keep running so the
+	// session still gets logged, and pass termination signals on.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	entry.Start = time.Now()
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("error starting %s: %v", filepath.Base(cmd.Path), err)
+	}
+	started = true
+	recordVisit(server.Name, entry.Start)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig != os.Interrupt {
+					cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	entry.End = time.Now()
+	entry.ExitCode = cmd.ProcessState.ExitCode()
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		entry.Error = err.Error()
+	}
+
+	// ssh exits with 255 for its own errors, such as a rejected host key
+	if entry.ExitCode == 255 && len(server.HostKeys) > 0 {
+		explainHostKeyFailure(server)
+	}
+	if entry.ExitCode == 255 && server.Transport == config.TransportSSM {
+		explainSSMFailure(server)
+	}
+
+	appendAudit(entry)
+
+	if entry.Recording != "" {
+		fmt.Fprintf(os.Stderr, "Session recorded to %s\n", entry.Recording)
+	}
+
+	return entry.ExitCode, err
+}
+
+// startHooks runs the pre_connect hooks and returns the function that runs
+// the post_disconnect hooks with the exit code of the session. Those run
+// whenever the pre_connect hooks did, so they can undo what those set up.
+func startHooks(server config.Server, command string, h config.Hooks) (func(code int), error) {
+	env := hooks.Env(server, command)
+	if err := hooks.Run(context.Background(), "pre_connect", h.PreConnect, env); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	return func(code int) {
+		env := hooks.ResultEnv(env, code, time.Since(start))
+		for _, err := range hooks.RunAll(context.Background(), "post_disconnect", h.PostDisconnect, env) {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+	}, nil
+}
+
+// explainSSMFailure asks SSM why a session may have failed, as a failing
+// ProxyCommand only shows up as a closed connection.
+func explainSSMFailure(server config.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := ssh.DiagnoseSSM(ctx, server); err != nil {
+		fmt.Fprintf(os.Stderr, "SSM: %v\n", err)
+	}
+}
+
+// auditFailure records an attempt that failed before its session started.
+func auditFailure(entry audit.Entry, err error) {
+	entry.End = time.Now()
+	entry.ExitCode, entry.Error = -1, err.Error()
+	appendAudit(entry)
+}
+
+func appendAudit(entry audit.Entry) {
+	if path, err := audit.DefaultPath(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: session not audited: %v\n", err)
+	} else if err := audit.Append(path, entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: session not audited: %v\n", err)
+	}
+}
+
+func recordVisit(name string, at time.Time) {
+	err := state.Update(func(st *state.State) error {
+		st.RecordVisit(name, at)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: connection history not updated: %v\n", err)
+	}
+}
+
+func startRecording(server config.Server) (*record.Cast, string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := fmt.Sprintf("%s-%s.cast", server.Name, time.Now().Format("20060102-150405"))
+	path := filepath.Join(dir, "recordings", name)
+
+	width, height, err := term.GetSize(int(os.Stdin.Fd()))
+	if err != nil {
+		width, height = 80, 24
+	}
+
+	cast, err := record.Create(path, fmt.Sprintf("%s@%s", server.User, server.Name), width, height)
+	if err != nil {
+		return nil, "", err
+	}
+	return cast, path, nil
+}
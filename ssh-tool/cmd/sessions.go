@@ -0,0 +1,211 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/panes"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var (
+	sessionSelector config.Selector
+	sessionSync     bool
+	sessionLayout   string
+	sessionName     string
+	sessionWith     string
+	sessionDryRun   bool
+
+	sessionCmd = &cobra.Command{
+		Use:   "session",
+		Short: "Open several servers side by side in tmux or screen",
+		Long: `Open a set of servers side by side, one pane per server, in tmux, or one
+window per server in screen when tmux isn't available. Sessions can be
+defined in the config under "sessions":
+
+  "sessions": {
+    "incident": {
+      "group": "payments",
+      "environment": "prod",
+      "layout": "even-vertical",
+      "sync": true
+    }
+  }
+
+A session may also list "servers" by name and a "command" to run in every
+pane instead of a login shell.`,
+	}
+
+	sessionOpenCmd = &cobra.Command{
+		Use:   "open <session|group>",
+		Short: "Open a configured session, or every server of a group",
+		Long: `Open a configured session, or one pane for every server in a group. Each
+pane is connected with 'ssh-tool connect', so keys, certificates and
+shared connections work as usual. Inside tmux the session is created next
+to the current one and switched to; inside screen the windows are added to
+the current session. If the session is open already it is attached.`,
+		Example: `  ssh-tool session open payments --env prod --sync
+  ssh-tool session open incident --dry-run`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			session, ok := cfg.Sessions[args[0]]
+			if !ok {
+				session = config.Session{Name: args[0], Group: args[0]}
+			}
+			if cmd.Flags().Changed("sync") {
+				session.Sync = sessionSync
+			}
+			if sessionLayout != "" {
+				session.Layout = sessionLayout
+			}
+			if session.Layout == "" {
+				session.Layout = config.DefaultLayout
+			}
+			if issues := cfg.ValidateSession(session); len(issues) > 0 {
+				return fmt.Errorf("%s", issues[0].Message)
+			}
+
+			servers, err := cfg.SessionServers(session)
+			if err != nil {
+				return err
+			}
+			servers = filterServers(servers, sessionSelector)
+			if len(servers) == 0 {
+				if ok {
+					return fmt.Errorf("no servers in session %s match", session.Name)
+				}
+				return fmt.Errorf("no session or group called %s", args[0])
+			}
+
+			multiplexer := sessionWith
+			if multiplexer == "" {
+				if multiplexer, err = panes.Detect(); err != nil {
+					return err
+				}
+			}
+			inside := panes.Inside(multiplexer)
+
+			name := sessionName
+			if name == "" {
+				name = "ssh-" + session.Name
+			}
+			// tmux uses . and : in targets
+			name = strings.NewReplacer(".", "_", ":", "_").Replace(name)
+
+			spec := panes.Spec{Name: name, Layout: session.Layout, Sync: session.Sync}
+			if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+				spec.Width, spec.Height = width, height
+			}
+			for _, server := range servers {
+				command, err := paneCommand(server, session.Command)
+				if err != nil {
+					return err
+				}
+				spec.Panes = append(spec.Panes, panes.Pane{Title: server.Name, Command: command})
+			}
+
+			plan, err := panes.Build(multiplexer, spec, inside)
+			if err != nil {
+				return err
+			}
+			if sessionDryRun {
+				fmt.Print(plan)
+				return nil
+			}
+
+			if panes.Exists(multiplexer, name) {
+				fmt.Printf("Session %s is open already, attaching\n", name)
+				plan = panes.Plan{panes.Attach(multiplexer, name, inside)}
+			}
+			return panes.Run(plan)
+		},
+	}
+
+	sessionListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the sessions defined in the config",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+
+			names := cfg.SessionNames()
+			if len(names) == 0 {
+				fmt.Println("No sessions configured, 'ssh-tool session open <group>' opens a group")
+				return nil
+			}
+
+			fmt.Printf("%-24s  %-8s  %-16s  %s\n", "SESSION", "SERVERS", "LAYOUT", "SYNC")
+			for _, name := range names {
+				session := cfg.Sessions[name]
+				count := "?"
+				if servers, err := cfg.SessionServers(session); err == nil {
+					count = fmt.Sprint(len(servers))
+				}
+				layout := session.Layout
+				if layout == "" {
+					layout = config.DefaultLayout
+				}
+				sync := "no"
+				if session.Sync {
+					sync = "yes"
+				}
+				fmt.Printf("%s  %-8s  %-16s  %s\n",
+					colorize(fmt.Sprintf("%-24s", truncateString(name, 24)), colorGreen),
+					count, layout, sync)
+			}
+			return nil
+		},
+	}
+)
+
+// paneCommand returns the ssh-tool invocation that connects a pane to
+// server, or runs command on it.
+func paneCommand(server config.Server, command string) ([]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("error finding ssh-tool executable: %v", err)
+	}
+
+	args := []string{exe}
+	if configFile != "" {
+		args = append(args, "--config", configFile)
+	}
+	if command != "" {
+		return append(args, "exec", server.Name, "--", command), nil
+	}
+	return append(args, "connect", server.Name), nil
+}
+
+func filterServers(servers []config.Server, sel config.Selector) []config.Server {
+	var result []config.Server
+	for _, server := range servers {
+		if sel.Matches(server) {
+			result = append(result, server)
+		}
+	}
+	return result
+}
+
+func init() {
+	sessionOpenCmd.Flags().BoolVar(&sessionSync, "sync", false, "send input typed in one pane to all panes")
+	sessionOpenCmd.Flags().StringVar(&sessionLayout, "layout", "", "tmux layout: "+strings.Join(config.Layouts, ", "))
+	sessionOpenCmd.Flags().StringVar(&sessionName, "name", "", "tmux or screen session name (default ssh-<session>)")
+	sessionOpenCmd.Flags().StringVar(&sessionWith, "with", "", "tmux or screen (default: the one running, else tmux if installed)")
+	sessionOpenCmd.Flags().BoolVar(&sessionDryRun, "dry-run", false, "print the tmux or screen commands instead of running them")
+	addSelectorFlags(sessionOpenCmd, &sessionSelector)
+	sessionOpenCmd.RegisterFlagCompletionFunc("layout", cobra.FixedCompletions(config.Layouts, cobra.ShellCompDirectiveNoFileComp))
+	sessionOpenCmd.RegisterFlagCompletionFunc("with", cobra.FixedCompletions([]string{panes.Tmux, panes.Screen}, cobra.ShellCompDirectiveNoFileComp))
+
+	sessionCmd.AddCommand(sessionOpenCmd, sessionListCmd)
+	rootCmd.AddCommand(sessionCmd)
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/inventory"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	syncProfile     string
+	syncRegion      string
+	syncEndpointURL string
+	syncTagFilters  map[string]string
+	syncAddress     string
+	syncUser        string
+	syncKeyDir      string
+	syncGroup       string
+	syncTransport   string
+	syncPrune       bool
+	syncDryRun      bool
+
+	syncCmd = &cobra.Command{
+		Use:   "sync",
+		Short: "Refresh servers in the user config from an inventory",
+	}
+
+	syncAWSCmd = &cobra.Command{
+		Use:   "aws",
+		Short: "Import and refresh servers from EC2 instances",
+		Long: `Discover EC2 instances with the aws CLI and write them to the user config.
+The Name tag becomes the server name, the private (or public) IP the
+hostname and the instance key pair <key-dir>/<KeyName>.pem the key file.
+
+Entries written by a sync remember its profile, region and filters. Running
+the same sync again refreshes them and marks entries whose instance is gone
+as stale; --prune removes those instead.`,
+		Example: `  ssh-tool sync aws --profile prod --region eu-west-2 --tag-filter Env=prod`,
+		Args:    cobra.NoArgs,
+		RunE:    runSyncAWS,
+	}
+)
+
+func runSyncAWS(cmd *cobra.Command, args []string) error {
+	if syncAddress != inventory.AddressPrivate && syncAddress != inventory.AddressPublic {
+		return fmt.Errorf("--address must be %q or %q", inventory.AddressPrivate, inventory.AddressPublic)
+	}
+	if syncTransport != config.TransportSSH && syncTransport != config.TransportSSM {
+		return fmt.Errorf("--transport must be %q or %q", config.TransportSSH, config.TransportSSM)
+	}
+
+	source := inventory.CLISource{Profile: syncProfile, Region: syncRegion, EndpointURL: syncEndpointURL}
+	instances, err := source.Instances(context.Background(), syncTagFilters)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	opts := inventory.SyncOptions{
+		Source:  syncSourceName(),
+		Address: syncAddress,
+		User:    syncUser,
+		Group:   syncGroup,
+		KeyDir:  syncKeyDir,
+		Prune:   syncPrune,
+		Taken:   make(map[string]bool),
+
+		Transport:  syncTransport,
+		AWSProfile: syncProfile,
+		AWSRegion:  syncRegion,
+	}
+
+	var changes []inventory.Change
+	err = updateUserConfig(func(user *config.Config) error {
+		for name := range cfg.Servers {
+			if _, ok := user.Servers[name]; !ok {
+				opts.Taken[name] = true
+			}
+		}
+
+		changes = inventory.Sync(user, instances, opts)
+		if syncDryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return err
+	}
+
+	printSyncChanges(changes, len(instances))
+	return nil
+}
+
+// syncSourceName identifies a sync by everything that decides which
+// instances it sees, so two differently filtered syncs never mark each
+// other's entries stale.
+func syncSourceName() string {
+	profile := syncProfile
+	if profile == "" {
+		profile = "default"
+	}
+	name := fmt.Sprintf("aws:%s/%s", profile, syncRegion)
+
+	var filters []string
+	for key, value := range syncTagFilters {
+		filters = append(filters, key+"="+value)
+	}
+	sort.Strings(filters)
+	if len(filters) > 0 {
+		name += "?" + strings.Join(filters, "&")
+	}
+	return name
+}
+
+func printSyncChanges(changes []inventory.Change, found int) {
+	colors := map[string]string{
+		inventory.ActionAdded:     colorGreen,
+		inventory.ActionUpdated:   colorCyan,
+		inventory.ActionUnchanged: colorReset,
+		inventory.ActionStale:     colorYellow,
+		inventory.ActionRemoved:   colorMagenta,
+		inventory.ActionSkipped:   colorYellow,
+	}
+
+	counts := make(map[string]int)
+	for _, c := range changes {
+		counts[c.Action]++
+		if c.Action == inventory.ActionUnchanged {
+			continue
+		}
+		line := fmt.Sprintf("%-10s %s", c.Action, c.Name)
+		if c.Detail != "" {
+			line += "  " + c.Detail
+		}
+		fmt.Println(colorize(line, colors[c.Action]))
+	}
+
+	prefix := ""
+	if syncDryRun {
+		prefix = "(dry run) "
+	}
+	fmt.Printf("\n%s%d instances: %d added, %d updated, %d unchanged, %d stale, %d removed, %d skipped\n",
+		prefix, found,
+		counts[inventory.ActionAdded], counts[inventory.ActionUpdated], counts[inventory.ActionUnchanged],
+		counts[inventory.ActionStale], counts[inventory.ActionRemoved], counts[inventory.ActionSkipped])
+}
+
+func init() {
+	syncAWSCmd.Flags().StringVar(&syncProfile, "profile", "", "AWS profile to use")
+	syncAWSCmd.Flags().StringVar(&syncRegion, "region", "", "AWS region to use")
+	syncAWSCmd.Flags().StringVar(&syncEndpointURL, "endpoint-url", "", "override the EC2 endpoint, e.g. for a local stub")
+	syncAWSCmd.Flags().StringToStringVar(&syncTagFilters, "tag-filter", nil, "only instances with this tag, as Key=Value (repeatable)")
+	syncAWSCmd.Flags().StringVar(&syncAddress, "address", inventory.AddressPrivate, "use the private or public IP as hostname")
+	syncAWSCmd.Flags().StringVar(&syncUser, "user", "ubuntu", "login user for new servers")
+	syncAWSCmd.Flags().StringVar(&syncKeyDir, "key-dir", "~/.ssh/pemfiles", "directory holding <KeyName>.pem files")
+	syncAWSCmd.Flags().StringVar(&syncGroup, "group", "", "group for new servers")
+	syncAWSCmd.Flags().StringVar(&syncTransport, "transport", config.TransportSSH, "ssh, or ssm for new servers to connect through Session Manager")
+	syncAWSCmd.Flags().BoolVar(&syncPrune, "prune", false, "remove stale servers instead of marking them")
+	syncAWSCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "show changes without saving")
+
+	syncCmd.AddCommand(syncAWSCmd)
+	rootCmd.AddCommand(syncCmd)
+}
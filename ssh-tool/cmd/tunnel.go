@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"ssh-tool/internal/audit"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/ssh"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// forward is one -L, -R or -D port forward.
+type forward struct {
+	flag string
+	spec string
+}
+
+var (
+	tunnelSelector config.Selector
+	tunnelLocal    []string
+	tunnelRemote   []string
+	tunnelDynamic  []string
+
+	tunnelCmd = &cobra.Command{
+		Use:   "tunnel <server>",
+		Short: "Forward ports through a server until interrupted",
+		Long: `Forward ports through a server, with the same syntax as ssh's -L, -R and
+-D options, until Ctrl-C. The forwards are added to the shared connection
+to the server, which is opened if needed, and removed again on exit.`,
+		Example: `  ssh-tool tunnel db-proxy -L 5432:db.internal:5432
+  ssh-tool tunnel bastion -D 1080`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var forwards []forward
+			for _, spec := range tunnelLocal {
+				forwards = append(forwards, forward{"-L", spec})
+			}
+			for _, spec := range tunnelRemote {
+				forwards = append(forwards, forward{"-R", spec})
+			}
+			for _, spec := range tunnelDynamic {
+				forwards = append(forwards, forward{"-D", spec})
+			}
+			if len(forwards) == 0 {
+				return fmt.Errorf("give at least one of -L, -R or -D")
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			server, err := selectServer(cfg, tunnelSelector, args[0])
+			if err != nil {
+				return err
+			}
+
+			return runTunnel(server, forwards, cfg.HooksFor(server))
+		},
+	}
+)
+
+func runTunnel(server config.Server, forwards []forward, h config.Hooks) error {
+	var specs []string
+	for _, f := range forwards {
+		specs = append(specs, f.flag+" "+f.spec)
+	}
+
+	// Without connection sharing ssh -N holds the forwards itself
+	if _, ok := server.MuxPersist(); !ok {
+		opts := sessionOptions{
+			command: "tunnel",
+			remote:  specs,
+			hooks:   h,
+			build: func(client *ssh.Client) (*exec.Cmd, error) {
+				args, err := client.Options()
+				if err != nil {
+					return nil, err
+				}
+				for _, f := range forwards {
+					args = append(args, f.flag, f.spec)
+				}
+				args = append(args, "-N", client.Destination())
+				return exec.Command("ssh", args...), nil
+			},
+		}
+		fmt.Printf("Forwarding %s through %s, press Ctrl-C to stop\n", strings.Join(specs, ", "), server.Name)
+		_, err := runSession(server, opts)
+		return err
+	}
+
+	entry := audit.Entry{
+		Command:  "tunnel",
+		Server:   server.Name,
+		Hostname: server.Hostname,
+		User:     server.User,
+		Remote:   strings.Join(specs, " "),
+		Start:    time.Now(),
+	}
+	if u, err := user.Current(); err == nil {
+		entry.LocalUser = u.Username
+	}
+
+	finish, err := startHooks(server, "tunnel", h)
+	if err != nil {
+		auditFailure(entry, err)
+		return err
+	}
+	code := 0
+	defer func() { finish(code) }()
+
+	client, err := openForwards(server, forwards)
+	if err != nil {
+		code = -1
+		auditFailure(entry, err)
+		return err
+	}
+	recordVisit(server.Name, entry.Start)
+	fmt.Printf("Forwarding %s through %s, press Ctrl-C to stop\n", strings.Join(specs, ", "), server.Name)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	// Listening forwards don't count as use of the shared connection, so it
+	// may close once idle for mux_idle; open it again when that happens
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-signals:
+			break wait
+		case <-ticker.C:
+			if client.Running() {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Connection to %s closed, reconnecting...\n", server.Name)
+			if client, err = openForwards(server, forwards); err != nil {
+				entry.Error = err.Error()
+				break wait
+			}
+		}
+	}
+
+	if entry.Error == "" {
+		for _, f := range forwards {
+			if err := client.Forward(f.flag, f.spec, true); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+			}
+		}
+	}
+
+	entry.End = time.Now()
+	if entry.Error != "" {
+		code = -1
+		entry.ExitCode = code
+	}
+	appendAudit(entry)
+	if entry.Error != "" {
+		return err
+	}
+	return nil
+}
+
+// openForwards makes sure the shared connection to server is up and adds
+// the forwards to it.
+func openForwards(server config.Server, forwards []forward) (*ssh.Client, error) {
+	client := ssh.NewClient(server)
+	client.Mux = true
+	cleanup, err := client.Prepare(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	if err := client.StartMaster(); err != nil {
+		if server.Transport == config.TransportSSM {
+			explainSSMFailure(server)
+		}
+		return nil, err
+	}
+
+	for i, f := range forwards {
+		if err := client.Forward(f.flag, f.spec, false); err != nil {
+			for _, added := range forwards[:i] {
+				client.Forward(added.flag, added.spec, true)
+			}
+			return nil, fmt.Errorf("error adding forward %v", err)
+		}
+	}
+	return client, nil
+}
+
+func init() {
+	tunnelCmd.Flags().StringArrayVarP(&tunnelLocal, "local", "L", nil, "forward a local port, [bind:]port:host:hostport")
+	tunnelCmd.Flags().StringArrayVarP(&tunnelRemote, "remote", "R", nil, "forward a remote port, [bind:]port:host:hostport")
+	tunnelCmd.Flags().StringArrayVarP(&tunnelDynamic, "dynamic", "D", nil, "SOCKS proxy on a local port, [bind:]port")
+	addSelectorFlags(tunnelCmd, &tunnelSelector)
+	rootCmd.AddCommand(tunnelCmd)
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/dashboard"
+	"ssh-tool/internal/picker"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	uiSelector config.Selector
+
+	uiCmd = &cobra.Command{
+		Use:   "ui",
+		Short: "Browse servers in a full-screen dashboard",
+		Long: `Open a full-screen dashboard with a searchable server list, details of the
+selected server and a reachability indicator that is refreshed every 30
+seconds. From the list:
+
+  enter, c   connect
+  x          run a command
+  p          copy files with scp, ':' stands for the server, e.g. ':/etc/hosts .'
+  t          open a tunnel, e.g. '-L 8080:localhost:80'
+  /          search, esc clears
+  r          check reachability now
+  q          quit
+
+The dashboard comes back once the session ends.`,
+		Example: `  ssh-tool ui
+  ssh-tool ui --env prod`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !picker.Available() {
+				return fmt.Errorf("the dashboard needs a terminal")
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			servers := cfg.Select(uiSelector)
+			if len(servers) == 0 {
+				if uiSelector.Empty() {
+					return fmt.Errorf("no servers configured")
+				}
+				return fmt.Errorf("no servers match %s", uiSelector)
+			}
+
+			d := dashboard.New(servers, loadState())
+			defer d.Close()
+			for {
+				action, err := d.Next()
+				if err != nil {
+					return err
+				}
+				if action.Kind == dashboard.ActionQuit {
+					return nil
+				}
+
+				if err := runAction(cfg, d, action); err != nil {
+					d.Notice(fmt.Sprintf("%s: %v", action.Server.Name, err))
+				}
+				d.SetState(loadState())
+			}
+		},
+	}
+)
+
+// runAction runs what was picked in the dashboard on the terminal it
+// borrowed. Commands and copies wait for a key so their output can be
+// read before the dashboard is drawn again.
+func runAction(cfg *config.Config, d *dashboard.Dashboard, action dashboard.Action) error {
+	server := action.Server
+	h := cfg.HooksFor(server)
+
+	switch action.Kind {
+	case dashboard.ActionConnect:
+		fmt.Printf("Connecting to %s (%s)...\n", server.Name, server.Hostname)
+		_, err := runSession(server, sessionOptions{command: "connect", hooks: h})
+		return err
+
+	case dashboard.ActionExec:
+		fmt.Printf("%s$ %s%s\n", colorCyan, action.Input, colorReset)
+		code, err := runSession(server, sessionOptions{command: "exec", remote: []string{action.Input}, hooks: h})
+		if err == nil && code > 0 {
+			err = fmt.Errorf("exited with code %d", code)
+		}
+		d.Wait("Press any key to return to the list")
+		return err
+
+	case dashboard.ActionCopy:
+		var args []string
+		recursive := false
+		for _, arg := range strings.Fields(action.Input) {
+			switch {
+			case arg == "-r":
+				recursive = true
+			case strings.HasPrefix(arg, ":"):
+				args = append(args, server.Name+arg)
+			default:
+				args = append(args, arg)
+			}
+		}
+		if len(args) < 2 {
+			return fmt.Errorf("give a source and a target, e.g. ':/etc/hosts .'")
+		}
+		code, err := copyFiles(cfg, config.Selector{}, args, recursive)
+		if err == nil && code > 0 {
+			err = fmt.Errorf("scp exited with code %d", code)
+		}
+		d.Wait("Press any key to return to the list")
+		return err
+
+	case dashboard.ActionTunnel:
+		forwards, err := parseForwards(action.Input)
+		if err != nil {
+			return err
+		}
+		return runTunnel(server, forwards, h)
+	}
+	return nil
+}
+
+// parseForwards reads forwards written as on the tunnel command line,
+// e.g. "-L 8080:localhost:80 -D 1080".
+func parseForwards(input string) ([]forward, error) {
+	fields := strings.Fields(input)
+	var forwards []forward
+	for i := 0; i < len(fields); i++ {
+		flag := fields[i]
+		if len(flag) > 2 && (strings.HasPrefix(flag, "-L") || strings.HasPrefix(flag, "-R") || strings.HasPrefix(flag, "-D")) {
+			// -L8080:localhost:80, as ssh accepts it
+			forwards = append(forwards, forward{flag[:2], flag[2:]})
+			continue
+		}
+		if flag != "-L" && flag != "-R" && flag != "-D" {
+			return nil, fmt.Errorf("unexpected %q, write forwards as -L, -R or -D <spec>", flag)
+		}
+		if i+1 == len(fields) {
+			return nil, fmt.Errorf("%s needs a forward spec", flag)
+		}
+		i++
+		forwards = append(forwards, forward{flag, fields[i]})
+	}
+	if len(forwards) == 0 {
+		return nil, fmt.Errorf("give at least one of -L, -R or -D")
+	}
+	return forwards, nil
+}
+
+func init() {
+	addSelectorFlags(uiCmd, &uiSelector)
+	rootCmd.AddCommand(uiCmd)
+}
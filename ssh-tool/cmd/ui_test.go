@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseForwards(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []forward
+		wantErr string
+	}{
+		{input: "-L 8080:localhost:80", want: []forward{{"-L", "8080:localhost:80"}}},
+		{input: "-L8080:localhost:80", want: []forward{{"-L", "8080:localhost:80"}}},
+		{
+			input: "-L 5432:db.internal:5432  -R9000:localhost:9000 -D 1080",
+			want:  []forward{{"-L", "5432:db.internal:5432"}, {"-R", "9000:localhost:9000"}, {"-D", "1080"}},
+		},
+		{input: "", wantErr: "give at least one of -L, -R or -D"},
+		{input: "8080:localhost:80", wantErr: `unexpected "8080:localhost:80"`},
+		{input: "-L 8080:localhost:80 -X", wantErr: `unexpected "-X"`},
+		{input: "-D", wantErr: "-D needs a forward spec"},
+	}
+	for _, tt := range tests {
+		got, err := parseForwards(tt.input)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parseForwards(%q) error = %v, want one containing %q", tt.input, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseForwards(%q): %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseForwards(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package ansi holds the terminal escape sequences shared by the table
+// output, the picker and the dashboard.
+package ansi
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	Reset   = "\033[0m"
+	Bold    = "\033[1m"
+	Dim     = "\033[2m"
+	Reverse = "\033[7m"
+	Red     = "\033[31m"
+	Green   = "\033[32m"
+	Yellow  = "\033[33m"
+	Blue    = "\033[34m"
+	Magenta = "\033[35m"
+	Cyan    = "\033[36m"
+
+	AltScreenOn  = "\033[?1049h"
+	AltScreenOff = "\033[?1049l"
+	CursorHide   = "\033[?25l"
+	CursorShow   = "\033[?25h"
+	ClearScreen  = "\033[H\033[2J"
+	// ClearLine clears from the cursor to the end of the line
+	ClearLine = "\033[K"
+)
+
+// Strip removes colour sequences from s.
+func Strip(s string) string {
+	var b strings.Builder
+	inEscape := false
+	for _, r := range s {
+		switch {
+		case r == '\033':
+			inEscape = true
+		case inEscape && r == 'm':
+			inEscape = false
+		case !inEscape:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Width returns the number of runes s takes on screen, ignoring colours.
+func Width(s string) int {
+	return utf8.RuneCountInString(Strip(s))
+}
+
+// Truncate shortens plain text to width runes, marking the cut with "...".
+func Truncate(s string, width int) string {
+	if width <= 3 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width-3]) + "..."
+}
+
+// Pad truncates or pads plain text to exactly width runes.
+func Pad(s string, width int) string {
+	s = Truncate(s, width)
+	if n := utf8.RuneCountInString(s); n < width {
+		s += strings.Repeat(" ", width-n)
+	}
+	return s
+}
@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"ssh-tool/internal/config"
+	"time"
+)
+
+// Entry records one connect or exec invocation.
+type Entry struct {
+	Command   string    `json:"command"`
+	Server    string    `json:"server"`
+	Hostname  string    `json:"hostname"`
+	User      string    `json:"user"`
+	LocalUser string    `json:"local_user"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	ExitCode  int       `json:"exit_code"`
+	Remote    string    `json:"remote_command,omitempty"`
+	Recording string    `json:"recording,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+func (e Entry) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// DefaultPath returns the audit log location in the state directory.
+func DefaultPath() (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "audit.jsonl"), nil
+}
+
+// Append writes entry as one JSON line. Lines are written with a single
+// O_APPEND write, so concurrent sessions don't interleave records.
+func Append(path string, entry Entry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating audit log directory: %v", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error opening audit log: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("error writing audit log: %v", err)
+	}
+	return nil
+}
+
+// Read returns every entry in the log, oldest first. A missing log is
+// not an error; lines that fail to parse are skipped.
+func Read(path string) ([]Entry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAppendRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "audit.jsonl")
+
+	entries, err := Read(path)
+	if err != nil || entries != nil {
+		t.Fatalf("Read of a missing log = %v, %v, want nothing", entries, err)
+	}
+
+	start := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	want := []Entry{
+		{Command: "connect", Server: "prod-api", Hostname: "10.0.1.10", User: "deploy", LocalUser: "alice",
+			Start: start, End: start.Add(90 * time.Second), Recording: "/tmp/prod-api.cast"},
+		{Command: "exec", Server: "prod-db", Hostname: "10.0.1.20", User: "deploy", LocalUser: "alice",
+			Start: start, End: start, ExitCode: -1, Remote: "uptime", Error: "pre_connect hook failed"},
+	}
+	for _, entry := range want {
+		if err := Append(path, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A line cut short by a crash is skipped, not fatal
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"command": "conn` + "\n")
+	f.Close()
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read = %+v\nwant %+v", got, want)
+	}
+	if d := got[0].Duration(); d != 90*time.Second {
+		t.Errorf("Duration = %s, want 1m30s", d)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("log mode = %v, %v, want 0600", info.Mode(), err)
+	}
+}
+
+func TestAppendConcurrent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := Append(path, Entry{Command: "exec", Server: fmt.Sprintf("web-%d", i)}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 50 {
+		t.Errorf("read %d entries, want 50", len(entries))
+	}
+}
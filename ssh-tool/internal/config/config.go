@@ -2,55 +2,170 @@ package config
 
 import (
 	_ "embed"
-	"encoding/json"
-	"fmt"
-	"os"
 	"sort"
+	"time"
 )
 
 //go:embed servers.json
 var embeddedConfig []byte
 
+// JSONSchema describes the config file, for editors to validate and
+// complete it.
+//
+//go:embed schema.json
+var JSONSchema []byte
+
 type Server struct {
-	Name        string
-	Hostname    string `json:"hostname"`
-	User        string `json:"user"`
-	PemFile     string `json:"pem_file"`
-	Description string `json:"description"`
+	Name        string   `json:"-"`
+	Hostname    string   `json:"hostname,omitempty"`
+	User        string   `json:"user,omitempty"`
+	PemFile     string   `json:"pem_file,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Port        int      `json:"port,omitempty"`
+	ProxyJump   string   `json:"proxy_jump,omitempty"`
+	// Extends names a template or server whose fields this entry inherits
+	Extends string `json:"extends,omitempty"`
+
+	// Options are extra ssh options, passed as -o key=value
+	Options       map[string]string `json:"options,omitempty"`
+	IdentityAgent string            `json:"identity_agent,omitempty"`
+	// Env is sent to the server with SetEnv, it must allow it with AcceptEnv
+	Env           map[string]string `json:"env,omitempty"`
+	RemoteCommand string            `json:"remote_command,omitempty"`
+	// HostKeys pins the server's host keys as "type SHA256:fingerprint"
+	HostKeys []string `json:"host_keys,omitempty"`
+	// MuxIdle is how long a shared connection stays open unused, e.g.
+	// "10m"; "off" disables connection sharing
+	MuxIdle string `json:"mux_idle,omitempty"`
+	// CA, if set, signs a short-lived certificate for the key before connecting
+	CA *CA `json:"ca,omitempty"`
+	// Hooks run around connections to this server, after the global ones
+	Hooks *Hooks `json:"hooks,omitempty"`
+
+	// Transport is how ssh reaches the server: "ssh" (the default) or
+	// "ssm", through an AWS Session Manager session to InstanceID
+	Transport  string `json:"transport,omitempty"`
+	AWSProfile string `json:"aws_profile,omitempty"`
+	AWSRegion  string `json:"aws_region,omitempty"`
+
+	// Source names the inventory sync that manages this entry, if any
+	Source     string `json:"source,omitempty"`
+	InstanceID string `json:"instance_id,omitempty"`
+	// Stale is set by sync when the instance was not found anymore
+	Stale bool `json:"stale,omitempty"`
 }
 
-type Config struct {
-	Servers map[string]Server `json:"servers"`
+const (
+	TransportSSH = "ssh"
+	TransportSSM = "ssm"
+)
+
+// CA names the certificate authority that signs user certificates for a
+// server: a local CA private key or an HTTPS signing endpoint.
+type CA struct {
+	Key        string   `json:"key,omitempty"`
+	URL        string   `json:"url,omitempty"`
+	Principals []string `json:"principals,omitempty"`
+	// TTL is how long new certificates are valid, e.g. "8h"
+	TTL string `json:"ttl,omitempty"`
 }
 
-func LoadConfig(file string) (*Config, error) {
-	var data []byte
-	var err error
-
-	if file != "" {
-		// Try to load from external file if provided
-		data, err = os.ReadFile(file)
-		if err != nil {
-			// If external file fails, fall back to embedded config
-			data = embeddedConfig
-		}
-	} else {
-		// Use embedded config by default
-		data = embeddedConfig
+// Hooks are shell commands run around a connection, with the server's
+// fields in SSH_TOOL_* environment variables.
+type Hooks struct {
+	// PreConnect runs before connecting; a failing command aborts
+	PreConnect []string `json:"pre_connect,omitempty"`
+	// PostDisconnect runs once ssh has exited, whatever the outcome
+	PostDisconnect []string `json:"post_disconnect,omitempty"`
+}
+
+// HooksFor returns the hooks to run for server: global pre_connect hooks
+// before the server's own, and the server's post_disconnect hooks before
+// the global ones.
+func (c *Config) HooksFor(server Server) Hooks {
+	var global, own Hooks
+	if c.Hooks != nil {
+		global = *c.Hooks
 	}
+	if server.Hooks != nil {
+		own = *server.Hooks
+	}
+	return Hooks{
+		PreConnect:     append(append([]string{}, global.PreConnect...), own.PreConnect...),
+		PostDisconnect: append(append([]string{}, own.PostDisconnect...), global.PostDisconnect...),
+	}
+}
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("error parsing config: %v", err)
+// DefaultCertTTL is used when a CA sets no ttl.
+const DefaultCertTTL = time.Hour
+
+// Lifetime returns the validity of newly signed certificates.
+func (ca *CA) Lifetime() time.Duration {
+	if d, err := time.ParseDuration(ca.TTL); err == nil && d > 0 {
+		return d
 	}
+	return DefaultCertTTL
+}
 
-	// Add server names to the struct
-	for name, server := range config.Servers {
-		server.Name = name
-		config.Servers[name] = server
+// DefaultMuxIdle is how long shared connections stay open unused when a
+// server sets no mux_idle.
+const DefaultMuxIdle = 10 * time.Minute
+
+// MuxPersist returns how long the shared connection to the server stays
+// open once idle, or false if connections aren't shared.
+func (s Server) MuxPersist() (time.Duration, bool) {
+	switch s.MuxIdle {
+	case "":
+		return DefaultMuxIdle, true
+	case "off", "no", "0":
+		return 0, false
 	}
+	d, err := time.ParseDuration(s.MuxIdle)
+	if err != nil || d <= 0 {
+		return 0, false
+	}
+	return d, true
+}
+
+type Config struct {
+	// Schema is the JSONSchema URL or path the file names for editors
+	Schema  string            `json:"$schema,omitempty"`
+	Servers map[string]Server `json:"servers"`
+	// Hooks run around connections to every server
+	Hooks *Hooks `json:"hooks,omitempty"`
+	// Sessions are multi-pane layouts for `session open`
+	Sessions map[string]Session `json:"sessions,omitempty"`
+	// Defaults are inherited by every server, Templates only by those that
+	// extend them and Vars are expanded as ${VAR}; see Expand
+	Defaults  *Server           `json:"defaults,omitempty"`
+	Templates map[string]Server `json:"templates,omitempty"`
+	Vars      map[string]string `json:"vars,omitempty"`
+
+	// Origins lists, per server, the layers that contributed to it
+	Origins map[string][]string `json:"-"`
+	// Skipped holds the entries Expand couldn't expand, with the reason
+	Skipped map[string]error `json:"-"`
+	// Untrusted is the project config whose hooks and command options
+	// were ignored because the user hasn't trusted it
+	Untrusted string `json:"-"`
+}
 
-	return &config, nil
+// LoadConfig merges every configuration layer (see Layers) and expands
+// templates into concrete servers. file is the optional --config file;
+// unlike the other layers it must exist.
+func LoadConfig(file string) (*Config, error) {
+	layers, err := Layers(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadLayers(layers)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Expand(), nil
 }
 
 func (c *Config) GetServersList() []Server {
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMuxPersist(t *testing.T) {
+	tests := []struct {
+		idle   string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", DefaultMuxIdle, true},
+		{"30m", 30 * time.Minute, true},
+		{"off", 0, false},
+		{"no", 0, false},
+		{"0", 0, false},
+		{"-5m", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Server{MuxIdle: tt.idle}.MuxPersist()
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("MuxPersist(%q) = %s, %v, want %s, %v", tt.idle, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// UserConfigPath returns the per-user config file written by the
+// `config` subcommands, honouring XDG_CONFIG_HOME: the servers.json,
+// .yaml, .yml or .toml that exists, or servers.json.
+func UserConfigPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting home directory: %v", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	base := filepath.Join(dir, "ssh-tool", "servers")
+	if path := findConfigFile(base); path != "" {
+		return path, nil
+	}
+	return base + ".json", nil
+}
+
+// findConfigFile returns base with the first of Extensions that exists, or
+// "".
+func findConfigFile(base string) string {
+	for _, ext := range Extensions {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext
+		}
+	}
+	return ""
+}
+
+// StateDir returns the directory for history, audit logs and other state
+// that is not configuration, honouring XDG_STATE_HOME.
+func StateDir() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("error getting home directory: %v", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "ssh-tool"), nil
+}
+
+// ExpandPath expands a leading ~ to the user's home directory.
+func ExpandPath(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("error getting home directory: %v", err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// ReadFile parses a single config file without merging anything into it.
+// The format follows the extension, see FormatOf; a file that doesn't parse
+// returns a *ParseError.
+func ReadFile(file string) (*Config, error) {
+	cfg, _, err := readFile(file)
+	return cfg, err
+}
+
+// readFile is ReadFile that also returns the data the config was parsed
+// from.
+func readFile(file string) (*Config, []byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, err := parse(data, FormatOf(file))
+	if perr, ok := err.(*ParseError); ok {
+		perr.File = file
+	}
+	return cfg, data, err
+}
+
+// ReadFileOrEmpty is like ReadFile but returns an empty config when the
+// file does not exist yet.
+func ReadFileOrEmpty(file string) (*Config, error) {
+	cfg, err := ReadFile(file)
+	if os.IsNotExist(err) {
+		return &Config{Servers: make(map[string]Server)}, nil
+	}
+	return cfg, err
+}
+
+// WriteFile atomically replaces file with the JSON encoding of c. YAML and
+// TOML files are only ever edited by hand, so that their comments and
+// layout are kept.
+func (c *Config) WriteFile(file string) error {
+	if FormatOf(file) != FormatJSON {
+		return fmt.Errorf("%s is %s, which ssh-tool doesn't rewrite; change it with 'ssh-tool config edit' or by hand", file, FormatOf(file))
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding config: %v", err)
+	}
+	return ReplaceFile(file, append(data, '\n'))
+}
+
+// ReplaceFile atomically replaces file with data: the data is written to a
+// temporary file in the same directory, synced and renamed over the
+// original so readers never see a partial config.
+func ReplaceFile(file string, data []byte) error {
+	dir := filepath.Dir(file)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating config directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".servers-*"+filepath.Ext(file))
+	if err != nil {
+		return fmt.Errorf("error creating temporary config file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing config: %v", err)
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error setting config permissions: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error syncing config: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing config: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("error replacing config: %v", err)
+	}
+	return nil
+}
+
+func parse(data []byte, format Format) (*Config, error) {
+	var config Config
+	if err := decode(data, format, &config); err != nil {
+		return nil, err
+	}
+	if config.Servers == nil {
+		config.Servers = make(map[string]Server)
+	}
+
+	// Add server names to the struct
+	for name, server := range config.Servers {
+		server.Name = name
+		config.Servers[name] = server
+	}
+	for name, session := range config.Sessions {
+		session.Name = name
+		config.Sessions[name] = session
+	}
+	return &config, nil
+}
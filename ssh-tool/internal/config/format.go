@@ -0,0 +1,384 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Format is the syntax of a config file, chosen by its extension.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+)
+
+// Extensions are the config file extensions, in the order a directory is
+// searched for them.
+var Extensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+// FormatOf returns the format of file from its extension; anything that
+// isn't YAML or TOML is read as JSON.
+func FormatOf(file string) Format {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	}
+	return FormatJSON
+}
+
+// ParseError is a config file that doesn't parse, or holds a value of the
+// wrong type, with the position of the problem where it is known.
+type ParseError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *ParseError) Error() string {
+	switch {
+	case e.Line > 0 && e.Column > 0:
+		return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+	case e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.File, e.Message)
+}
+
+var (
+	yamlLinePattern = regexp.MustCompile(`line (\d+): (.*)`)
+	tomlLinePattern = regexp.MustCompile(`^toml: line (\d+)(?: \(last key [^)]*\))?: `)
+)
+
+// decode parses data into v. YAML and TOML are converted to JSON first, so
+// the json tags stay the only description of the file's keys.
+func decode(data []byte, format Format, v any) error {
+	switch format {
+	case FormatYAML:
+		return decodeYAML(data, v)
+	case FormatTOML:
+		return decodeTOML(data, v)
+	}
+	return decodeJSON(data, v)
+}
+
+func decodeJSON(data []byte, v any) error {
+	err := json.Unmarshal(data, v)
+	var syntax *json.SyntaxError
+	var typ *json.UnmarshalTypeError
+	switch {
+	case err == nil:
+		return nil
+	case errors.As(err, &syntax):
+		// Offset is just past the character that was unexpected
+		line, column := position(data, int(syntax.Offset)-1)
+		return &ParseError{Line: line, Column: column, Message: syntax.Error()}
+	case errors.As(err, &typ):
+		_, offset := jsonOffset(data, splitField(typ.Field))
+		if offset < 0 {
+			offset = int(typ.Offset)
+		}
+		line, column := position(data, offset)
+		return &ParseError{Line: line, Column: column, Message: typeMessage(typ)}
+	}
+	return &ParseError{Message: err.Error()}
+}
+
+func decodeYAML(data []byte, v any) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return yamlError(err)
+	}
+	var tree any
+	if err := root.Decode(&tree); err != nil {
+		return yamlError(err)
+	}
+	converted, err := json.Marshal(tree)
+	if err != nil {
+		return &ParseError{Message: "every key must be a string"}
+	}
+
+	err = json.Unmarshal(converted, v)
+	var typ *json.UnmarshalTypeError
+	if errors.As(err, &typ) {
+		perr := &ParseError{Message: typeMessage(typ)}
+		if _, node := yamlNode(&root, splitField(typ.Field)); node != nil {
+			perr.Line, perr.Column = node.Line, node.Column
+		}
+		return perr
+	}
+	if err != nil {
+		return &ParseError{Message: err.Error()}
+	}
+	return nil
+}
+
+// yamlError turns a yaml.v3 error, which only knows the line, into a
+// ParseError.
+func yamlError(err error) error {
+	m := yamlLinePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return &ParseError{Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+	line, _ := strconv.Atoi(m[1])
+	return &ParseError{Line: line, Message: m[2]}
+}
+
+// yamlNode returns the value at path in a YAML document and, if it is in
+// a mapping, its key; nil if there is no such value.
+func yamlNode(node *yaml.Node, path []string) (key, value *yaml.Node) {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	for _, name := range path {
+		for node.Kind == yaml.AliasNode {
+			node = node.Alias
+		}
+		key = nil
+		var next *yaml.Node
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == name {
+					key, next = node.Content[i], node.Content[i+1]
+				}
+			}
+		case yaml.SequenceNode:
+			if i, err := strconv.Atoi(name); err == nil && i < len(node.Content) {
+				next = node.Content[i]
+			}
+		}
+		if next == nil {
+			return nil, nil
+		}
+		node = next
+	}
+	return key, node
+}
+
+func decodeTOML(data []byte, v any) error {
+	var tree map[string]any
+	if _, err := toml.Decode(string(data), &tree); err != nil {
+		var perr toml.ParseError
+		if !errors.As(err, &perr) {
+			return &ParseError{Message: err.Error()}
+		}
+		line, column := position(data, perr.Position.Start)
+		return &ParseError{Line: line, Column: column, Message: tomlLinePattern.ReplaceAllString(perr.Error(), "")}
+	}
+	converted, err := json.Marshal(tree)
+	if err != nil {
+		return &ParseError{Message: err.Error()}
+	}
+
+	err = json.Unmarshal(converted, v)
+	var typ *json.UnmarshalTypeError
+	if errors.As(err, &typ) {
+		perr := &ParseError{Message: typeMessage(typ)}
+		perr.Line, perr.Column = tomlPosition(data, reflect.TypeOf(v).Elem(), splitField(typ.Field))
+		return perr
+	}
+	if err != nil {
+		return &ParseError{Message: err.Error()}
+	}
+	return nil
+}
+
+// tomlPosition finds the line of the mistyped value at path. The decoded
+// tree has no positions, but the TOML decoder reports the line of a value
+// that doesn't fit the destination, so the data is decoded again into a
+// copy of t that has toml tags.
+func tomlPosition(data []byte, t reflect.Type, path []string) (int, int) {
+	mirror := reflect.New(tomlType(t))
+	_, err := toml.Decode(string(data), mirror.Interface())
+	if err == nil {
+		return 0, 0
+	}
+	m := tomlLinePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0, 0
+	}
+	line, _ := strconv.Atoi(m[1])
+
+	// The value follows "=" after its key, the last name in the path
+	column := 0
+	lines := strings.Split(string(data), "\n")
+	for i := len(path) - 1; i >= 0 && line <= len(lines); i-- {
+		if _, err := strconv.Atoi(path[i]); err == nil {
+			continue
+		}
+		text := lines[line-1]
+		if at := strings.Index(text, path[i]); at >= 0 {
+			column = at + 1
+			if eq := strings.IndexByte(text[at:], '='); eq >= 0 {
+				value := at + eq + 1
+				column = value + len(text[value:]) - len(strings.TrimLeft(text[value:], " \t")) + 1
+			}
+		}
+		break
+	}
+	return line, column
+}
+
+// tomlType returns t with a toml tag next to each json tag.
+func tomlType(t reflect.Type) reflect.Type {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return reflect.PointerTo(tomlType(t.Elem()))
+	case reflect.Slice:
+		return reflect.SliceOf(tomlType(t.Elem()))
+	case reflect.Map:
+		return reflect.MapOf(t.Key(), tomlType(t.Elem()))
+	case reflect.Struct:
+		fields := make([]reflect.StructField, 0, t.NumField())
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "" {
+				name = f.Name
+			}
+			fields = append(fields, reflect.StructField{
+				Name: f.Name,
+				Type: tomlType(f.Type),
+				Tag:  reflect.StructTag(fmt.Sprintf("toml:%q", name)),
+			})
+		}
+		return reflect.StructOf(fields)
+	}
+	return t
+}
+
+// jsonOffset returns the offsets of the value at path in a JSON document
+// and of its key, which is the value's own offset in an array; -1 if there
+// is no such value.
+func jsonOffset(data []byte, path []string) (key, value int) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	key = -1
+	for _, name := range path {
+		tok, err := dec.Token()
+		if err != nil {
+			return -1, -1
+		}
+		found := false
+		switch tok {
+		case json.Delim('{'):
+			for !found && dec.More() {
+				key = skipSeparators(data, int(dec.InputOffset()))
+				tok, err := dec.Token()
+				if err != nil {
+					return -1, -1
+				}
+				if found = tok == name; !found {
+					var skip json.RawMessage
+					if dec.Decode(&skip) != nil {
+						return -1, -1
+					}
+				}
+			}
+		case json.Delim('['):
+			index, err := strconv.Atoi(name)
+			if err != nil {
+				return -1, -1
+			}
+			for i := 0; !found && dec.More(); i++ {
+				if found = i == index; !found {
+					var skip json.RawMessage
+					if dec.Decode(&skip) != nil {
+						return -1, -1
+					}
+				}
+			}
+			key = -1
+		}
+		if !found {
+			return -1, -1
+		}
+	}
+
+	// The decoder stops right after the key or the previous element
+	value = skipSeparators(data, int(dec.InputOffset()))
+	if key < 0 {
+		key = value
+	}
+	return key, value
+}
+
+func skipSeparators(data []byte, offset int) int {
+	for offset < len(data) && strings.IndexByte(" \t\r\n:,", data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+// position returns the 1-based line and column of offset in data.
+func position(data []byte, offset int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(data) {
+		offset = len(data)
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
+
+func splitField(field string) []string {
+	if field == "" {
+		return nil
+	}
+	return strings.Split(field, ".")
+}
+
+// typeMessage describes a value of the wrong type in the terms of the
+// config file rather than Go's.
+func typeMessage(err *json.UnmarshalTypeError) string {
+	expected := err.Type.String()
+	switch err.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		expected = "a whole number"
+	case reflect.Float32, reflect.Float64:
+		expected = "a number"
+	case reflect.String:
+		expected = "a string"
+	case reflect.Bool:
+		expected = "true or false"
+	case reflect.Slice, reflect.Array:
+		expected = "a list"
+	case reflect.Map, reflect.Struct:
+		expected = "a map of keys"
+	}
+
+	got, _, _ := strings.Cut(err.Value, " ")
+	switch got {
+	case "bool":
+		got = "a boolean"
+	case "array":
+		got = "a list"
+	case "object":
+		got = "a map of keys"
+	default:
+		got = "a " + got
+	}
+	message := fmt.Sprintf("got %s, expected %s", got, expected)
+	if err.Field != "" {
+		message = err.Field + ": " + message
+	}
+	return message
+}
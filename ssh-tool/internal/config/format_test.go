@@ -0,0 +1,130 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want string
+	}{
+		{
+			name: "json syntax",
+			file: "servers.json",
+			data: `{
+  "servers": {
+    "api": {"hostname": "10.0.1.10",}
+  }
+}`,
+			want: "servers.json:3:37: invalid character '}' looking for beginning of object key string",
+		},
+		{
+			name: "json type",
+			file: "servers.json",
+			data: `{
+  "servers": {
+    "api": {"hostname": "10.0.1.10", "port": "22"}
+  }
+}`,
+			want: "servers.json:3:46: servers.api.port: got a string, expected a whole number",
+		},
+		{
+			name: "json list element",
+			file: "servers.json",
+			data: `{
+  "servers": {
+    "api": {"tags": ["web", 3]}
+  }
+}`,
+			want: "servers.json:3:29: servers.api.tags.1: got a number, expected a string",
+		},
+		{
+			name: "yaml syntax",
+			file: "servers.yaml",
+			data: "servers:\n  api:\n\thostname: 10.0.1.10\n",
+			// yaml.v3 only reports the line
+			want: "servers.yaml:3: found character that cannot start any token",
+		},
+		{
+			name: "yaml duplicate key",
+			file: "servers.yml",
+			data: "servers:\n  api:\n    hostname: 10.0.1.10\n    hostname: 10.0.1.11\n",
+			want: `servers.yml:4: mapping key "hostname" already defined at line 3`,
+		},
+		{
+			name: "yaml type",
+			file: "servers.yaml",
+			data: "servers:\n  api:\n    hostname: 10.0.1.10\n    port: twenty\n",
+			want: "servers.yaml:4:11: servers.api.port: got a string, expected a whole number",
+		},
+		{
+			name: "yaml list element",
+			file: "servers.yaml",
+			data: "servers:\n  api:\n    tags:\n      - web\n      - [a]\n",
+			want: "servers.yaml:5:9: servers.api.tags.1: got a list, expected a string",
+		},
+		{
+			name: "toml syntax",
+			file: "servers.toml",
+			data: "[servers.api]\nhostname = \"10.0.1.10\"\nuser = \n",
+			want: `servers.toml:3:8: expected value but found '\n' instead`,
+		},
+		{
+			name: "toml duplicate key",
+			file: "servers.toml",
+			data: "[servers.api]\nhostname = \"10.0.1.10\"\nhostname = \"10.0.1.11\"\n",
+			want: "servers.toml:3:1: Key 'servers.api.hostname' has already been defined.",
+		},
+		{
+			name: "toml type",
+			file: "servers.toml",
+			data: "[servers.api]\nhostname = \"10.0.1.10\"\nport = \"22\"\n",
+			want: "servers.toml:3:8: servers.api.port: got a string, expected a whole number",
+		},
+		{
+			name: "toml list element",
+			file: "servers.toml",
+			data: "[servers.api]\nhostname = \"10.0.1.10\"\n  tags = [\"web\", 3]\n",
+			// The position is that of the list, the element has none
+			want: "servers.toml:3:10: servers.api.tags.1: got a number, expected a string",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeLayer(t, t.TempDir(), tt.file, tt.data)
+			_, err := ReadFile(path)
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("ReadFile = %v, want a ParseError", err)
+			}
+			if perr.File != path {
+				t.Errorf("File = %q, want %q", perr.File, path)
+			}
+			perr.File = tt.file
+			if got := perr.Error(); got != tt.want {
+				t.Errorf("error = %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorString(t *testing.T) {
+	tests := []struct {
+		err  ParseError
+		want string
+	}{
+		{ParseError{File: "servers.json", Line: 3, Column: 7, Message: "bad"}, "servers.json:3:7: bad"},
+		{ParseError{File: "servers.yaml", Line: 3, Message: "bad"}, "servers.yaml:3: bad"},
+		{ParseError{File: "embedded", Message: "bad"}, "embedded: bad"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var tomlTablePattern = regexp.MustCompile(`^\[\[?\s*([^\]]*?)\s*\]`)
+
+// UnknownKeys reports every key in file that the config doesn't define,
+// such as a misspelt "pem_fiel", which reading the file silently ignores.
+// A file that doesn't parse returns ReadFile's error.
+func UnknownKeys(file string) ([]*ParseError, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	format := FormatOf(file)
+	var tree any
+	var root yaml.Node
+	switch format {
+	case FormatYAML:
+		if err = yaml.Unmarshal(data, &root); err == nil {
+			err = root.Decode(&tree)
+		}
+	case FormatTOML:
+		var table map[string]any
+		_, err = toml.Decode(string(data), &table)
+		tree = table
+	default:
+		err = json.Unmarshal(data, &tree)
+	}
+	if err != nil {
+		_, err = ReadFile(file)
+		return nil, err
+	}
+
+	var paths [][]string
+	findUnknown(tree, reflect.TypeOf(Config{}), nil, &paths)
+
+	errs := make([]*ParseError, 0, len(paths))
+	for _, path := range paths {
+		where := "at the top level"
+		if len(path) > 1 {
+			where = "in " + strings.Join(path[:len(path)-1], ".")
+		}
+		perr := &ParseError{File: file, Message: fmt.Sprintf("unknown key %q %s", path[len(path)-1], where)}
+		switch format {
+		case FormatYAML:
+			if key, _ := yamlNode(&root, path); key != nil {
+				perr.Line, perr.Column = key.Line, key.Column
+			}
+		case FormatTOML:
+			perr.Line, perr.Column = tomlKeyPosition(data, path)
+		default:
+			if key, _ := jsonOffset(data, path); key >= 0 {
+				perr.Line, perr.Column = position(data, key)
+			}
+		}
+		errs = append(errs, perr)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].Line != errs[j].Line {
+			return errs[i].Line < errs[j].Line
+		}
+		return errs[i].Column < errs[j].Column
+	})
+	return errs, nil
+}
+
+// findUnknown adds to found the path of every key in tree that has no
+// json tag in t.
+func findUnknown(tree any, t reflect.Type, path []string, found *[][]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	at := func(key string) []string {
+		return append(append([]string(nil), path...), key)
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		values, ok := tree.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for key, value := range values {
+			if field, ok := fields[key]; ok {
+				findUnknown(value, field, at(key), found)
+			} else {
+				*found = append(*found, at(key))
+			}
+		}
+	case reflect.Map:
+		values, ok := tree.(map[string]any)
+		if !ok {
+			return
+		}
+		for key, value := range values {
+			findUnknown(value, t.Elem(), at(key), found)
+		}
+	case reflect.Slice:
+		switch items := tree.(type) {
+		case []any:
+			for i, item := range items {
+				findUnknown(item, t.Elem(), at(strconv.Itoa(i)), found)
+			}
+		case []map[string]any:
+			for i, item := range items {
+				findUnknown(item, t.Elem(), at(strconv.Itoa(i)), found)
+			}
+		}
+	}
+}
+
+// tomlKeyPosition finds the line that defines path, as a [table] header,
+// a key = value line in its table or a dotted key. The decoder doesn't
+// expose positions, so the lines are read here.
+func tomlKeyPosition(data []byte, path []string) (int, int) {
+	want := strings.Join(path, ".")
+	table := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		text := strings.TrimSpace(line)
+		column := len(line) - len(strings.TrimLeft(line, " \t")) + 1
+		if m := tomlTablePattern.FindStringSubmatch(text); m != nil {
+			table = tomlKey(m[1])
+			if table == want {
+				return i + 1, column
+			}
+			continue
+		}
+		key, _, ok := strings.Cut(text, "=")
+		if !ok || strings.HasPrefix(text, "#") {
+			continue
+		}
+		full := tomlKey(key)
+		if table != "" {
+			full = table + "." + full
+		}
+		if full == want {
+			return i + 1, column
+		}
+	}
+	return 0, 0
+}
+
+// tomlKey normalises a dotted TOML key such as servers."web-1" .port.
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(part), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+)
+
+const (
+	// SystemConfigBase is the machine-wide config layer, without the
+	// extension: servers.json, .yaml, .yml or .toml.
+	SystemConfigBase = "/etc/ssh-tool/servers"
+	// ProjectConfigBase, with one of Extensions, is looked up in the
+	// working directory and its parents.
+	ProjectConfigBase = ".ssh-tool"
+
+	embeddedOrigin = "embedded"
+)
+
+// Layer is one source in the configuration stack. Optional layers that do
+// not exist are skipped; every other read or parse failure is an error.
+type Layer struct {
+	Path     string
+	Required bool
+	// Project marks a config found in the working directory or above,
+	// which may come with any checked out repository: its hooks and ssh
+	// options that run commands are ignored unless the user trusts it
+	Project bool
+}
+
+func (l Layer) String() string {
+	if l.Path == "" {
+		return embeddedOrigin
+	}
+	return l.Path
+}
+
+// Layers returns the configuration stack from lowest to highest priority:
+// embedded defaults, system config, user config, the nearest project
+// config and finally the file given with --config.
+func Layers(file string) ([]Layer, error) {
+	layers := BaseLayers()
+
+	user, err := UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, Layer{Path: user})
+
+	if project := findProjectConfig(); project != "" {
+		layers = append(layers, Layer{Path: project, Project: true})
+	}
+
+	if file != "" {
+		layers = append(layers, Layer{Path: file, Required: true})
+	}
+	return layers, nil
+}
+
+// BaseLayers returns the layers below the user config, which entries in
+// the user config are merged onto.
+func BaseLayers() []Layer {
+	system := findConfigFile(SystemConfigBase)
+	if system == "" {
+		system = SystemConfigBase + ".json"
+	}
+	return []Layer{{}, {Path: system}}
+}
+
+func findProjectConfig() string {
+	dir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for {
+		if path := findConfigFile(filepath.Join(dir, ProjectConfigBase)); path != "" {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadLayers reads and merges layers in order. Entries are merged by name:
+// every field set in a later layer overrides the same field below it, and
+// so do the fields of defaults and each template and variable. Sessions are
+// replaced as a whole, and so is each list of global hooks. Templates are
+// left for Expand. A project layer that isn't trusted, see Trust, loses its
+// hooks and command options, and is then named in Untrusted.
+func LoadLayers(layers []Layer) (*Config, error) {
+	merged := newMergedConfig()
+
+	for _, layer := range layers {
+		var cfg *Config
+		var err error
+		if layer.Path == "" {
+			cfg, err = parse(embeddedConfig, FormatJSON)
+			if perr, ok := err.(*ParseError); ok {
+				perr.File = embeddedOrigin
+			}
+		} else {
+			var data []byte
+			cfg, data, err = readFile(layer.Path)
+			if os.IsNotExist(err) && !layer.Required {
+				continue
+			}
+			if err == nil && layer.Project && !isTrusted(layer.Path, data) && cfg.dropCommands() {
+				merged.Untrusted = layer.Path
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(cfg, layer.String())
+	}
+
+	return merged, nil
+}
+
+func newMergedConfig() *Config {
+	return &Config{
+		Servers:   make(map[string]Server),
+		Sessions:  make(map[string]Session),
+		Templates: make(map[string]Server),
+		Vars:      make(map[string]string),
+		Origins:   make(map[string][]string),
+	}
+}
+
+// merge overlays cfg, read from origin, onto c.
+func (c *Config) merge(cfg *Config, origin string) {
+	for name, server := range cfg.Servers {
+		if base, ok := c.Servers[name]; ok {
+			server = mergeServer(base, server)
+		}
+		c.Servers[name] = server
+		c.Origins[name] = append(c.Origins[name], origin)
+	}
+	if cfg.Hooks != nil {
+		c.Hooks = mergeHooks(c.Hooks, cfg.Hooks)
+	}
+	for name, session := range cfg.Sessions {
+		c.Sessions[name] = session
+	}
+	if cfg.Defaults != nil {
+		defaults := *cfg.Defaults
+		if c.Defaults != nil {
+			defaults = mergeServer(*c.Defaults, defaults)
+		}
+		c.Defaults = &defaults
+	}
+	for name, template := range cfg.Templates {
+		if base, ok := c.Templates[name]; ok {
+			template = mergeServer(base, template)
+		}
+		c.Templates[name] = template
+	}
+	for name, value := range cfg.Vars {
+		c.Vars[name] = value
+	}
+}
+
+// mergeServer overlays every non-zero field of over onto base.
+func mergeServer(base, over Server) Server {
+	b := reflect.ValueOf(&base).Elem()
+	o := reflect.ValueOf(over)
+	for i := 0; i < o.NumField(); i++ {
+		if !o.Field(i).IsZero() {
+			b.Field(i).Set(o.Field(i))
+		}
+	}
+	return base
+}
+
+func mergeHooks(base, over *Hooks) *Hooks {
+	merged := Hooks{}
+	if base != nil {
+		merged = *base
+	}
+	if len(over.PreConnect) > 0 {
+		merged.PreConnect = over.PreConnect
+	}
+	if len(over.PostDisconnect) > 0 {
+		merged.PostDisconnect = over.PostDisconnect
+	}
+	return &merged
+}
+
+// overOrigin marks the entries of the config merged by MergeOnto.
+const overOrigin = "override"
+
+// MergeOnto returns the servers of over with every field they leave unset
+// taken from the entry of the same name in base, and their templates
+// expanded with those of both. Override files such as the user config may
+// hold partial entries, so they are validated this way.
+func MergeOnto(base, over *Config) (*Config, error) {
+	merged := newMergedConfig()
+	merged.merge(base, "base")
+	merged.merge(over, overOrigin)
+
+	expanded := merged.Expand()
+	// Unlike loading, writes refuse an entry that can't be expanded
+	for _, name := range expanded.SkippedNames() {
+		for _, origin := range merged.Origins[name] {
+			if origin == overOrigin {
+				return nil, expanded.Skipped[name]
+			}
+		}
+	}
+	result := &Config{Servers: make(map[string]Server)}
+	for name, server := range expanded.Servers {
+		for _, origin := range expanded.Origins[name] {
+			if origin == overOrigin {
+				result.Servers[name] = server
+				break
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeServer(t *testing.T) {
+	base := Server{
+		Name: "api", Hostname: "10.0.1.10", User: "ubuntu", Port: 2222, Tags: []string{"web", "eu"},
+		Options: map[string]string{"ServerAliveInterval": "30", "Compression": "yes"},
+		CA:      &CA{Key: "~/.ssh/ca", Principals: []string{"deploy"}},
+		Stale:   true,
+	}
+	over := Server{
+		User: "deploy", Tags: []string{"db"},
+		Options: map[string]string{"Compression": "no"},
+		CA:      &CA{URL: "https://ca.internal/sign"},
+	}
+	want := Server{
+		Name: "api", Hostname: "10.0.1.10", User: "deploy", Port: 2222, Tags: []string{"db"},
+		// Lists, maps and the ca are replaced whole, not merged
+		Options: map[string]string{"Compression": "no"},
+		CA:      &CA{URL: "https://ca.internal/sign"},
+		// A zero value can't be told from an unset one, so it doesn't override
+		Stale: true,
+	}
+	if got := mergeServer(base, over); !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeServer = %+v\nwant %+v", got, want)
+	}
+	if got := mergeServer(base, Server{}); !reflect.DeepEqual(got, base) {
+		t.Errorf("merging an empty entry changed %+v into %+v", base, got)
+	}
+}
+
+func writeLayer(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadLayers(t *testing.T) {
+	dir := t.TempDir()
+	system := writeLayer(t, dir, "system.json", `{
+  "servers": {
+    "api": {"hostname": "10.0.1.10", "user": "ubuntu", "group": "payments"},
+    "db": {"hostname": "10.0.1.20"}
+  },
+  "hooks": {"pre_connect": ["vpn-up"], "post_disconnect": ["vpn-down"]},
+  "sessions": {"all": {"servers": ["api", "db"], "layout": "tiled"}},
+  "vars": {"domain": "prod.internal", "region": "eu-west-2"}
+}`)
+	user := writeLayer(t, dir, "servers.yaml", `
+servers:
+  api:
+    user: deploy
+    tags: [web]
+  cache:
+    hostname: 10.0.1.30
+hooks:
+  pre_connect: [check-token]
+sessions:
+  all:
+    servers: [api]
+`)
+	project := writeLayer(t, dir, ".ssh-tool.toml", `
+[vars]
+region = "us-east-1"
+
+[servers.api]
+port = 2222
+`)
+
+	cfg, err := LoadLayers([]Layer{
+		{Path: system},
+		{Path: user},
+		{Path: filepath.Join(dir, "missing.json")},
+		{Path: project},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Server{
+		"api":   {Name: "api", Hostname: "10.0.1.10", User: "deploy", Group: "payments", Tags: []string{"web"}, Port: 2222},
+		"db":    {Name: "db", Hostname: "10.0.1.20"},
+		"cache": {Name: "cache", Hostname: "10.0.1.30"},
+	}
+	if !reflect.DeepEqual(cfg.Servers, want) {
+		t.Errorf("servers %+v\nwant %+v", cfg.Servers, want)
+	}
+	if want := []string{system, user, project}; !reflect.DeepEqual(cfg.Origins["api"], want) {
+		t.Errorf("api origins %q, want %q", cfg.Origins["api"], want)
+	}
+	if want := []string{user}; !reflect.DeepEqual(cfg.Origins["cache"], want) {
+		t.Errorf("cache origins %q, want %q", cfg.Origins["cache"], want)
+	}
+	// Each hook list is replaced as a whole
+	if want := (&Hooks{PreConnect: []string{"check-token"}, PostDisconnect: []string{"vpn-down"}}); !reflect.DeepEqual(cfg.Hooks, want) {
+		t.Errorf("hooks %+v, want %+v", cfg.Hooks, want)
+	}
+	// Sessions are replaced as a whole
+	if want := (Session{Name: "all", Servers: []string{"api"}}); !reflect.DeepEqual(cfg.Sessions["all"], want) {
+		t.Errorf("session %+v, want %+v", cfg.Sessions["all"], want)
+	}
+	if want := map[string]string{"domain": "prod.internal", "region": "us-east-1"}; !reflect.DeepEqual(cfg.Vars, want) {
+		t.Errorf("vars %q, want %q", cfg.Vars, want)
+	}
+}
+
+func TestLoadLayersErrors(t *testing.T) {
+	dir := t.TempDir()
+	broken := writeLayer(t, dir, "broken.json", `{"servers": {"api": {"port": "22"}}}`)
+
+	tests := []struct {
+		name    string
+		layers  []Layer
+		wantErr string
+	}{
+		{"required file missing", []Layer{{Path: filepath.Join(dir, "missing.json"), Required: true}}, "no such file"},
+		{"optional file broken", []Layer{{Path: broken}}, broken + ":1:30: servers.api.port: got a string, expected a whole number"},
+	}
+	for _, tt := range tests {
+		_, err := LoadLayers(tt.layers)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want one containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
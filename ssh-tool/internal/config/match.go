@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ssh-tool/internal/fuzzy"
+)
+
+// AmbiguousError is returned when a query matches more than one server.
+type AmbiguousError struct {
+	Query   string
+	Matches []Server
+}
+
+func (e *AmbiguousError) Error() string {
+	names := make([]string, 0, len(e.Matches))
+	for _, s := range e.Matches {
+		names = append(names, s.Name)
+	}
+	return fmt.Sprintf("%q matches %d servers: %s", e.Query, len(e.Matches), strings.Join(names, ", "))
+}
+
+// FindServer resolves a query to a single server. The query is tried, in
+// order, as an exact name, a 1-based index into GetServersList, a unique
+// name prefix, a unique substring and finally a fuzzy match on the name.
+func (c *Config) FindServer(query string) (Server, error) {
+	return FindServer(c.GetServersList(), query)
+}
+
+// FindServer resolves a query against servers, which must be in the same
+// order as GetServersList for numeric indexes to line up with `list`.
+func FindServer(servers []Server, query string) (Server, error) {
+	if query == "" {
+		return Server{}, fmt.Errorf("empty server name")
+	}
+
+	for _, s := range servers {
+		if s.Name == query {
+			return s, nil
+		}
+	}
+
+	if num, err := strconv.Atoi(query); err == nil {
+		if num < 1 || num > len(servers) {
+			return Server{}, fmt.Errorf("invalid server number, please choose between 1 and %d", len(servers))
+		}
+		return servers[num-1], nil
+	}
+
+	lower := strings.ToLower(query)
+	stages := []func(Server) bool{
+		func(s Server) bool { return strings.HasPrefix(strings.ToLower(s.Name), lower) },
+		func(s Server) bool { return strings.Contains(strings.ToLower(s.Name), lower) },
+	}
+	for _, match := range stages {
+		var found []Server
+		for _, s := range servers {
+			if match(s) {
+				found = append(found, s)
+			}
+		}
+		switch {
+		case len(found) == 1:
+			return found[0], nil
+		case len(found) > 1:
+			return Server{}, &AmbiguousError{Query: query, Matches: found}
+		}
+	}
+
+	found := MatchServers(servers, query)
+	if len(found) == 0 {
+		return Server{}, fmt.Errorf("no server matches %q", query)
+	}
+	if len(found) > 1 {
+		return Server{}, &AmbiguousError{Query: query, Matches: found}
+	}
+	return found[0], nil
+}
+
+// MatchServers returns the servers whose name fuzzy-matches query, best
+// match first. Ties keep their original order.
+func MatchServers(servers []Server, query string) []Server {
+	type scored struct {
+		server Server
+		score  int
+	}
+
+	var matches []scored
+	for _, s := range servers {
+		if score, ok := fuzzy.Score(query, s.Name); ok {
+			matches = append(matches, scored{s, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	result := make([]Server, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, m.server)
+	}
+	return result
+}
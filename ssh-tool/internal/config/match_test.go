@@ -0,0 +1,74 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func serverNames(servers []Server) []string {
+	names := make([]string, 0, len(servers))
+	for _, s := range servers {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+func TestFindServer(t *testing.T) {
+	servers := []Server{{Name: "prod-api"}, {Name: "prod-api-2"}, {Name: "prod-db"}, {Name: "staging-web"}}
+
+	tests := []struct {
+		query     string
+		want      string
+		ambiguous []string
+		wantErr   string
+	}{
+		// An exact name wins even when it is also a prefix of another name
+		{query: "prod-api", want: "prod-api"},
+		{query: "2", want: "prod-api-2"},
+		{query: "0", wantErr: "please choose between 1 and 4"},
+		{query: "5", wantErr: "please choose between 1 and 4"},
+		{query: "stag", want: "staging-web"},
+		{query: "STAG", want: "staging-web"},
+		{query: "prod", ambiguous: []string{"prod-api", "prod-api-2", "prod-db"}},
+		{query: "web", want: "staging-web"},
+		{query: "api", ambiguous: []string{"prod-api", "prod-api-2"}},
+		{query: "pdb", want: "prod-db"},
+		{query: "sw", want: "staging-web"},
+		// Fuzzy ties keep the list order
+		{query: "pa", ambiguous: []string{"prod-api", "prod-api-2"}},
+		{query: "xyz", wantErr: `no server matches "xyz"`},
+		{query: "", wantErr: "empty server name"},
+	}
+	for _, tt := range tests {
+		got, err := FindServer(servers, tt.query)
+		var ambiguous *AmbiguousError
+		switch {
+		case tt.ambiguous != nil:
+			if !errors.As(err, &ambiguous) {
+				t.Errorf("FindServer(%q) error = %v, want an ambiguous match", tt.query, err)
+			} else if names := serverNames(ambiguous.Matches); !reflect.DeepEqual(names, tt.ambiguous) {
+				t.Errorf("FindServer(%q) matches %q, want %q", tt.query, names, tt.ambiguous)
+			}
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("FindServer(%q) error = %v, want one containing %q", tt.query, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("FindServer(%q): %v", tt.query, err)
+		case got.Name != tt.want:
+			t.Errorf("FindServer(%q) = %s, want %s", tt.query, got.Name, tt.want)
+		}
+	}
+}
+
+func TestMatchServers(t *testing.T) {
+	servers := []Server{{Name: "prod-api"}, {Name: "pxi-b"}, {Name: "api-prod"}, {Name: "pxi-a"}, {Name: "pi"}, {Name: "db"}}
+
+	got := serverNames(MatchServers(servers, "pi"))
+	want := []string{"pi", "pxi-b", "api-prod", "pxi-a", "prod-api"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchServers = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Selector narrows the server list by group, environment and tags. Empty
+// fields match everything; all given tags must be present on a server.
+type Selector struct {
+	Tags        []string
+	Group       string
+	Environment string
+}
+
+func (s Selector) Empty() bool {
+	return len(s.Tags) == 0 && s.Group == "" && s.Environment == ""
+}
+
+func (s Selector) Matches(server Server) bool {
+	if s.Group != "" && !strings.EqualFold(server.Group, s.Group) {
+		return false
+	}
+	if s.Environment != "" && !strings.EqualFold(server.Environment, s.Environment) {
+		return false
+	}
+	for _, want := range s.Tags {
+		if !server.HasTag(want) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	var parts []string
+	if s.Group != "" {
+		parts = append(parts, "group="+s.Group)
+	}
+	if s.Environment != "" {
+		parts = append(parts, "env="+s.Environment)
+	}
+	for _, tag := range s.Tags {
+		parts = append(parts, "tag="+tag)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s Server) HasTag(tag string) bool {
+	for _, t := range s.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Select returns the servers matching sel in GetServersList order.
+func (c *Config) Select(sel Selector) []Server {
+	var servers []Server
+	for _, server := range c.GetServersList() {
+		if sel.Matches(server) {
+			servers = append(servers, server)
+		}
+	}
+	return servers
+}
+
+// Find resolves query among the servers matching sel. Numeric queries keep
+// referring to the unfiltered `list` numbering so that an ID stays the same
+// whichever filters are applied.
+func (c *Config) Find(sel Selector, query string) (Server, error) {
+	if _, ok := c.Servers[query]; !ok {
+		if err := c.skippedError(query); err != nil {
+			return Server{}, err
+		}
+	}
+	if _, err := strconv.Atoi(query); err == nil {
+		server, err := c.FindServer(query)
+		if err != nil {
+			return Server{}, err
+		}
+		if !sel.Matches(server) {
+			return Server{}, fmt.Errorf("server %s does not match %s", server.Name, sel)
+		}
+		return server, nil
+	}
+
+	servers := c.Select(sel)
+	if len(servers) == 0 {
+		return Server{}, fmt.Errorf("no servers match %s", sel)
+	}
+	return FindServer(servers, query)
+}
+
+// Groups returns the distinct group names in use, sorted, with servers
+// that have no group reported under the empty string last. Groups are
+// matched ignoring case, as by Selector, so "Prod" and "prod" are one
+// group, spelt as on the first server that has it.
+func Groups(servers []Server) []string {
+	seen := make(map[string]bool)
+	var groups []string
+	ungrouped := false
+	for _, s := range servers {
+		if s.Group == "" {
+			ungrouped = true
+			continue
+		}
+		if key := strings.ToLower(s.Group); !seen[key] {
+			seen[key] = true
+			groups = append(groups, s.Group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return strings.ToLower(groups[i]) < strings.ToLower(groups[j])
+	})
+	if ungrouped {
+		groups = append(groups, "")
+	}
+	return groups
+}
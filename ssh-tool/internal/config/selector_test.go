@@ -0,0 +1,98 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectorMatches(t *testing.T) {
+	server := Server{Name: "prod-api", Group: "Payments", Environment: "prod", Tags: []string{"web", "EU"}}
+
+	tests := []struct {
+		sel  Selector
+		want bool
+	}{
+		{Selector{}, true},
+		{Selector{Group: "payments"}, true},
+		{Selector{Group: "search"}, false},
+		{Selector{Environment: "PROD"}, true},
+		{Selector{Environment: "staging"}, false},
+		{Selector{Tags: []string{"eu"}}, true},
+		// Every tag must be present
+		{Selector{Tags: []string{"web", "eu"}}, true},
+		{Selector{Tags: []string{"web", "db"}}, false},
+		{Selector{Group: "payments", Environment: "prod", Tags: []string{"web"}}, true},
+		{Selector{Group: "payments", Environment: "staging", Tags: []string{"web"}}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.sel.Matches(server); got != tt.want {
+			t.Errorf("%q.Matches = %v, want %v", tt.sel, got, tt.want)
+		}
+	}
+	if !(Selector{}).Empty() || (Selector{Tags: []string{"web"}}).Empty() {
+		t.Error("Empty reports the wrong result")
+	}
+	if got, want := (Selector{Group: "payments", Environment: "prod", Tags: []string{"web", "eu"}}).String(),
+		"group=payments,env=prod,tag=web,tag=eu"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
+
+func TestGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []Server
+		want    []string
+	}{
+		{"none", nil, nil},
+		{"sorted", []Server{{Group: "search"}, {Group: "payments"}, {Group: "Billing"}}, []string{"Billing", "payments", "search"}},
+		{"first spelling wins", []Server{{Group: "Prod"}, {Group: "prod"}, {Group: "PROD"}}, []string{"Prod"}},
+		{"ungrouped last", []Server{{}, {Group: "search"}, {Group: "payments"}}, []string{"payments", "search", ""}},
+	}
+	for _, tt := range tests {
+		if got := Groups(tt.servers); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Groups = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	cfg := &Config{Servers: map[string]Server{
+		"prod-api":    {Group: "payments", Environment: "prod"},
+		"prod-db":     {Group: "payments", Environment: "prod", Tags: []string{"db"}},
+		"staging-api": {Group: "payments", Environment: "staging"},
+		"search-api":  {Group: "search", Environment: "prod"},
+	}}
+
+	tests := []struct {
+		sel     Selector
+		query   string
+		want    string
+		wantErr string
+	}{
+		{Selector{}, "staging", "staging-api", ""},
+		// The selector narrows the candidates so "api" is no longer ambiguous
+		{Selector{Environment: "staging"}, "api", "staging-api", ""},
+		{Selector{Tags: []string{"db"}}, "prod", "prod-db", ""},
+		// Numbers follow the unfiltered list: search-api is 3rd by name
+		{Selector{Group: "search"}, "3", "search-api", ""},
+		{Selector{Group: "search"}, "1", "", "server prod-api does not match group=search"},
+		{Selector{Group: "billing"}, "api", "", "no servers match group=billing"},
+		{Selector{}, "api", "", "matches 3 servers"},
+	}
+	for _, tt := range tests {
+		got, err := cfg.Find(tt.sel, tt.query)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Find(%q, %q) error = %v, want one containing %q", tt.sel, tt.query, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Find(%q, %q): %v", tt.sel, tt.query, err)
+		} else if got.Name != tt.want {
+			t.Errorf("Find(%q, %q) = %s, want %s", tt.sel, tt.query, got.Name, tt.want)
+		}
+	}
+}
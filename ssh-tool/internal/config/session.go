@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Session is a named set of servers opened side by side with
+// `ssh-tool session open`. Servers are picked by name, by selector or both.
+type Session struct {
+	Name        string   `json:"-"`
+	Servers     []string `json:"servers,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	Environment string   `json:"environment,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Layout is a tmux layout: tiled, even-horizontal, even-vertical,
+	// main-horizontal or main-vertical
+	Layout string `json:"layout,omitempty"`
+	// Sync sends input typed in one pane to all of them
+	Sync bool `json:"sync,omitempty"`
+	// Command runs in every pane instead of a login shell
+	Command string `json:"command,omitempty"`
+}
+
+// Layouts are the tmux layouts a session may use.
+var Layouts = []string{"tiled", "even-horizontal", "even-vertical", "main-horizontal", "main-vertical"}
+
+// DefaultLayout is used when a session sets no layout.
+const DefaultLayout = "tiled"
+
+func (s Session) Selector() Selector {
+	return Selector{Tags: s.Tags, Group: s.Group, Environment: s.Environment}
+}
+
+// SessionServers returns the servers of session: those it names, in that
+// order, followed by the rest matching its selector.
+func (c *Config) SessionServers(session Session) ([]Server, error) {
+	var servers []Server
+	seen := make(map[string]bool)
+	for _, name := range session.Servers {
+		server, ok := c.Servers[name]
+		if !ok {
+			return nil, fmt.Errorf("session %s: server %s not found", session.Name, name)
+		}
+		server.Name = name
+		servers = append(servers, server)
+		seen[name] = true
+	}
+
+	if sel := session.Selector(); !sel.Empty() || len(session.Servers) == 0 {
+		for _, server := range c.Select(sel) {
+			if !seen[server.Name] {
+				servers = append(servers, server)
+			}
+		}
+	}
+	return servers, nil
+}
+
+// SessionNames returns the configured session names, sorted.
+func (c *Config) SessionNames() []string {
+	names := make([]string, 0, len(c.Sessions))
+	for name := range c.Sessions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateSession checks a session entry against the config schema and
+// the servers it names.
+func (c *Config) ValidateSession(session Session) []Issue {
+	var issues []Issue
+	add := func(format string, args ...interface{}) {
+		issues = append(issues, Issue{Server: "session " + session.Name, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !serverNamePattern.MatchString(session.Name) {
+		add("name must start with a letter or digit and contain only letters, digits, '.', '_' and '-'")
+	}
+	if len(session.Servers) == 0 && session.Selector().Empty() {
+		add("needs servers, a group, an environment or tags")
+	}
+	for _, name := range session.Servers {
+		if _, ok := c.Servers[name]; !ok {
+			add("server %s not found", name)
+		}
+	}
+	if session.Layout != "" && !validLayout(session.Layout) {
+		add("layout %q must be one of %v", session.Layout, Layouts)
+	}
+	return issues
+}
+
+func validLayout(layout string) bool {
+	for _, l := range Layouts {
+		if l == layout {
+			return true
+		}
+	}
+	return false
+}
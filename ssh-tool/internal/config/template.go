@@ -0,0 +1,322 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxRangeSize guards against a typo such as {1..10000} creating thousands
+// of servers.
+const maxRangeSize = 1000
+
+var (
+	// rangePattern matches a {1..8} or {use1,euw2} generator in a server
+	// name, but not the braces of ${VAR}
+	rangePattern = regexp.MustCompile(`(^|[^$])(\{[^{}]*\})`)
+	varPattern   = regexp.MustCompile(`\$\$|\$\{([^{}]*)\}`)
+)
+
+// Expand turns the templated entries of a merged config into concrete
+// servers:
+//
+//   - every server inherits the fields of "defaults",
+//   - "extends" names a template, or another server, whose fields are
+//     inherited in turn; the entry's own fields win over both,
+//   - a name such as web-{1..8} or api-{use1,euw2} creates one server per
+//     value, with the same {...} in its fields replaced by the value, and
+//   - ${VAR} in hostname, user, pem_file, proxy_jump and description is
+//     replaced with the value from "vars", ${env:VAR} with the environment
+//     variable and ${name} with the server's name; $$ is a literal $.
+//
+// An entry named like a generated server, e.g. web-3, overrides fields of
+// that server. The result has no templates left. An entry that can't be
+// expanded, say for an undefined variable, is left out and the reason
+// recorded in Skipped, so one mistake doesn't make every server unusable.
+func (c *Config) Expand() *Config {
+	expanded := &Config{
+		Servers:   make(map[string]Server),
+		Hooks:     c.Hooks,
+		Sessions:  c.Sessions,
+		Origins:   make(map[string][]string),
+		Skipped:   make(map[string]error),
+		Untrusted: c.Untrusted,
+	}
+	t := templater{config: c}
+
+	var patterns, names []string
+	for name := range c.Servers {
+		if rangePattern.MatchString(name) {
+			patterns = append(patterns, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(patterns)
+	sort.Strings(names)
+
+patterns:
+	for _, pattern := range patterns {
+		group, values, err := parseRange(pattern)
+		if err != nil {
+			expanded.Skipped[pattern] = err
+			continue
+		}
+		server, err := t.resolve(c.Servers[pattern], map[string]bool{})
+		if err != nil {
+			expanded.Skipped[pattern] = fmt.Errorf("server %s: %v", pattern, err)
+			continue
+		}
+		generated := make([]Server, len(values))
+		for i, value := range values {
+			generated[i] = replaceRange(server, group, value)
+			generated[i].Name = strings.Replace(pattern, group, value, 1)
+			if _, ok := expanded.Servers[generated[i].Name]; ok {
+				expanded.Skipped[pattern] = fmt.Errorf("server %s: %s is also generated by another range", pattern, generated[i].Name)
+				continue patterns
+			}
+		}
+		for _, server := range generated {
+			expanded.Servers[server.Name] = server
+			expanded.Origins[server.Name] = append([]string(nil), c.Origins[pattern]...)
+		}
+	}
+
+	for _, name := range names {
+		entry := c.Servers[name]
+		var server Server
+		if generated, ok := expanded.Servers[name]; ok {
+			// Only the entry's own fields and what it extends override the
+			// generated server, not the defaults again
+			own, err := t.inherit(entry, map[string]bool{name: true})
+			if err != nil {
+				expanded.skip(name, err)
+				continue
+			}
+			server = mergeServer(generated, own)
+		} else {
+			var err error
+			if server, err = t.resolve(entry, map[string]bool{name: true}); err != nil {
+				expanded.skip(name, err)
+				continue
+			}
+		}
+		server.Name = name
+		expanded.Servers[name] = server
+		expanded.Origins[name] = append(expanded.Origins[name], c.Origins[name]...)
+	}
+
+	for name, server := range expanded.Servers {
+		if err := t.expandVars(&server); err != nil {
+			expanded.skip(name, err)
+			continue
+		}
+		expanded.Servers[name] = server
+	}
+	return expanded
+}
+
+// skip leaves the server name out of an expanded config.
+func (c *Config) skip(name string, err error) {
+	delete(c.Servers, name)
+	delete(c.Origins, name)
+	c.Skipped[name] = fmt.Errorf("server %s: %v", name, err)
+}
+
+// SkippedNames returns the entries Expand left out, sorted.
+func (c *Config) SkippedNames() []string {
+	names := make([]string, 0, len(c.Skipped))
+	for name := range c.Skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// skippedError explains why name isn't a server, if Expand left it out,
+// either itself or the range entry that generates it.
+func (c *Config) skippedError(name string) error {
+	if err, ok := c.Skipped[name]; ok {
+		return fmt.Errorf("%v, so it was skipped", err)
+	}
+	for pattern, err := range c.Skipped {
+		if !rangePattern.MatchString(pattern) {
+			continue
+		}
+		group, values, perr := parseRange(pattern)
+		if perr != nil {
+			continue
+		}
+		for _, value := range values {
+			if strings.Replace(pattern, group, value, 1) == name {
+				return fmt.Errorf("%v, so %s was skipped", err, name)
+			}
+		}
+	}
+	return nil
+}
+
+type templater struct {
+	config *Config
+}
+
+// resolve returns server with its defaults and extends applied.
+func (t templater) resolve(server Server, seen map[string]bool) (Server, error) {
+	own, err := t.inherit(server, seen)
+	if err != nil {
+		return Server{}, err
+	}
+	if t.config.Defaults == nil {
+		return own, nil
+	}
+	return mergeServer(*t.config.Defaults, own), nil
+}
+
+// inherit applies the chain of extends to server. seen holds the entries
+// on the chain so far, to catch loops.
+func (t templater) inherit(server Server, seen map[string]bool) (Server, error) {
+	parent := server.Extends
+	server.Extends = ""
+	if parent == "" {
+		return server, nil
+	}
+	if seen[parent] {
+		return Server{}, fmt.Errorf("extends %s in a loop", parent)
+	}
+	seen[parent] = true
+
+	base, ok := t.config.Templates[parent]
+	if !ok {
+		if base, ok = t.config.Servers[parent]; !ok {
+			return Server{}, fmt.Errorf("extends %s, which is neither a template nor a server", parent)
+		}
+	}
+	base, err := t.inherit(base, seen)
+	if err != nil {
+		return Server{}, err
+	}
+	name := server.Name
+	server = mergeServer(base, server)
+	server.Name = name
+	return server, nil
+}
+
+// templatedFields returns the fields that ranges and variables apply to.
+func templatedFields(server *Server) map[string]*string {
+	return map[string]*string{
+		"hostname":    &server.Hostname,
+		"user":        &server.User,
+		"pem_file":    &server.PemFile,
+		"proxy_jump":  &server.ProxyJump,
+		"description": &server.Description,
+	}
+}
+
+func replaceRange(server Server, group, value string) Server {
+	for _, field := range templatedFields(&server) {
+		*field = strings.ReplaceAll(*field, group, value)
+	}
+	return server
+}
+
+func (t templater) expandVars(server *Server) error {
+	fields := templatedFields(server)
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := t.expand(*fields[key], server.Name, 0)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		*fields[key] = value
+	}
+	return nil
+}
+
+// expand replaces the variables in s. Values from "vars" may use other
+// variables themselves; depth stops a variable that refers to itself.
+func (t templater) expand(s, name string, depth int) (string, error) {
+	if depth > 10 {
+		return "", fmt.Errorf("variables refer to each other in a loop")
+	}
+
+	var err error
+	result := varPattern.ReplaceAllStringFunc(s, func(match string) string {
+		if err != nil {
+			return ""
+		}
+		if match == "$$" {
+			return "$"
+		}
+		key := match[2 : len(match)-1]
+		if env, ok := strings.CutPrefix(key, "env:"); ok {
+			value, set := os.LookupEnv(env)
+			if !set {
+				err = fmt.Errorf("environment variable %s is not set", env)
+			}
+			return value
+		}
+		if key == "name" {
+			return name
+		}
+		value, ok := t.config.Vars[key]
+		if !ok {
+			err = fmt.Errorf("undefined variable ${%s}, define it under \"vars\"", key)
+			return ""
+		}
+		var expanded string
+		expanded, err = t.expand(value, name, depth+1)
+		return expanded
+	})
+	return result, err
+}
+
+// parseRange finds the single {...} generator in a server name and returns
+// it with the values it stands for: {1..8}, zero-padded as in {01..08}, or
+// a list such as {use1,euw2}.
+func parseRange(name string) (string, []string, error) {
+	matches := rangePattern.FindAllStringSubmatch(name, -1)
+	if len(matches) > 1 {
+		return "", nil, fmt.Errorf("server %s: only one {...} range is allowed per name", name)
+	}
+	group := matches[0][2]
+	body := group[1 : len(group)-1]
+
+	if from, to, ok := strings.Cut(body, ".."); ok {
+		start, err1 := strconv.Atoi(from)
+		end, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || start > end {
+			return "", nil, fmt.Errorf("server %s: range %s must be {first..last} with first <= last", name, group)
+		}
+		if end-start >= maxRangeSize {
+			return "", nil, fmt.Errorf("server %s: range %s creates more than %d servers", name, group, maxRangeSize)
+		}
+		width := 0
+		if len(from) > 1 && strings.HasPrefix(from, "0") {
+			width = len(from)
+		}
+		var values []string
+		for i := start; i <= end; i++ {
+			values = append(values, fmt.Sprintf("%0*d", width, i))
+		}
+		return group, values, nil
+	}
+
+	values := strings.Split(body, ",")
+	if len(values) < 2 {
+		return "", nil, fmt.Errorf("server %s: %s must be a range such as {1..8} or a list such as {a,b}", name, group)
+	}
+	for _, value := range values {
+		if value == "" {
+			return "", nil, fmt.Errorf("server %s: list %s has an empty value", name, group)
+		}
+	}
+	return group, values, nil
+}
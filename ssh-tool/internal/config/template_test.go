@@ -0,0 +1,189 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   string
+		values  []string
+		wantErr string
+	}{
+		{name: "web-{1..3}", group: "{1..3}", values: []string{"1", "2", "3"}},
+		{name: "web-{08..11}", group: "{08..11}", values: []string{"08", "09", "10", "11"}},
+		{name: "db-{001..002}.eu", group: "{001..002}", values: []string{"001", "002"}},
+		// A single 0 isn't padding
+		{name: "web-{0..2}", group: "{0..2}", values: []string{"0", "1", "2"}},
+		{name: "api-{use1,euw2}", group: "{use1,euw2}", values: []string{"use1", "euw2"}},
+		{name: "api-{a,b}-${domain}", group: "{a,b}", values: []string{"a", "b"}},
+		{name: "web-{3..1}", wantErr: "range {3..1} must be {first..last} with first <= last"},
+		{name: "web-{a..c}", wantErr: "range {a..c} must be {first..last}"},
+		{name: "web-{1..1000}", group: "{1..1000}"},
+		{name: "web-{0..1000}", wantErr: "range {0..1000} creates more than 1000 servers"},
+		{name: "api-{use1,,euw2}", wantErr: "list {use1,,euw2} has an empty value"},
+		{name: "api-{use1,}", wantErr: "list {use1,} has an empty value"},
+		{name: "api-{use1}", wantErr: "{use1} must be a range such as {1..8} or a list such as {a,b}"},
+		{name: "web-{1..2}-{a,b}", wantErr: "only one {...} range is allowed per name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, values, err := parseRange(tt.name)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseRange(%q) error = %v, want %q", tt.name, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRange(%q): %v", tt.name, err)
+			}
+			if group != tt.group {
+				t.Errorf("group = %q, want %q", group, tt.group)
+			}
+			if tt.values == nil {
+				if len(values) != maxRangeSize {
+					t.Errorf("got %d values, want %d", len(values), maxRangeSize)
+				}
+			} else if !reflect.DeepEqual(values, tt.values) {
+				t.Errorf("values = %q, want %q", values, tt.values)
+			}
+		})
+	}
+}
+
+func TestExpandString(t *testing.T) {
+	t.Setenv("SSH_TOOL_TEST_USER", "alice")
+	tmpl := templater{config: &Config{Vars: map[string]string{
+		"domain": "prod.internal",
+		"fqdn":   "${name}.${domain}",
+		"loop":   "${loop}",
+		"ping":   "${pong}",
+		"pong":   "${ping}",
+	}}}
+
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{in: "10.0.1.10", want: "10.0.1.10"},
+		{in: "${name}.${domain}", want: "web-1.prod.internal"},
+		// Variables may use other variables
+		{in: "${fqdn}", want: "web-1.prod.internal"},
+		{in: "$$HOME and $${domain}", want: "$HOME and ${domain}"},
+		{in: "cost $5", want: "cost $5"},
+		{in: "${env:SSH_TOOL_TEST_USER}", want: "alice"},
+		{in: "${env:SSH_TOOL_TEST_UNSET}", wantErr: "environment variable SSH_TOOL_TEST_UNSET is not set"},
+		{in: "${region}", wantErr: `undefined variable ${region}, define it under "vars"`},
+		{in: "${loop}", wantErr: "variables refer to each other in a loop"},
+		{in: "${ping}", wantErr: "variables refer to each other in a loop"},
+	}
+
+	for _, tt := range tests {
+		got, err := tmpl.expand(tt.in, "web-1", 0)
+		if tt.wantErr != "" {
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("expand(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("expand(%q): %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	cfg := &Config{
+		Defaults: &Server{User: "ubuntu", Port: 22, Group: "default"},
+		Templates: map[string]Server{
+			"base-prod": {User: "deploy", Environment: "prod", PemFile: "~/.ssh/${env}.pem"},
+		},
+		Vars: map[string]string{"domain": "prod.internal", "env": "prod"},
+		Servers: map[string]Server{
+			"web-{1..3}": {Extends: "base-prod", Hostname: "web-{1..3}.${domain}", Description: "web {1..3} of 3"},
+			// Overrides the generated web-2 without applying the defaults
+			// over the template's user again
+			"web-2":     {Hostname: "10.0.2.2", Group: "canary"},
+			"bastion":   {Hostname: "bastion.${domain}"},
+			"api":       {Extends: "bastion", Port: 2222},
+			"broken":    {Hostname: "${region}.example.com"},
+			"db-{1,}":   {Hostname: "db"},
+			"loop-a":    {Extends: "loop-b"},
+			"loop-b":    {Extends: "loop-a"},
+			"orphan":    {Extends: "nowhere"},
+			"dup-{1,2}": {Hostname: "one"},
+			"dup-{2,3}": {Hostname: "two"},
+		},
+		Origins: map[string][]string{"web-{1..3}": {"user"}, "web-2": {"project"}},
+	}
+
+	expanded := cfg.Expand()
+
+	want := map[string]Server{
+		"web-1": {
+			Name: "web-1", Hostname: "web-1.prod.internal", User: "deploy", Port: 22, Group: "default",
+			Environment: "prod", PemFile: "~/.ssh/prod.pem", Description: "web 1 of 3",
+		},
+		"web-2": {
+			Name: "web-2", Hostname: "10.0.2.2", User: "deploy", Port: 22, Group: "canary",
+			Environment: "prod", PemFile: "~/.ssh/prod.pem", Description: "web 2 of 3",
+		},
+		"web-3": {
+			Name: "web-3", Hostname: "web-3.prod.internal", User: "deploy", Port: 22, Group: "default",
+			Environment: "prod", PemFile: "~/.ssh/prod.pem", Description: "web 3 of 3",
+		},
+		"bastion": {Name: "bastion", Hostname: "bastion.prod.internal", User: "ubuntu", Port: 22, Group: "default"},
+		// Extends the server's own fields, not what the defaults gave it
+		"api": {Name: "api", Hostname: "bastion.prod.internal", User: "ubuntu", Port: 2222, Group: "default"},
+		// dup-{1,2} sorts first and keeps its servers
+		"dup-1": {Name: "dup-1", Hostname: "one", User: "ubuntu", Port: 22, Group: "default"},
+		"dup-2": {Name: "dup-2", Hostname: "one", User: "ubuntu", Port: 22, Group: "default"},
+	}
+	if !reflect.DeepEqual(expanded.Servers, want) {
+		for name, server := range expanded.Servers {
+			if !reflect.DeepEqual(server, want[name]) {
+				t.Errorf("%s = %+v\nwant %+v", name, server, want[name])
+			}
+		}
+		for name := range want {
+			if _, ok := expanded.Servers[name]; !ok {
+				t.Errorf("%s is missing", name)
+			}
+		}
+	}
+
+	skipped := map[string]string{
+		"broken":    `server broken: hostname: undefined variable ${region}, define it under "vars"`,
+		"db-{1,}":   "server db-{1,}: list {1,} has an empty value",
+		"loop-a":    "server loop-a: extends loop-a in a loop",
+		"loop-b":    "server loop-b: extends loop-b in a loop",
+		"orphan":    "server orphan: extends nowhere, which is neither a template nor a server",
+		"dup-{2,3}": "server dup-{2,3}: dup-2 is also generated by another range",
+	}
+	if names := expanded.SkippedNames(); len(names) != len(skipped) {
+		t.Errorf("skipped %q, want %d entries", names, len(skipped))
+	}
+	for name, msg := range skipped {
+		if err := expanded.Skipped[name]; err == nil || err.Error() != msg {
+			t.Errorf("Skipped[%s] = %v, want %q", name, err, msg)
+		}
+	}
+
+	if got, want := expanded.Origins["web-2"], []string{"user", "project"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("web-2 origins = %q, want %q", got, want)
+	}
+	if err := expanded.skippedError("db-1"); err != nil {
+		t.Errorf("skippedError(db-1) = %v, want nil as the range can't be parsed", err)
+	}
+	if err := expanded.skippedError("dup-3"); err == nil || !strings.Contains(err.Error(), "so dup-3 was skipped") {
+		t.Errorf("skippedError(dup-3) = %v, want it skipped with its range", err)
+	}
+}
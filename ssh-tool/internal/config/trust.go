@@ -0,0 +1,171 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// commandOptions are the ssh options that run local commands or load
+// libraries. Like hooks, a project config only gets to set them once the
+// user trusts it.
+var commandOptions = []string{
+	"KnownHostsCommand",
+	"LocalCommand",
+	"PermitLocalCommand",
+	"PKCS11Provider",
+	"ProxyCommand",
+	"SecurityKeyProvider",
+}
+
+// UntrustedMessage explains that the hooks and command options of the
+// project config at path were ignored.
+func UntrustedMessage(path string) string {
+	return fmt.Sprintf("ignoring hooks and ssh options that run commands in %s, review it and run 'ssh-tool config trust' to allow them", path)
+}
+
+// ProjectConfigPath returns the project config that applies in the working
+// directory, or "" if there is none.
+func ProjectConfigPath() string {
+	return findProjectConfig()
+}
+
+// trustPath returns the file holding the hashes of the trusted project
+// configs.
+func trustPath() (string, error) {
+	dir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "trusted.json"), nil
+}
+
+func readTrusted() (map[string]string, error) {
+	path, err := trustPath()
+	if err != nil {
+		return nil, err
+	}
+	trusted := make(map[string]string)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return trusted, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &trusted); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return trusted, nil
+}
+
+func writeTrusted(trusted map[string]string) error {
+	path, err := trustPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(trusted, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ReplaceFile(path, append(data, '\n'))
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isTrusted reports whether the project config at path was trusted with
+// exactly this content; any change to the file needs trusting again.
+func isTrusted(path string, data []byte) bool {
+	trusted, err := readTrusted()
+	return err == nil && trusted[path] == contentHash(data)
+}
+
+// Trust records the project config at path, as it is now, as allowed to
+// run commands.
+func Trust(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := parse(data, FormatOf(path)); err != nil {
+		if perr, ok := err.(*ParseError); ok {
+			perr.File = path
+		}
+		return err
+	}
+
+	trusted, err := readTrusted()
+	if err != nil {
+		return err
+	}
+	trusted[path] = contentHash(data)
+	return writeTrusted(trusted)
+}
+
+// Untrust forgets a trusted project config and reports whether it was
+// trusted.
+func Untrust(path string) (bool, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	trusted, err := readTrusted()
+	if err != nil {
+		return false, err
+	}
+	if _, ok := trusted[path]; !ok {
+		return false, nil
+	}
+	delete(trusted, path)
+	return true, writeTrusted(trusted)
+}
+
+// dropCommands removes the hooks and command options from a config that
+// isn't trusted, and reports whether it had any.
+func (c *Config) dropCommands() bool {
+	dropped := false
+	if c.Hooks != nil {
+		c.Hooks, dropped = nil, true
+	}
+	clean := func(server *Server) {
+		if server.Hooks != nil {
+			server.Hooks, dropped = nil, true
+		}
+		for key := range server.Options {
+			for _, option := range commandOptions {
+				if strings.EqualFold(key, option) {
+					delete(server.Options, key)
+					dropped = true
+				}
+			}
+		}
+		// An empty map would replace the options of lower layers
+		if len(server.Options) == 0 {
+			server.Options = nil
+		}
+	}
+
+	for name, server := range c.Servers {
+		clean(&server)
+		c.Servers[name] = server
+	}
+	for name, template := range c.Templates {
+		clean(&template)
+		c.Templates[name] = template
+	}
+	if c.Defaults != nil {
+		clean(c.Defaults)
+	}
+	return dropped
+}
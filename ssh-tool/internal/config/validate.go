@@ -0,0 +1,251 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"ssh-tool/internal/secrets"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single problem found by Validate.
+type Issue struct {
+	Server   string
+	Severity Severity
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Server == "" {
+		return fmt.Sprintf("%s: %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Server, i.Message)
+}
+
+var (
+	serverNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	optionNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*$`)
+	envNamePattern    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	instanceIDPattern = regexp.MustCompile(`^m?i-[0-9a-f]{8,17}$`)
+)
+
+// ValidateServer checks a single entry against the config schema. These
+// are the problems that make an entry unusable, so writes refuse them.
+func ValidateServer(server Server) []Issue {
+	var issues []Issue
+	add := func(format string, args ...interface{}) {
+		issues = append(issues, Issue{Server: server.Name, Severity: SeverityError, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !serverNamePattern.MatchString(server.Name) {
+		add("name must start with a letter or digit and contain only letters, digits, '.', '_' and '-'")
+	}
+	if _, err := strconv.Atoi(server.Name); err == nil {
+		add("name must not be a number, numbers select servers by list position")
+	}
+	if server.Hostname == "" {
+		add("hostname is required")
+	}
+	if server.User == "" {
+		add("user is required")
+	}
+	if server.Port < 0 || server.Port > 65535 {
+		add("port %d is out of range", server.Port)
+	}
+	for key := range server.Options {
+		if !optionNamePattern.MatchString(key) {
+			add("invalid ssh option name %q", key)
+		}
+	}
+	for key := range server.Env {
+		if !envNamePattern.MatchString(key) {
+			add("invalid environment variable name %q", key)
+		}
+	}
+	for _, tag := range server.Tags {
+		if tag == "" {
+			add("tags must not be empty")
+		}
+	}
+	for _, pin := range server.HostKeys {
+		if fields := strings.Fields(pin); len(fields) == 0 || len(fields) > 2 || !strings.HasPrefix(fields[len(fields)-1], "SHA256:") {
+			add("host key %q must be a SHA256 fingerprint, e.g. \"ssh-ed25519 SHA256:...\"", pin)
+		}
+	}
+	if idle := server.MuxIdle; idle != "" && idle != "off" && idle != "no" && idle != "0" {
+		if d, err := time.ParseDuration(idle); err != nil || d <= 0 {
+			add("mux_idle %q is not a duration such as 10m, or off", idle)
+		}
+	}
+	if ca := server.CA; ca != nil {
+		if (ca.Key == "") == (ca.URL == "") {
+			add("ca needs exactly one of key or url")
+		}
+		if ca.URL != "" && !strings.HasPrefix(ca.URL, "https://") && !strings.HasPrefix(ca.URL, "http://") {
+			add("ca url %q must be an http(s) URL", ca.URL)
+		}
+		if ca.TTL != "" {
+			if d, err := time.ParseDuration(ca.TTL); err != nil || d <= 0 {
+				add("ca ttl %q is not a duration such as 30m or 8h", ca.TTL)
+			}
+		}
+		if server.PemFile == "" {
+			add("ca needs a pem_file to certify")
+		}
+	}
+	switch server.Transport {
+	case "", TransportSSH:
+	case TransportSSM:
+		if !instanceIDPattern.MatchString(server.InstanceID) {
+			add("transport ssm needs an instance_id such as i-0123456789abcdef0")
+		}
+		if server.ProxyJump != "" {
+			add("transport ssm can't be combined with proxy_jump")
+		}
+	default:
+		add("transport %q must be ssh or ssm", server.Transport)
+	}
+	for _, message := range checkHooks(server.Hooks) {
+		add("%s", message)
+	}
+	return issues
+}
+
+func checkHooks(hooks *Hooks) []string {
+	if hooks == nil {
+		return nil
+	}
+	var messages []string
+	for stage, commands := range map[string][]string{"pre_connect": hooks.PreConnect, "post_disconnect": hooks.PostDisconnect} {
+		for _, command := range commands {
+			if strings.TrimSpace(command) == "" {
+				messages = append(messages, fmt.Sprintf("hooks.%s commands must not be empty", stage))
+			}
+		}
+	}
+	sort.Strings(messages)
+	return messages
+}
+
+// Validate checks every entry against the schema and the environment:
+// entries Expand skipped, duplicate hostnames, missing key files and key
+// files ssh would refuse.
+func (c *Config) Validate() []Issue {
+	var issues []Issue
+	hosts := make(map[string][]string)
+
+	for _, name := range c.SkippedNames() {
+		issues = append(issues, Issue{Severity: SeverityError, Message: c.Skipped[name].Error() + ", every command skips it"})
+	}
+	if c.Untrusted != "" {
+		issues = append(issues, Issue{Severity: SeverityWarning, Message: UntrustedMessage(c.Untrusted)})
+	}
+	for _, server := range c.GetServersList() {
+		issues = append(issues, ValidateServer(server)...)
+		if server.Hostname != "" {
+			hosts[server.Hostname] = append(hosts[server.Hostname], server.Name)
+		}
+		issues = append(issues, CheckKeyFile(server)...)
+	}
+	for _, message := range checkHooks(c.Hooks) {
+		issues = append(issues, Issue{Severity: SeverityError, Message: message})
+	}
+	for _, name := range c.SessionNames() {
+		issues = append(issues, c.ValidateSession(c.Sessions[name])...)
+	}
+
+	var duplicates []string
+	for host, names := range hosts {
+		if len(names) > 1 {
+			duplicates = append(duplicates, host)
+		}
+	}
+	sort.Strings(duplicates)
+	for _, host := range duplicates {
+		for _, name := range hosts[host] {
+			issues = append(issues, Issue{
+				Server:   name,
+				Severity: SeverityWarning,
+				Message:  fmt.Sprintf("hostname %s is also used by %v", host, others(hosts[host], name)),
+			})
+		}
+	}
+
+	return issues
+}
+
+// CheckKeyFile reports a missing, unreadable or world-readable pem_file.
+func CheckKeyFile(server Server) []Issue {
+	if server.PemFile == "" {
+		return nil
+	}
+	issue := func(severity Severity, format string, args ...interface{}) []Issue {
+		return []Issue{{Server: server.Name, Severity: severity, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	// Secrets are only fetched when connecting
+	if secrets.IsReference(server.PemFile) {
+		if err := secrets.Check(server.PemFile); err != nil {
+			return issue(SeverityError, "%v", err)
+		}
+		return nil
+	}
+
+	path, err := ExpandPath(server.PemFile)
+	if err != nil {
+		return issue(SeverityError, "%v", err)
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return issue(SeverityWarning, "key file %s does not exist", server.PemFile)
+	}
+	if err != nil {
+		return issue(SeverityError, "key file %s: %v", server.PemFile, err)
+	}
+	if info.IsDir() {
+		return issue(SeverityError, "key file %s is a directory", server.PemFile)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return issue(SeverityError, "key file %s is not readable: %v", server.PemFile, err)
+	}
+	f.Close()
+
+	// ssh ignores private keys that other users can read
+	if perm := info.Mode().Perm(); perm&0o077 != 0 {
+		return issue(SeverityError, "key file %s has permissions %04o, ssh requires 0600 or stricter", server.PemFile, perm)
+	}
+	return nil
+}
+
+func others(names []string, self string) []string {
+	var result []string
+	for _, name := range names {
+		if name != self {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// HasErrors reports whether any issue is an error rather than a warning.
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
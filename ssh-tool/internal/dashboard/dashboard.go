@@ -0,0 +1,457 @@
+// Package dashboard is the full-screen server browser behind `ssh-tool ui`:
+// a searchable list, a detail pane and live reachability. It only picks
+// what to do; the caller runs the session and then shows the dashboard
+// again with Next.
+package dashboard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"ssh-tool/internal/ansi"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/fuzzy"
+	"ssh-tool/internal/health"
+	"ssh-tool/internal/state"
+
+	"golang.org/x/term"
+)
+
+const (
+	// checkInterval is how often reachability is probed again
+	checkInterval = 30 * time.Second
+	checkTimeout  = 3 * time.Second
+	// splitWidth is the terminal width from which the detail pane is shown
+	// next to the list rather than below it
+	splitWidth = 100
+	detailRows = 9
+)
+
+const (
+	ActionQuit    = "quit"
+	ActionConnect = "connect"
+	ActionExec    = "exec"
+	ActionCopy    = "copy"
+	ActionTunnel  = "tunnel"
+)
+
+// Action is what the user chose to do.
+type Action struct {
+	Kind   string
+	Server config.Server
+	// Input is what was typed at the prompt: the command for exec, the
+	// scp arguments for copy, with ":" standing for the server, or the
+	// -L/-R/-D forwards for tunnel
+	Input string
+}
+
+var errInput = errors.New("error reading input")
+
+// prompt is the input line asking for the details of an action.
+type prompt struct {
+	kind  string
+	label string
+	hint  string
+	text  string
+}
+
+// Dashboard keeps the list position, search and reachability between
+// sessions.
+type Dashboard struct {
+	servers   []config.Server
+	st        *state.State
+	query     string
+	searching bool
+	visible   []int
+	cursor    int
+	offset    int
+	prompt    *prompt
+	message   string
+
+	mu       sync.Mutex
+	results  map[string]health.Result
+	checking bool
+	updated  chan struct{}
+	recheck  chan struct{}
+	stop     chan struct{}
+
+	// stdin is only read on request, so no read is pending while a
+	// session owns the terminal. inputDone is closed, and keys with it,
+	// once reading fails.
+	want      chan struct{}
+	keys      chan []byte
+	inputDone chan struct{}
+}
+
+// New creates a dashboard over servers and starts probing them.
+func New(servers []config.Server, st *state.State) *Dashboard {
+	st.SortFavoritesFirst(servers)
+	d := &Dashboard{
+		servers: servers,
+		st:      st,
+		results: make(map[string]health.Result),
+		updated: make(chan struct{}, 1),
+		recheck: make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		want:    make(chan struct{}),
+		keys:    make(chan []byte),
+
+		inputDone: make(chan struct{}),
+	}
+	d.filter()
+	go d.readInput()
+	go d.probe()
+	return d
+}
+
+// Close stops the reachability checks.
+func (d *Dashboard) Close() {
+	close(d.stop)
+}
+
+// SetState refreshes favourites and last connections, e.g. after a session.
+func (d *Dashboard) SetState(st *state.State) {
+	d.st = st
+}
+
+// Next shows the dashboard until the user picks an action. The terminal
+// is back to normal when it returns.
+func (d *Dashboard) Next() (Action, error) {
+	fd := int(os.Stdin.Fd())
+	saved, err := term.MakeRaw(fd)
+	if err != nil {
+		return Action{}, fmt.Errorf("error switching terminal to raw mode: %v", err)
+	}
+	defer term.Restore(fd, saved)
+
+	fmt.Print(ansi.AltScreenOn + ansi.CursorHide)
+	defer fmt.Print(ansi.CursorShow + ansi.AltScreenOff)
+
+	resized := make(chan os.Signal, 1)
+	signal.Notify(resized, syscall.SIGWINCH)
+	defer signal.Stop(resized)
+
+	if !d.requestInput() {
+		return Action{}, errInput
+	}
+	for {
+		d.render()
+		select {
+		case input, ok := <-d.keys:
+			if !ok {
+				return Action{}, errInput
+			}
+			if action, done := d.handle(input); done {
+				return action, nil
+			}
+			if !d.requestInput() {
+				return Action{}, errInput
+			}
+		case <-d.updated:
+		case <-resized:
+		}
+	}
+}
+
+// Wait shows message below a session's output until a key is pressed.
+func (d *Dashboard) Wait(message string) {
+	fd := int(os.Stdin.Fd())
+	if saved, err := term.MakeRaw(fd); err == nil {
+		defer term.Restore(fd, saved)
+	}
+	fmt.Printf("\r\n%s%s%s", ansi.Dim, message, ansi.Reset)
+	if d.requestInput() {
+		<-d.keys
+	}
+	fmt.Print("\r\n")
+}
+
+// requestInput asks readInput for the next read. It returns false once
+// reading has failed, as nothing is left to take the request.
+func (d *Dashboard) requestInput() bool {
+	select {
+	case d.want <- struct{}{}:
+		return true
+	case <-d.inputDone:
+		return false
+	}
+}
+
+func (d *Dashboard) readInput() {
+	buf := make([]byte, 64)
+	for range d.want {
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			close(d.inputDone)
+			close(d.keys)
+			return
+		}
+		d.keys <- append([]byte(nil), buf[:n]...)
+	}
+}
+
+// probe checks every server now and then, or when asked to with r.
+func (d *Dashboard) probe() {
+	for {
+		d.mu.Lock()
+		d.checking = true
+		d.mu.Unlock()
+		d.notify()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*checkTimeout)
+		results := health.Check(ctx, d.servers, health.Options{Timeout: checkTimeout})
+		cancel()
+
+		d.mu.Lock()
+		for _, r := range results {
+			d.results[r.Server.Name] = r
+		}
+		d.checking = false
+		d.mu.Unlock()
+		d.notify()
+
+		select {
+		case <-d.stop:
+			return
+		case <-d.recheck:
+		case <-time.After(checkInterval):
+		}
+	}
+}
+
+func (d *Dashboard) notify() {
+	select {
+	case d.updated <- struct{}{}:
+	default:
+	}
+}
+
+// handle processes one read worth of input and returns the action once
+// one is chosen.
+func (d *Dashboard) handle(input []byte) (Action, bool) {
+	if d.prompt != nil {
+		return d.handlePrompt(input)
+	}
+
+	d.message = ""
+	switch string(input) {
+	case "\033[A", "\033OA":
+		d.move(-1)
+		return Action{}, false
+	case "\033[B", "\033OB":
+		d.move(1)
+		return Action{}, false
+	case "\033[5~":
+		d.move(-d.listRows())
+		return Action{}, false
+	case "\033[6~":
+		d.move(d.listRows())
+		return Action{}, false
+	case "\033[H", "\033[1~":
+		d.move(-len(d.visible))
+		return Action{}, false
+	case "\033[F", "\033[4~":
+		d.move(len(d.visible))
+		return Action{}, false
+	}
+	if len(input) > 1 && input[0] == '\033' {
+		// Ignore any other escape sequence rather than typing it
+		return Action{}, false
+	}
+
+	for len(input) > 0 {
+		if d.prompt != nil {
+			// Keys pasted or typed ahead after x, p or t belong to the prompt
+			return d.handlePrompt(input)
+		}
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+
+		if d.searching {
+			switch r {
+			case 3: // Ctrl-C
+				return Action{Kind: ActionQuit}, true
+			case 27: // Esc
+				d.query, d.searching = "", false
+				d.filter()
+			case '\r', '\n':
+				d.searching = false
+			case 127, 8: // Backspace
+				if d.query != "" {
+					_, last := utf8.DecodeLastRuneInString(d.query)
+					d.query = d.query[:len(d.query)-last]
+					d.filter()
+				}
+			case 21: // Ctrl-U
+				d.query = ""
+				d.filter()
+			default:
+				if r >= 32 && r != utf8.RuneError {
+					d.query += string(r)
+					d.filter()
+				}
+			}
+			continue
+		}
+
+		switch r {
+		case 3, 'q':
+			return Action{Kind: ActionQuit}, true
+		case 27:
+			d.query = ""
+			d.filter()
+		case '/':
+			d.searching = true
+		case 'k', 16: // Ctrl-P
+			d.move(-1)
+		case 'j', 14: // Ctrl-N
+			d.move(1)
+		case 'g':
+			d.move(-len(d.visible))
+		case 'G':
+			d.move(len(d.visible))
+		case 'r':
+			select {
+			case d.recheck <- struct{}{}:
+			default:
+			}
+		case '\r', '\n', 'c':
+			if server, ok := d.selected(); ok {
+				return Action{Kind: ActionConnect, Server: server}, true
+			}
+		case 'x':
+			d.ask(ActionExec, "run on %s: ", "a command, e.g. uptime")
+		case 'p':
+			d.ask(ActionCopy, "copy: ", "scp arguments, ':' stands for %s, e.g. :/var/log/syslog .")
+		case 't':
+			d.ask(ActionTunnel, "tunnel through %s: ", "-L 8080:localhost:80, -R 9000:localhost:9000 or -D 1080")
+		}
+	}
+	return Action{}, false
+}
+
+func (d *Dashboard) ask(kind, label, hint string) {
+	server, ok := d.selected()
+	if !ok {
+		return
+	}
+	if strings.Contains(label, "%s") {
+		label = fmt.Sprintf(label, server.Name)
+	}
+	if strings.Contains(hint, "%s") {
+		hint = fmt.Sprintf(hint, server.Name)
+	}
+	d.prompt = &prompt{kind: kind, label: label, hint: hint}
+}
+
+func (d *Dashboard) handlePrompt(input []byte) (Action, bool) {
+	if len(input) > 1 && input[0] == '\033' {
+		return Action{}, false
+	}
+	for len(input) > 0 {
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+
+		switch r {
+		case 3, 27: // Ctrl-C, Esc
+			d.prompt = nil
+			return Action{}, false
+		case '\r', '\n':
+			p := d.prompt
+			d.prompt = nil
+			server, ok := d.selected()
+			if !ok || strings.TrimSpace(p.text) == "" {
+				return Action{}, false
+			}
+			return Action{Kind: p.kind, Server: server, Input: strings.TrimSpace(p.text)}, true
+		case 127, 8:
+			if d.prompt.text != "" {
+				_, last := utf8.DecodeLastRuneInString(d.prompt.text)
+				d.prompt.text = d.prompt.text[:len(d.prompt.text)-last]
+			}
+		case 21:
+			d.prompt.text = ""
+		default:
+			if r >= 32 && r != utf8.RuneError {
+				d.prompt.text += string(r)
+			}
+		}
+	}
+	return Action{}, false
+}
+
+// Notice shows an error on the status line the next time the list is
+// drawn, until a key is pressed.
+func (d *Dashboard) Notice(message string) {
+	d.message = message
+}
+
+func (d *Dashboard) selected() (config.Server, bool) {
+	if len(d.visible) == 0 {
+		return config.Server{}, false
+	}
+	return d.servers[d.visible[d.cursor]], true
+}
+
+func (d *Dashboard) move(delta int) {
+	if len(d.visible) == 0 {
+		return
+	}
+	d.cursor += delta
+	if d.cursor < 0 {
+		d.cursor = 0
+	}
+	if d.cursor >= len(d.visible) {
+		d.cursor = len(d.visible) - 1
+	}
+}
+
+// filter recomputes the visible servers for the query, as in the picker:
+// every word has to fuzzy-match one of the server's fields.
+func (d *Dashboard) filter() {
+	type scored struct {
+		index int
+		score int
+	}
+
+	words := strings.Fields(d.query)
+	var matches []scored
+	for i, server := range d.servers {
+		fields := append([]string{server.Name, server.Hostname, server.Description, server.Group, server.Environment}, server.Tags...)
+		total, ok := 0, true
+		for _, word := range words {
+			best := -1
+			for _, field := range fields {
+				if score, found := fuzzy.Score(word, field); found && (best < 0 || score < best) {
+					best = score
+				}
+			}
+			if best < 0 {
+				ok = false
+				break
+			}
+			total += best
+		}
+		if ok {
+			matches = append(matches, scored{i, total})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	d.visible = d.visible[:0]
+	for _, m := range matches {
+		d.visible = append(d.visible, m.index)
+	}
+	d.cursor, d.offset = 0, 0
+}
@@ -0,0 +1,105 @@
+package dashboard
+
+import (
+	"reflect"
+	"testing"
+
+	"ssh-tool/internal/config"
+)
+
+func testDashboard() *Dashboard {
+	d := &Dashboard{servers: []config.Server{
+		{Name: "prod-api", Hostname: "10.0.1.10", Group: "payments", Environment: "prod", Tags: []string{"web"}},
+		{Name: "prod-db", Hostname: "10.0.1.20", Group: "payments", Environment: "prod", Tags: []string{"db"}},
+		{Name: "staging-api", Hostname: "10.0.2.10", Description: "Acme staging", Environment: "staging"},
+	}}
+	d.filter()
+	return d
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		wantDone bool
+		want     Action
+	}{
+		{name: "quit", inputs: []string{"q"}, wantDone: true, want: Action{Kind: ActionQuit}},
+		{name: "ctrl-c", inputs: []string{"\x03"}, wantDone: true, want: Action{Kind: ActionQuit}},
+		{name: "connect", inputs: []string{"\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-api"}}},
+		{name: "move down", inputs: []string{"j", "j", "c"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "staging-api"}}},
+		{name: "keys in one read", inputs: []string{"jjk\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-db"}}},
+		{name: "arrow keys", inputs: []string{"\033[B", "\033[B", "\033[A", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-db"}}},
+		{name: "past the end", inputs: []string{"\033[6~", "j", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "staging-api"}}},
+		{name: "first and last", inputs: []string{"G", "g", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-api"}}},
+		{name: "unknown escape sequence", inputs: []string{"\033[Z", "\033[1;5C"}},
+		{name: "search", inputs: []string{"/", "stag", "\r", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "staging-api"}}},
+		{name: "search backspace", inputs: []string{"/dbx\x7f\r", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-db"}}},
+		{name: "search cleared", inputs: []string{"/db", "\033", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-api"}}},
+		{name: "search ctrl-c", inputs: []string{"/", "\x03"}, wantDone: true, want: Action{Kind: ActionQuit}},
+		{name: "search keys are text", inputs: []string{"/q", "j"}},
+		{name: "no match", inputs: []string{"/zzz\r", "\r", "x"}},
+		{name: "exec", inputs: []string{"x", "uptime", "\r"}, wantDone: true, want: Action{Kind: ActionExec, Server: config.Server{Name: "prod-api"}, Input: "uptime"}},
+		{name: "exec typed ahead", inputs: []string{"jx df -h \r"}, wantDone: true, want: Action{Kind: ActionExec, Server: config.Server{Name: "prod-db"}, Input: "df -h"}},
+		{name: "copy", inputs: []string{"p", ":/var/log/syslog .\r"}, wantDone: true, want: Action{Kind: ActionCopy, Server: config.Server{Name: "prod-api"}, Input: ":/var/log/syslog ."}},
+		{name: "tunnel", inputs: []string{"j", "t", "-L 5432:localhost:5432", "\r"}, wantDone: true, want: Action{Kind: ActionTunnel, Server: config.Server{Name: "prod-db"}, Input: "-L 5432:localhost:5432"}},
+		{name: "prompt cancelled", inputs: []string{"x", "uptime", "\033", "\r"}, wantDone: true, want: Action{Kind: ActionConnect, Server: config.Server{Name: "prod-api"}}},
+		{name: "prompt ctrl-u", inputs: []string{"x", "rm -rf /tmp/x", "\x15", "uptime\r"}, wantDone: true, want: Action{Kind: ActionExec, Server: config.Server{Name: "prod-api"}, Input: "uptime"}},
+		{name: "empty prompt", inputs: []string{"x", "  ", "\r"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDashboard()
+			var action Action
+			done := false
+			for _, input := range tt.inputs {
+				if action, done = d.handle([]byte(input)); done {
+					break
+				}
+			}
+			if done != tt.wantDone {
+				t.Fatalf("done = %v, want %v", done, tt.wantDone)
+			}
+			if action.Kind != tt.want.Kind || action.Server.Name != tt.want.Server.Name || action.Input != tt.want.Input {
+				t.Errorf("got %s %q %q, want %s %q %q", action.Kind, action.Server.Name, action.Input,
+					tt.want.Kind, tt.want.Server.Name, tt.want.Input)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"prod-api", "prod-db", "staging-api"}},
+		{"api", []string{"prod-api", "staging-api"}},
+		{"stag", []string{"staging-api"}},
+		{"prod db", []string{"prod-db"}},
+		// Words can match different fields: group and tag
+		{"payments web", []string{"prod-api"}},
+		// 10.0.1.20 matches loosely and ranks below the exact address
+		{"10.0.2", []string{"staging-api", "prod-db"}},
+		{"acme", []string{"staging-api"}},
+		{"zzz", nil},
+		{"prod zzz", nil},
+	}
+	for _, tt := range tests {
+		d := testDashboard()
+		d.cursor = 2
+		d.query = tt.query
+		d.filter()
+
+		var got []string
+		for _, i := range d.visible {
+			got = append(got, d.servers[i].Name)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("filter(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+		if d.cursor != 0 {
+			t.Errorf("filter(%q) left the cursor at %d", tt.query, d.cursor)
+		}
+	}
+}
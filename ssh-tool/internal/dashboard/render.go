@@ -0,0 +1,294 @@
+package dashboard
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"ssh-tool/internal/ansi"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/health"
+
+	"golang.org/x/term"
+)
+
+func (d *Dashboard) size() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 80, 24
+	}
+	return width, height
+}
+
+// split reports whether the detail pane goes next to the list.
+func (d *Dashboard) split() bool {
+	width, _ := d.size()
+	return width >= splitWidth
+}
+
+// listRows is the number of servers shown at once.
+func (d *Dashboard) listRows() int {
+	_, height := d.size()
+	// Title, search line, blank line, status line and footer
+	rows := height - 5
+	if !d.split() {
+		rows -= detailRows + 1
+	}
+	if rows < 1 {
+		return 1
+	}
+	return rows
+}
+
+func (d *Dashboard) render() {
+	width, height := d.size()
+	rows := d.listRows()
+
+	if d.cursor < d.offset {
+		d.offset = d.cursor
+	}
+	if d.cursor >= d.offset+rows {
+		d.offset = d.cursor - rows + 1
+	}
+
+	d.mu.Lock()
+	checking := d.checking
+	d.mu.Unlock()
+
+	var lines []string
+	title := fmt.Sprintf("%sssh-tool%s  %d/%d servers", ansi.Bold, ansi.Reset, len(d.visible), len(d.servers))
+	if checking {
+		title += fmt.Sprintf("  %schecking reachability...%s", ansi.Dim, ansi.Reset)
+	}
+	lines = append(lines, title)
+	switch {
+	case d.searching:
+		lines = append(lines, fmt.Sprintf("%s/ %s%s█", ansi.Cyan, ansi.Reset, d.query))
+	case d.query != "":
+		lines = append(lines, fmt.Sprintf("%s/ %s%s  %s(esc clears)%s", ansi.Cyan, ansi.Reset, d.query, ansi.Dim, ansi.Reset))
+	default:
+		lines = append(lines, fmt.Sprintf("%s/ to search%s", ansi.Dim, ansi.Reset))
+	}
+	lines = append(lines, "")
+
+	listWidth := width
+	if d.split() {
+		listWidth = width * 2 / 5
+	}
+	list := d.renderList(listWidth, rows)
+	detailWidth := width
+	if d.split() {
+		detailWidth = width - listWidth - 3
+	}
+	detail := d.renderDetail(detailWidth)
+
+	if d.split() {
+		for i := 0; i < rows; i++ {
+			left := strings.Repeat(" ", listWidth)
+			if i < len(list) {
+				left = list[i] + strings.Repeat(" ", max(0, listWidth-ansi.Width(list[i])))
+			}
+			right := ""
+			if i < len(detail) {
+				right = detail[i]
+			}
+			lines = append(lines, left+" "+ansi.Dim+"│"+ansi.Reset+" "+right)
+		}
+	} else {
+		for i := 0; i < rows; i++ {
+			if i < len(list) {
+				lines = append(lines, list[i])
+			} else {
+				lines = append(lines, "")
+			}
+		}
+		lines = append(lines, ansi.Dim+strings.Repeat("─", width)+ansi.Reset)
+		for i := 0; i < detailRows; i++ {
+			if i < len(detail) {
+				lines = append(lines, detail[i])
+			} else {
+				lines = append(lines, "")
+			}
+		}
+	}
+
+	if d.message != "" {
+		lines = append(lines, ansi.Red+ansi.Truncate(d.message, width)+ansi.Reset)
+	} else {
+		lines = append(lines, "")
+	}
+	lines = append(lines, d.footer())
+
+	var b strings.Builder
+	b.WriteString("\033[H")
+	for i, line := range lines {
+		if i >= height {
+			break
+		}
+		b.WriteString(line + ansi.ClearLine)
+		if i < len(lines)-1 && i < height-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	b.WriteString("\033[J")
+	fmt.Print(b.String())
+}
+
+func (d *Dashboard) renderList(width, rows int) []string {
+	if len(d.visible) == 0 {
+		return []string{ansi.Dim + "  no matching servers" + ansi.Reset}
+	}
+
+	nameWidth := 0
+	for _, i := range d.visible {
+		if n := len([]rune(d.servers[i].Name)); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	// Indicator, star and spaces take 6 columns, leave room for the host
+	if limit := width - 6 - 16; nameWidth > limit {
+		nameWidth = max(limit, 8)
+	}
+	hostWidth := width - 6 - nameWidth - 2
+
+	var lines []string
+	end := min(d.offset+rows, len(d.visible))
+	for row := d.offset; row < end; row++ {
+		server := d.servers[d.visible[row]]
+		star := " "
+		if d.st != nil && d.st.IsFavorite(server.Name) {
+			star = ansi.Yellow + "★" + ansi.Reset
+		}
+		text := ansi.Pad(server.Name, nameWidth)
+		if hostWidth > 0 {
+			text += "  " + ansi.Dim + ansi.Truncate(server.Hostname, hostWidth) + ansi.Reset
+		}
+		line := fmt.Sprintf(" %s %s %s", d.indicator(server), star, text)
+		if row == d.cursor {
+			line = fmt.Sprintf("%s>%s%s %s %s%s%s", ansi.Cyan, ansi.Reset, d.indicator(server), star,
+				ansi.Reverse, ansi.Pad(server.Name, nameWidth), ansi.Reset)
+			if hostWidth > 0 {
+				line += "  " + ansi.Truncate(server.Hostname, hostWidth)
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// indicator is a dot coloured by the server's last reachability check.
+func (d *Dashboard) indicator(server config.Server) string {
+	d.mu.Lock()
+	result, ok := d.results[server.Name]
+	d.mu.Unlock()
+	if !ok {
+		return ansi.Dim + "·" + ansi.Reset
+	}
+	return statusColor(result.Status) + "●" + ansi.Reset
+}
+
+func statusColor(status health.Status) string {
+	switch status {
+	case health.StatusReachable, health.StatusAuthOK:
+		return ansi.Green
+	case health.StatusTimedOut, health.StatusAuthFailed:
+		return ansi.Yellow
+	case health.StatusUnreachable:
+		return ansi.Red
+	}
+	return ansi.Dim
+}
+
+// renderDetail describes the selected server, cutting values to width so
+// a long description doesn't wrap into the list.
+func (d *Dashboard) renderDetail(width int) []string {
+	server, ok := d.selected()
+	if !ok {
+		return nil
+	}
+
+	colored := func(label, value, color string) string {
+		return fmt.Sprintf("%s%-10s%s %s%s%s", ansi.Dim, label, ansi.Reset, color, ansi.Truncate(value, width-11), ansi.Reset)
+	}
+	field := func(label, value string) string {
+		return colored(label, value, "")
+	}
+
+	address := server.Hostname
+	if server.User != "" {
+		address = server.User + "@" + address
+	}
+	if server.Port != 0 && server.Port != 22 {
+		address += ":" + strconv.Itoa(server.Port)
+	}
+	lines := []string{ansi.Bold + server.Name + ansi.Reset, field("host", address)}
+
+	key := server.PemFile
+	if key == "" {
+		key = "ssh defaults"
+	}
+	if server.CA != nil {
+		key += " (certificate)"
+	}
+	lines = append(lines, field("key", key))
+
+	switch {
+	case server.Transport == config.TransportSSM:
+		lines = append(lines, field("via", "SSM "+server.InstanceID))
+	case server.ProxyJump != "":
+		lines = append(lines, field("via", server.ProxyJump))
+	}
+	if server.Group != "" || server.Environment != "" {
+		lines = append(lines, field("group", strings.Trim(server.Group+" / "+server.Environment, " /")))
+	}
+	if len(server.Tags) > 0 {
+		lines = append(lines, field("tags", strings.Join(server.Tags, ", ")))
+	}
+	if server.Description != "" {
+		lines = append(lines, field("about", server.Description))
+	}
+
+	last := "never"
+	if d.st != nil {
+		if visit, ok := d.st.LastVisit(server.Name); ok {
+			last = fmt.Sprintf("%s (%d times)", visit.Time.Format("2006-01-02 15:04"), visit.Count)
+			if visit.Count == 1 {
+				last = visit.Time.Format("2006-01-02 15:04")
+			}
+		}
+	}
+	lines = append(lines, field("last", last))
+
+	d.mu.Lock()
+	result, checked := d.results[server.Name]
+	d.mu.Unlock()
+	if !checked {
+		return append(lines, field("status", "checking..."))
+	}
+	status := string(result.Status)
+	switch {
+	case result.Latency > 0:
+		status += fmt.Sprintf(" in %s", result.Latency.Round(time.Millisecond))
+		if result.Banner != "" {
+			status += ", " + result.Banner
+		}
+	case result.Error != "":
+		status += ", " + result.Error
+	}
+	return append(lines, colored("status", status, statusColor(result.Status)))
+}
+
+func (d *Dashboard) footer() string {
+	if p := d.prompt; p != nil {
+		if p.text == "" {
+			return fmt.Sprintf("%s%s%s█ %s%s%s", ansi.Cyan, p.label, ansi.Reset, ansi.Dim, p.hint, ansi.Reset)
+		}
+		return fmt.Sprintf("%s%s%s%s█", ansi.Cyan, p.label, ansi.Reset, p.text)
+	}
+	if d.searching {
+		return ansi.Dim + "type to filter, enter keep, esc clear" + ansi.Reset
+	}
+	return ansi.Dim + "enter connect  x exec  p copy  t tunnel  / search  r recheck  q quit" + ansi.Reset
+}
@@ -0,0 +1,62 @@
+package fuzzy
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Score reports whether every rune of pattern appears in text in order
+// (case-insensitive) and how tightly it matched. Lower scores are better:
+// the score is the number of skipped runes between matched ones plus the
+// offset of the first match. Runes skipped before a match that starts a
+// word count half, so "pa" scores 2 against "prod-api" but 4 against
+// "prodxapi".
+func Score(pattern, text string) (int, bool) {
+	if pattern == "" {
+		return 0, true
+	}
+
+	p := []rune(strings.ToLower(pattern))
+	t := []rune(strings.ToLower(text))
+
+	best := -1
+	// Try every starting position of the first rune and keep the tightest run
+	for start := range t {
+		if t[start] != p[0] {
+			continue
+		}
+		score, ok := scoreFrom(p, t, start)
+		if ok && (best < 0 || score < best) {
+			best = score
+		}
+	}
+
+	if best < 0 {
+		return 0, false
+	}
+	return best, true
+}
+
+func scoreFrom(p, t []rune, start int) (int, bool) {
+	score := start
+	pi := 1
+	last := start
+	for ti := start + 1; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] != p[pi] {
+			continue
+		}
+		gap := ti - last - 1
+		// Matching right after a separator ("-", ".", " ") costs half the gap
+		if gap > 0 && isBoundary(t[ti-1]) {
+			gap = gap / 2
+		}
+		score += gap
+		last = ti
+		pi++
+	}
+	return score, pi == len(p)
+}
+
+func isBoundary(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
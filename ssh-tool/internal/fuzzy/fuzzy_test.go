@@ -0,0 +1,33 @@
+package fuzzy
+
+import "testing"
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		pattern string
+		text    string
+		want    int
+		wantOK  bool
+	}{
+		{"", "prod-api", 0, true},
+		{"prod", "prod-api", 0, true},
+		{"PA", "prod-api", 2, true},
+		// The skipped "-" is a word boundary, so the gap before "a" counts half
+		{"pa", "prod-api", 2, true},
+		{"pa", "prodxapi", 4, true},
+		// The offset of the first match counts in full
+		{"api", "prod-api", 5, true},
+		// The tightest of several starting positions wins
+		{"pi", "prod-api", 6, true},
+		{"pi", "api-prod", 1, true},
+		{"ip", "prod-api", 0, false},
+		{"prodd", "prod", 0, false},
+		{"x", "", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := Score(tt.pattern, tt.text)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("Score(%q, %q) = %d, %v, want %d, %v", tt.pattern, tt.text, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
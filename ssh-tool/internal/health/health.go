@@ -0,0 +1,183 @@
+package health
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/ssh"
+)
+
+type Status string
+
+const (
+	StatusReachable   Status = "reachable"
+	StatusAuthOK      Status = "auth-ok"
+	StatusAuthFailed  Status = "auth-failed"
+	StatusTimedOut    Status = "timed-out"
+	StatusUnreachable Status = "unreachable"
+	// StatusSkipped is used for servers that can't be probed directly,
+	// e.g. those only reachable through a jump host.
+	StatusSkipped Status = "skipped"
+)
+
+// Result is the outcome of probing one server.
+type Result struct {
+	Server  config.Server
+	Status  Status
+	Latency time.Duration
+	Banner  string
+	Error   string
+}
+
+// Options control a health check run.
+type Options struct {
+	Timeout time.Duration
+	// Auth additionally runs a non-interactive key login for every server
+	// whose port answered.
+	Auth bool
+	// Concurrency limits the number of servers probed at once.
+	Concurrency int
+}
+
+// Check probes all servers concurrently and returns results in the same
+// order as servers.
+func Check(ctx context.Context, servers []config.Server, opts Options) []Result {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 16
+	}
+
+	results := make([]Result, len(servers))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server config.Server) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			results[i] = CheckServer(ctx, server, opts)
+		}(i, server)
+	}
+	wg.Wait()
+	return results
+}
+
+// CheckServer dials the server's SSH port, reads the protocol banner and,
+// with opts.Auth, tries a key-only login.
+func CheckServer(ctx context.Context, server config.Server, opts Options) Result {
+	result := Result{Server: server}
+
+	if server.ProxyJump != "" || server.Transport == config.TransportSSM {
+		result.Status = StatusSkipped
+		result.Error = "reached through " + server.ProxyJump
+		if server.Transport == config.TransportSSM {
+			result.Error = "reached through SSM"
+		}
+		if opts.Auth {
+			checkAuth(ctx, &result, opts.Timeout)
+		}
+		return result
+	}
+
+	port := server.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(server.Hostname, strconv.Itoa(port))
+
+	dialer := net.Dialer{Timeout: opts.Timeout}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		result.Status = classify(err)
+		result.Error = err.Error()
+		return result
+	}
+	result.Latency = time.Since(start)
+
+	conn.SetReadDeadline(time.Now().Add(opts.Timeout))
+	banner, err := bufio.NewReader(conn).ReadString('\n')
+	conn.Close()
+	if err != nil {
+		result.Status = classify(err)
+		result.Error = "no SSH banner: " + err.Error()
+		return result
+	}
+	result.Banner = strings.TrimSpace(banner)
+	result.Status = StatusReachable
+
+	if opts.Auth {
+		checkAuth(ctx, &result, opts.Timeout)
+	}
+	return result
+}
+
+// checkAuth runs `true` on the server through ssh in batch mode, so no
+// password or passphrase prompt can block it.
+func checkAuth(ctx context.Context, result *Result, timeout time.Duration) {
+	client := ssh.NewClient(result.Server)
+	client.Batch = true
+	cleanup, err := client.Prepare(ctx)
+	if err != nil {
+		result.Status = StatusAuthFailed
+		result.Error = err.Error()
+		return
+	}
+	defer cleanup()
+
+	args, err := client.Options()
+	if err != nil {
+		result.Status = StatusAuthFailed
+		result.Error = err.Error()
+		return
+	}
+
+	seconds := int(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	args = append(args,
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout="+strconv.Itoa(seconds),
+		// Known keys are still checked, but an unknown host's key is only
+		// added to /dev/null, so a check never writes to known_hosts.
+		// For pinned servers the earlier options from Options win
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile=/dev/null ~/.ssh/known_hosts ~/.ssh/known_hosts2",
+		client.Destination(), "true")
+
+	ctx, cancel := context.WithTimeout(ctx, 2*timeout+time.Second)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "ssh", args...).CombinedOutput()
+	switch {
+	case err == nil:
+		result.Status = StatusAuthOK
+	case ctx.Err() != nil:
+		result.Status = StatusTimedOut
+		result.Error = "ssh login timed out"
+	default:
+		result.Status = StatusAuthFailed
+		result.Error = ssh.LastLine(string(out), err)
+	}
+}
+
+func classify(err error) Status {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return StatusTimedOut
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return StatusTimedOut
+	}
+	return StatusUnreachable
+}
@@ -0,0 +1,70 @@
+// Package hooks runs the pre_connect and post_disconnect commands
+// configured around a connection.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"ssh-tool/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env describes server and the ssh-tool command connecting to it, as
+// SSH_TOOL_* variables for the hook commands.
+func Env(server config.Server, command string) []string {
+	port := server.Port
+	if port == 0 {
+		port = 22
+	}
+	return []string{
+		"SSH_TOOL_COMMAND=" + command,
+		"SSH_TOOL_SERVER=" + server.Name,
+		"SSH_TOOL_HOSTNAME=" + server.Hostname,
+		"SSH_TOOL_USER=" + server.User,
+		"SSH_TOOL_PORT=" + strconv.Itoa(port),
+		"SSH_TOOL_GROUP=" + server.Group,
+		"SSH_TOOL_ENVIRONMENT=" + server.Environment,
+		"SSH_TOOL_TAGS=" + strings.Join(server.Tags, ","),
+		"SSH_TOOL_PROXY_JUMP=" + server.ProxyJump,
+		"SSH_TOOL_DESCRIPTION=" + server.Description,
+	}
+}
+
+// ResultEnv adds the outcome of the session to env for post_disconnect.
+func ResultEnv(env []string, exitCode int, duration time.Duration) []string {
+	return append(env[:len(env):len(env)],
+		"SSH_TOOL_EXIT_CODE="+strconv.Itoa(exitCode),
+		"SSH_TOOL_DURATION="+strconv.Itoa(int(duration.Seconds())))
+}
+
+// Run runs commands one after another with sh -c, stopping at the first
+// that fails. Their output goes to stderr so it never mixes with the
+// output of a remote command.
+func Run(ctx context.Context, stage string, commands []string, env []string) error {
+	for _, command := range commands {
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Env = append(os.Environ(), env...)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s hook %q failed: %v", stage, command, err)
+		}
+	}
+	return nil
+}
+
+// RunAll runs every command even if an earlier one failed, as cleanup
+// hooks shouldn't depend on each other, and returns the failures.
+func RunAll(ctx context.Context, stage string, commands []string, env []string) []error {
+	var errs []error
+	for _, command := range commands {
+		if err := Run(ctx, stage, []string{command}, env); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,115 @@
+package inventory
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Instance is the part of an EC2 instance description sync cares about.
+type Instance struct {
+	ID        string
+	Name      string
+	PrivateIP string
+	PublicIP  string
+	KeyName   string
+	State     string
+	Tags      map[string]string
+}
+
+// InstanceSource lists EC2 instances matching tag filters (key=value).
+type InstanceSource interface {
+	Instances(ctx context.Context, tagFilters map[string]string) ([]Instance, error)
+}
+
+// CLISource lists instances by running `aws ec2 describe-instances`, so it
+// picks up the same credentials, profiles and SSO sessions as the aws CLI.
+// EndpointURL points it at another EC2-compatible endpoint, such as a
+// local stub.
+type CLISource struct {
+	Profile     string
+	Region      string
+	EndpointURL string
+}
+
+func (s CLISource) Instances(ctx context.Context, tagFilters map[string]string) ([]Instance, error) {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return nil, fmt.Errorf("aws CLI not found in PATH, see https://aws.amazon.com/cli/")
+	}
+
+	args := []string{"ec2", "describe-instances", "--output", "json"}
+	if s.Profile != "" {
+		args = append(args, "--profile", s.Profile)
+	}
+	if s.Region != "" {
+		args = append(args, "--region", s.Region)
+	}
+	if s.EndpointURL != "" {
+		args = append(args, "--endpoint-url", s.EndpointURL)
+	}
+
+	filters := []string{"Name=instance-state-name,Values=pending,running,stopping,stopped"}
+	keys := make([]string, 0, len(tagFilters))
+	for key := range tagFilters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		filters = append(filters, fmt.Sprintf("Name=tag:%s,Values=%s", key, tagFilters[key]))
+	}
+	args = append(args, "--filters")
+	args = append(args, filters...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("aws ec2 describe-instances failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return ParseDescribeInstances(stdout.Bytes())
+}
+
+// ParseDescribeInstances decodes the JSON output of DescribeInstances.
+func ParseDescribeInstances(data []byte) ([]Instance, error) {
+	var out struct {
+		Reservations []struct {
+			Instances []struct {
+				InstanceId       string
+				PrivateIpAddress string
+				PublicIpAddress  string
+				KeyName          string
+				State            struct{ Name string }
+				Tags             []struct{ Key, Value string }
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("error parsing describe-instances output: %v", err)
+	}
+
+	var instances []Instance
+	for _, r := range out.Reservations {
+		for _, i := range r.Instances {
+			instance := Instance{
+				ID:        i.InstanceId,
+				PrivateIP: i.PrivateIpAddress,
+				PublicIP:  i.PublicIpAddress,
+				KeyName:   i.KeyName,
+				State:     i.State.Name,
+				Tags:      make(map[string]string),
+			}
+			for _, tag := range i.Tags {
+				instance.Tags[tag.Key] = tag.Value
+			}
+			instance.Name = instance.Tags["Name"]
+			instances = append(instances, instance)
+		}
+	}
+	return instances, nil
+}
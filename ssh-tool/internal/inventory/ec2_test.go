@@ -0,0 +1,173 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary stand in for the aws CLI: linked as "aws",
+// it posts its arguments to --endpoint-url and prints the reply, so
+// CLISource can be tested against an httptest stub.
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "aws" {
+		os.Exit(fakeAWS(os.Args[1:]))
+	}
+	os.Exit(m.Run())
+}
+
+func fakeAWS(args []string) int {
+	endpoint := ""
+	for i, arg := range args {
+		if arg == "--endpoint-url" && i+1 < len(args) {
+			endpoint = args[i+1]
+		}
+	}
+	resp, err := http.Post(endpoint, "text/plain", strings.NewReader(strings.Join(args, "\n")))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 255
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(os.Stderr, resp.Body)
+		return 254
+	}
+	io.Copy(os.Stdout, resp.Body)
+	return 0
+}
+
+// stubAWS puts the fake aws CLI first in PATH and returns an endpoint
+// that answers with status and body, and the arguments it was called with.
+func stubAWS(t *testing.T, status int, body string) (string, *[]string) {
+	t.Helper()
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Symlink(self, filepath.Join(dir, "aws")); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+
+	var args []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		args = strings.Split(string(data), "\n")
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &args
+}
+
+const describeOutput = `{
+  "Reservations": [
+    {
+      "Instances": [
+        {
+          "InstanceId": "i-0123456789abcdef0",
+          "PrivateIpAddress": "10.0.1.10",
+          "PublicIpAddress": "3.8.1.10",
+          "KeyName": "prod",
+          "State": {"Code": 16, "Name": "running"},
+          "Tags": [{"Key": "Name", "Value": "api-1"}, {"Key": "Environment", "Value": "prod"}]
+        },
+        {
+          "InstanceId": "i-0123456789abcdef1",
+          "PrivateIpAddress": "10.0.1.11",
+          "State": {"Code": 80, "Name": "stopped"}
+        }
+      ]
+    },
+    {
+      "Instances": [
+        {
+          "InstanceId": "i-0123456789abcdef2",
+          "PrivateIpAddress": "10.0.2.10",
+          "State": {"Name": "running"},
+          "Tags": [{"Key": "Name", "Value": "worker"}]
+        }
+      ]
+    }
+  ]
+}`
+
+func TestParseDescribeInstances(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []Instance
+		wantErr bool
+	}{
+		{
+			name: "reservations",
+			data: describeOutput,
+			want: []Instance{
+				{
+					ID: "i-0123456789abcdef0", Name: "api-1", PrivateIP: "10.0.1.10", PublicIP: "3.8.1.10",
+					KeyName: "prod", State: "running", Tags: map[string]string{"Name": "api-1", "Environment": "prod"},
+				},
+				{ID: "i-0123456789abcdef1", PrivateIP: "10.0.1.11", State: "stopped", Tags: map[string]string{}},
+				{ID: "i-0123456789abcdef2", Name: "worker", PrivateIP: "10.0.2.10", State: "running", Tags: map[string]string{"Name": "worker"}},
+			},
+		},
+		{name: "no reservations", data: `{"Reservations": []}`},
+		{name: "empty reservation", data: `{"Reservations": [{"Instances": []}]}`},
+		{name: "invalid json", data: `{"Reservations": [`, wantErr: true},
+		{name: "wrong type", data: `{"Reservations": {}}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDescribeInstances([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCLISourceInstances(t *testing.T) {
+	endpoint, args := stubAWS(t, http.StatusOK, describeOutput)
+
+	source := CLISource{Profile: "prod", Region: "eu-west-2", EndpointURL: endpoint}
+	instances, err := source.Instances(context.Background(), map[string]string{"team": "pay", "Environment": "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 3 || instances[0].Name != "api-1" {
+		t.Errorf("got %+v", instances)
+	}
+
+	want := []string{
+		"ec2", "describe-instances", "--output", "json",
+		"--profile", "prod", "--region", "eu-west-2", "--endpoint-url", endpoint,
+		"--filters",
+		"Name=instance-state-name,Values=pending,running,stopping,stopped",
+		"Name=tag:Environment,Values=prod",
+		"Name=tag:team,Values=pay",
+	}
+	if !reflect.DeepEqual(*args, want) {
+		t.Errorf("aws called with %q\nwant %q", *args, want)
+	}
+}
+
+func TestCLISourceInstancesError(t *testing.T) {
+	endpoint, _ := stubAWS(t, http.StatusForbidden, "An error occurred (UnauthorizedOperation)")
+
+	_, err := CLISource{EndpointURL: endpoint}.Instances(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "UnauthorizedOperation") {
+		t.Errorf("error = %v, want the aws CLI's message", err)
+	}
+}
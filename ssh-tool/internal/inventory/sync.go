@@ -0,0 +1,205 @@
+package inventory
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"ssh-tool/internal/config"
+	"strings"
+)
+
+const (
+	AddressPrivate = "private"
+	AddressPublic  = "public"
+)
+
+// SyncOptions controls how instances map onto server entries.
+type SyncOptions struct {
+	// Source identifies this sync run, e.g. "aws:prod/eu-west-2". Entries
+	// carrying the same source are owned by it and refreshed or marked stale.
+	Source string
+	// Address selects the private or public IP as the hostname.
+	Address string
+	// User and Group are only applied to newly added entries.
+	User  string
+	Group string
+	// Transport, if "ssm", makes new entries connect through Session
+	// Manager with the AWS profile and region of the sync.
+	Transport  string
+	AWSProfile string
+	AWSRegion  string
+	// KeyDir is where <KeyName>.pem files live.
+	KeyDir string
+	// Prune removes stale entries instead of only marking them.
+	Prune bool
+	// Taken holds names defined in other config layers, which sync must
+	// not shadow.
+	Taken map[string]bool
+}
+
+// Change describes what Sync did to one entry.
+type Change struct {
+	Name   string
+	Action string
+	Detail string
+}
+
+const (
+	ActionAdded     = "added"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionStale     = "stale"
+	ActionRemoved   = "removed"
+	ActionSkipped   = "skipped"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Sync reconciles the entries owned by opts.Source in cfg with instances.
+// Instances are matched to entries by instance ID first and name second;
+// entries of other sources or hand-written ones are never modified.
+func Sync(cfg *config.Config, instances []Instance, opts SyncOptions) []Change {
+	var changes []Change
+	names := instanceNames(instances)
+
+	byID := make(map[string]string)
+	for name, server := range cfg.Servers {
+		if server.Source == opts.Source && server.InstanceID != "" {
+			byID[server.InstanceID] = name
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, instance := range instances {
+		name := names[instance.ID]
+		if existing, ok := byID[instance.ID]; ok {
+			name = existing
+		}
+
+		host := instance.PrivateIP
+		if opts.Address == AddressPublic {
+			host = instance.PublicIP
+		}
+		if host == "" {
+			changes = append(changes, Change{name, ActionSkipped, fmt.Sprintf("%s has no %s IP address", instance.ID, opts.Address)})
+			continue
+		}
+
+		current, exists := cfg.Servers[name]
+		if (exists && current.Source != opts.Source) || (!exists && opts.Taken[name]) {
+			changes = append(changes, Change{name, ActionSkipped, "an entry with this name exists and is not managed by this sync"})
+			continue
+		}
+		seen[name] = true
+
+		server := current
+		if !exists {
+			server = config.Server{
+				Name:  name,
+				User:  opts.User,
+				Group: opts.Group,
+			}
+			if opts.Transport == config.TransportSSM {
+				server.Transport = opts.Transport
+				server.AWSProfile = opts.AWSProfile
+				server.AWSRegion = opts.AWSRegion
+			}
+		}
+		server.Hostname = host
+		server.InstanceID = instance.ID
+		server.Source = opts.Source
+		server.Stale = false
+		if instance.KeyName != "" {
+			server.PemFile = path.Join(opts.KeyDir, instance.KeyName+".pem")
+		}
+		if env := firstTag(instance.Tags, "Environment", "Env", "environment", "env"); env != "" {
+			server.Environment = env
+		}
+
+		switch {
+		case !exists:
+			changes = append(changes, Change{name, ActionAdded, fmt.Sprintf("%s %s", instance.ID, host)})
+		case !reflect.DeepEqual(current, server):
+			changes = append(changes, Change{name, ActionUpdated, describeUpdate(current, server)})
+		default:
+			changes = append(changes, Change{name, ActionUnchanged, ""})
+		}
+		cfg.Servers[name] = server
+	}
+
+	var stale []string
+	for name, server := range cfg.Servers {
+		if server.Source == opts.Source && !seen[name] {
+			stale = append(stale, name)
+		}
+	}
+	sort.Strings(stale)
+	for _, name := range stale {
+		if opts.Prune {
+			delete(cfg.Servers, name)
+			changes = append(changes, Change{name, ActionRemoved, "instance no longer found"})
+			continue
+		}
+		server := cfg.Servers[name]
+		if !server.Stale {
+			server.Stale = true
+			cfg.Servers[name] = server
+		}
+		changes = append(changes, Change{name, ActionStale, "instance no longer found"})
+	}
+
+	return changes
+}
+
+// instanceNames derives a server name per instance ID from the Name tag.
+// Instances without a Name use their ID; names shared by several
+// instances, as in an auto scaling group, get the ID appended.
+func instanceNames(instances []Instance) map[string]string {
+	count := make(map[string]int)
+	base := make(map[string]string)
+	for _, instance := range instances {
+		name := strings.Trim(invalidNameChars.ReplaceAllString(instance.Name, "-"), "-.")
+		if name == "" {
+			name = instance.ID
+		}
+		base[instance.ID] = name
+		count[name]++
+	}
+
+	names := make(map[string]string)
+	for id, name := range base {
+		if count[name] > 1 {
+			name = name + "-" + id
+		}
+		names[id] = name
+	}
+	return names
+}
+
+func firstTag(tags map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if v := tags[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func describeUpdate(old, new config.Server) string {
+	var parts []string
+	if old.Hostname != new.Hostname {
+		parts = append(parts, fmt.Sprintf("hostname %s -> %s", old.Hostname, new.Hostname))
+	}
+	if old.PemFile != new.PemFile {
+		parts = append(parts, fmt.Sprintf("pem_file %s -> %s", old.PemFile, new.PemFile))
+	}
+	if old.Environment != new.Environment {
+		parts = append(parts, fmt.Sprintf("environment %s -> %s", old.Environment, new.Environment))
+	}
+	if old.Stale && !new.Stale {
+		parts = append(parts, "no longer stale")
+	}
+	return strings.Join(parts, ", ")
+}
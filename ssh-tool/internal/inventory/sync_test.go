@@ -0,0 +1,169 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"ssh-tool/internal/config"
+)
+
+const source = "aws:prod/eu-west-2"
+
+func TestSync(t *testing.T) {
+	api := Instance{ID: "i-0a", Name: "api-1", PrivateIP: "10.0.1.10", PublicIP: "3.8.1.10", KeyName: "prod",
+		Tags: map[string]string{"Name": "api-1", "Environment": "prod"}}
+	owned := config.Server{Name: "api-1", User: "ec2-user", Hostname: "10.0.1.10", PemFile: "~/.ssh/prod.pem",
+		InstanceID: "i-0a", Source: source, Environment: "prod"}
+
+	tests := []struct {
+		name        string
+		servers     map[string]config.Server
+		instances   []Instance
+		opts        SyncOptions
+		wantChanges []Change
+		wantServers map[string]config.Server
+	}{
+		{
+			name:      "add",
+			instances: []Instance{api},
+			opts:      SyncOptions{User: "ec2-user", Group: "payments", KeyDir: "~/.ssh"},
+			wantChanges: []Change{
+				{"api-1", ActionAdded, "i-0a 10.0.1.10"},
+			},
+			wantServers: map[string]config.Server{
+				"api-1": {Name: "api-1", User: "ec2-user", Group: "payments", Hostname: "10.0.1.10", PemFile: "~/.ssh/prod.pem",
+					InstanceID: "i-0a", Source: source, Environment: "prod"},
+			},
+		},
+		{
+			name:      "add public address over ssm",
+			instances: []Instance{api},
+			opts: SyncOptions{Address: AddressPublic, User: "ec2-user", KeyDir: "~/.ssh",
+				Transport: config.TransportSSM, AWSProfile: "prod", AWSRegion: "eu-west-2"},
+			wantChanges: []Change{
+				{"api-1", ActionAdded, "i-0a 3.8.1.10"},
+			},
+			wantServers: map[string]config.Server{
+				"api-1": {Name: "api-1", User: "ec2-user", Hostname: "3.8.1.10", PemFile: "~/.ssh/prod.pem",
+					InstanceID: "i-0a", Source: source, Environment: "prod",
+					Transport: config.TransportSSM, AWSProfile: "prod", AWSRegion: "eu-west-2"},
+			},
+		},
+		{
+			name:        "unchanged",
+			servers:     map[string]config.Server{"api-1": owned},
+			instances:   []Instance{api},
+			opts:        SyncOptions{KeyDir: "~/.ssh"},
+			wantChanges: []Change{{"api-1", ActionUnchanged, ""}},
+			wantServers: map[string]config.Server{"api-1": owned},
+		},
+		{
+			name: "update keeps the entry's name and hand edits",
+			servers: map[string]config.Server{
+				"api": {Name: "api", User: "admin", Group: "payments", Hostname: "10.0.1.99", PemFile: "~/.ssh/prod.pem",
+					InstanceID: "i-0a", Source: source, Environment: "prod", Stale: true},
+			},
+			instances: []Instance{api},
+			opts:      SyncOptions{User: "ec2-user", KeyDir: "~/.ssh"},
+			wantChanges: []Change{
+				{"api", ActionUpdated, "hostname 10.0.1.99 -> 10.0.1.10, no longer stale"},
+			},
+			wantServers: map[string]config.Server{
+				"api": {Name: "api", User: "admin", Group: "payments", Hostname: "10.0.1.10", PemFile: "~/.ssh/prod.pem",
+					InstanceID: "i-0a", Source: source, Environment: "prod"},
+			},
+		},
+		{
+			name: "mark stale",
+			servers: map[string]config.Server{
+				"api-1": owned,
+				"web":   {Name: "web", Hostname: "10.0.9.1", User: "root"},
+			},
+			opts:        SyncOptions{KeyDir: "~/.ssh"},
+			wantChanges: []Change{{"api-1", ActionStale, "instance no longer found"}},
+			wantServers: map[string]config.Server{
+				"api-1": func() config.Server { s := owned; s.Stale = true; return s }(),
+				"web":   {Name: "web", Hostname: "10.0.9.1", User: "root"},
+			},
+		},
+		{
+			name: "prune",
+			servers: map[string]config.Server{
+				"api-1": owned,
+				"other": {Name: "other", Hostname: "10.0.8.1", InstanceID: "i-0f", Source: "aws:dev/eu-west-2"},
+			},
+			opts:        SyncOptions{Prune: true},
+			wantChanges: []Change{{"api-1", ActionRemoved, "instance no longer found"}},
+			wantServers: map[string]config.Server{
+				"other": {Name: "other", Hostname: "10.0.8.1", InstanceID: "i-0f", Source: "aws:dev/eu-west-2"},
+			},
+		},
+		{
+			name:      "hand-written entry is not taken over",
+			servers:   map[string]config.Server{"api-1": {Name: "api-1", Hostname: "10.0.9.1", User: "root"}},
+			instances: []Instance{api},
+			wantChanges: []Change{
+				{"api-1", ActionSkipped, "an entry with this name exists and is not managed by this sync"},
+			},
+			wantServers: map[string]config.Server{"api-1": {Name: "api-1", Hostname: "10.0.9.1", User: "root"}},
+		},
+		{
+			name:      "name taken in another layer",
+			instances: []Instance{api},
+			opts:      SyncOptions{Taken: map[string]bool{"api-1": true}},
+			wantChanges: []Change{
+				{"api-1", ActionSkipped, "an entry with this name exists and is not managed by this sync"},
+			},
+			wantServers: map[string]config.Server{},
+		},
+		{
+			name:        "no address",
+			instances:   []Instance{{ID: "i-0b", Name: "db", PrivateIP: "10.0.2.1"}},
+			opts:        SyncOptions{Address: AddressPublic},
+			wantChanges: []Change{{"db", ActionSkipped, "i-0b has no public IP address"}},
+			wantServers: map[string]config.Server{},
+		},
+		{
+			name: "shared and missing names",
+			instances: []Instance{
+				{ID: "i-0c", Name: "worker", PrivateIP: "10.0.3.1"},
+				{ID: "i-0d", Name: "worker", PrivateIP: "10.0.3.2"},
+				{ID: "i-0e", Name: "batch job/1", PrivateIP: "10.0.3.3"},
+				{ID: "i-0f", PrivateIP: "10.0.3.4"},
+			},
+			wantChanges: []Change{
+				{"worker-i-0c", ActionAdded, "i-0c 10.0.3.1"},
+				{"worker-i-0d", ActionAdded, "i-0d 10.0.3.2"},
+				{"batch-job-1", ActionAdded, "i-0e 10.0.3.3"},
+				{"i-0f", ActionAdded, "i-0f 10.0.3.4"},
+			},
+			wantServers: map[string]config.Server{
+				"worker-i-0c": {Name: "worker-i-0c", Hostname: "10.0.3.1", InstanceID: "i-0c", Source: source},
+				"worker-i-0d": {Name: "worker-i-0d", Hostname: "10.0.3.2", InstanceID: "i-0d", Source: source},
+				"batch-job-1": {Name: "batch-job-1", Hostname: "10.0.3.3", InstanceID: "i-0e", Source: source},
+				"i-0f":        {Name: "i-0f", Hostname: "10.0.3.4", InstanceID: "i-0f", Source: source},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Servers: make(map[string]config.Server)}
+			for name, server := range tt.servers {
+				cfg.Servers[name] = server
+			}
+			opts := tt.opts
+			opts.Source = source
+			if opts.Address == "" {
+				opts.Address = AddressPrivate
+			}
+
+			changes := Sync(cfg, tt.instances, opts)
+			if !reflect.DeepEqual(changes, tt.wantChanges) {
+				t.Errorf("changes %+v\nwant %+v", changes, tt.wantChanges)
+			}
+			if !reflect.DeepEqual(cfg.Servers, tt.wantServers) {
+				t.Errorf("servers %+v\nwant %+v", cfg.Servers, tt.wantServers)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+// Package panes plans multi-pane terminal sessions in tmux or GNU screen.
+// A plan is the list of commands that builds the session, so it can be
+// shown with --dry-run or checked without running a multiplexer.
+package panes
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const (
+	Tmux   = "tmux"
+	Screen = "screen"
+)
+
+// Pane is one server in a session.
+type Pane struct {
+	Title   string
+	Command []string
+}
+
+// Spec describes the session to open.
+type Spec struct {
+	Name   string
+	Panes  []Pane
+	Layout string
+	Sync   bool
+	// Width and Height size a new tmux session, 0 leaves it to tmux
+	Width  int
+	Height int
+}
+
+// Plan is the sequence of commands that opens a session. The last one
+// attaches the terminal to it.
+type Plan [][]string
+
+// Detect picks the multiplexer to use: the one we're running inside of,
+// otherwise tmux if it's installed, otherwise screen.
+func Detect() (string, error) {
+	switch {
+	case os.Getenv("TMUX") != "":
+		return Tmux, nil
+	case os.Getenv("STY") != "":
+		return Screen, nil
+	}
+	for _, name := range []string{Tmux, Screen} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("session needs tmux or screen, neither is installed")
+}
+
+// Inside reports whether we're running inside a session of multiplexer.
+func Inside(multiplexer string) bool {
+	if multiplexer == Tmux {
+		return os.Getenv("TMUX") != ""
+	}
+	return os.Getenv("STY") != ""
+}
+
+// Build returns the plan for spec in multiplexer. Inside an existing
+// session the new one is created alongside it rather than nested.
+func Build(multiplexer string, spec Spec, inside bool) (Plan, error) {
+	if len(spec.Panes) == 0 {
+		return nil, fmt.Errorf("no servers to open")
+	}
+	switch multiplexer {
+	case Tmux:
+		return tmuxPlan(spec, inside), nil
+	case Screen:
+		if spec.Sync {
+			return nil, fmt.Errorf("synchronized input needs tmux")
+		}
+		return screenPlan(spec, inside), nil
+	}
+	return nil, fmt.Errorf("unknown multiplexer %q, use tmux or screen", multiplexer)
+}
+
+func tmuxPlan(spec Spec, inside bool) Plan {
+	// "=name:" is the current window of exactly that session
+	window := "=" + spec.Name + ":"
+
+	first := []string{"tmux", "new-session", "-d", "-s", spec.Name, "-n", spec.Name}
+	if spec.Width > 0 && spec.Height > 0 {
+		first = append(first, "-x", strconv.Itoa(spec.Width), "-y", strconv.Itoa(spec.Height))
+	}
+	plan := Plan{
+		append(first, ShellJoin(spec.Panes[0].Command)),
+		{"tmux", "select-pane", "-t", window, "-T", spec.Panes[0].Title},
+	}
+
+	for i, pane := range spec.Panes[1:] {
+		if i > 0 {
+			// Re-tile between splits, or tmux runs out of room for panes
+			plan = append(plan, []string{"tmux", "select-layout", "-t", window, "tiled"})
+		}
+		plan = append(plan,
+			[]string{"tmux", "split-window", "-t", window, ShellJoin(pane.Command)},
+			[]string{"tmux", "select-pane", "-t", window, "-T", pane.Title})
+	}
+
+	plan = append(plan,
+		[]string{"tmux", "select-layout", "-t", window, spec.Layout},
+		[]string{"tmux", "set-option", "-w", "-t", window, "pane-border-status", "top"},
+		[]string{"tmux", "set-option", "-w", "-t", window, "pane-border-format", " #{pane_title} "})
+	if spec.Sync {
+		plan = append(plan, []string{"tmux", "set-option", "-w", "-t", window, "synchronize-panes", "on"})
+	}
+
+	if inside {
+		return append(plan, []string{"tmux", "switch-client", "-t", "=" + spec.Name})
+	}
+	return append(plan, []string{"tmux", "attach-session", "-t", "=" + spec.Name})
+}
+
+// screenPlan opens one window per server. screen's split regions belong to
+// the attached display rather than the session, so they can't be set up
+// from outside; switch windows with C-a n or list them with C-a ".
+func screenPlan(spec Spec, inside bool) Plan {
+	var plan Plan
+	target := []string{"screen", "-S", spec.Name, "-X"}
+	if inside {
+		// -X without -S talks to the session in $STY
+		target = []string{"screen", "-X"}
+	} else {
+		plan = append(plan, append([]string{"screen", "-dmS", spec.Name, "-t", spec.Panes[0].Title}, spec.Panes[0].Command...))
+	}
+
+	for i, pane := range spec.Panes {
+		if i == 0 && !inside {
+			continue
+		}
+		plan = append(plan, append(append(target, "screen", "-t", pane.Title), pane.Command...))
+	}
+
+	if inside {
+		return append(plan, append(target, "windowlist"))
+	}
+	return append(plan, []string{"screen", "-r", spec.Name})
+}
+
+// Exists reports whether a session called name is running already.
+func Exists(multiplexer, name string) bool {
+	switch multiplexer {
+	case Tmux:
+		return exec.Command("tmux", "has-session", "-t", "="+name).Run() == nil
+	case Screen:
+		// screen -ls exits non-zero even when it lists sessions
+		out, _ := exec.Command("screen", "-ls", name).Output()
+		return strings.Contains(string(out), "."+name+"\t")
+	}
+	return false
+}
+
+// Attach returns the command that joins the existing session name.
+func Attach(multiplexer, name string, inside bool) []string {
+	if multiplexer == Screen {
+		return []string{"screen", "-x", name}
+	}
+	if inside {
+		return []string{"tmux", "switch-client", "-t", "=" + name}
+	}
+	return []string{"tmux", "attach-session", "-t", "=" + name}
+}
+
+// Run executes plan, with the last command attached to the terminal.
+func Run(plan Plan) error {
+	for i, args := range plan {
+		cmd := exec.Command(args[0], args[1:]...)
+		if i == len(plan)-1 {
+			cmd.Stdin = os.Stdin
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		}
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("%s: %s", strings.Join(args[:2], " "), strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// String renders the plan as shell commands, one per line.
+func (p Plan) String() string {
+	var b strings.Builder
+	for _, args := range p {
+		b.WriteString(ShellJoin(args))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// ShellJoin quotes args for a POSIX shell.
+func ShellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,+%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
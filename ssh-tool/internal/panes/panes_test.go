@@ -0,0 +1,150 @@
+package panes
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden plans in testdata")
+
+var threePanes = []Pane{
+	{Title: "api-1", Command: []string{"ssh-tool", "connect", "api-1"}},
+	{Title: "api-2", Command: []string{"ssh-tool", "connect", "api-2"}},
+	{Title: "worker", Command: []string{"ssh-tool", "exec", "worker", "--", "tail", "-f", "/var/log/app's.log"}},
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		multiplexer string
+		spec        Spec
+		inside      bool
+	}{
+		{
+			name:        "tmux-single",
+			multiplexer: Tmux,
+			spec:        Spec{Name: "api", Panes: threePanes[:1], Layout: "tiled"},
+		},
+		{
+			name:        "tmux-layout",
+			multiplexer: Tmux,
+			spec:        Spec{Name: "payments", Panes: threePanes, Layout: "even-vertical", Width: 200, Height: 50},
+		},
+		{
+			name:        "tmux-sync-inside",
+			multiplexer: Tmux,
+			spec:        Spec{Name: "incident", Panes: threePanes, Layout: "tiled", Sync: true},
+			inside:      true,
+		},
+		{
+			name:        "screen",
+			multiplexer: Screen,
+			spec:        Spec{Name: "payments", Panes: threePanes, Layout: "tiled"},
+		},
+		{
+			name:        "screen-inside",
+			multiplexer: Screen,
+			spec:        Spec{Name: "payments", Panes: threePanes, Layout: "tiled"},
+			inside:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := Build(tt.multiplexer, tt.spec, tt.inside)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(plan.String()), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := plan.String(); got != string(want) {
+				t.Errorf("plan differs from %s:\n%s", golden, got)
+			}
+		})
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		multiplexer string
+		spec        Spec
+		wantErr     string
+	}{
+		{"no panes", Tmux, Spec{Name: "empty", Layout: "tiled"}, "no servers to open"},
+		{"screen sync", Screen, Spec{Name: "incident", Panes: threePanes, Sync: true}, "synchronized input needs tmux"},
+		{"unknown", "zellij", Spec{Name: "api", Panes: threePanes}, `unknown multiplexer "zellij"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build(tt.multiplexer, tt.spec, false)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"ssh-tool", "connect", "user@api-1:22"}, "ssh-tool connect user@api-1:22"},
+		{[]string{"echo", ""}, "echo ''"},
+		{[]string{"sh", "-c", "tail -f app's.log"}, `sh -c 'tail -f app'\''s.log'`},
+		{[]string{"echo", "$HOME", "a;b"}, `echo '$HOME' 'a;b'`},
+	}
+	for _, tt := range tests {
+		if got := ShellJoin(tt.args); got != tt.want {
+			t.Errorf("ShellJoin(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	onlyScreen := t.TempDir()
+	if err := os.WriteFile(filepath.Join(onlyScreen, "screen"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tmux    string
+		sty     string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "inside tmux", tmux: "/tmp/tmux-1000/default,1,0", path: onlyScreen, want: Tmux},
+		{name: "inside screen", sty: "1234.payments", want: Screen},
+		{name: "screen fallback", path: onlyScreen, want: Screen},
+		{name: "neither installed", path: t.TempDir(), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TMUX", tt.tmux)
+			t.Setenv("STY", tt.sty)
+			t.Setenv("PATH", tt.path)
+
+			got, err := Detect()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package picker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"ssh-tool/internal/ansi"
+	"ssh-tool/internal/fuzzy"
+
+	"golang.org/x/term"
+)
+
+// ErrCancelled is returned when the user leaves the picker without choosing.
+var ErrCancelled = errors.New("selection cancelled")
+
+// Item is one selectable row. Every field takes part in type-to-filter.
+type Item struct {
+	Name        string
+	Hostname    string
+	Description string
+}
+
+// Available reports whether stdin and stdout are both terminals, which the
+// picker needs to run.
+func Available() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Run shows a full-screen picker over items, pre-filtered with query, and
+// returns the index of the chosen item.
+func Run(items []Item, query string) (int, error) {
+	if !Available() {
+		return -1, fmt.Errorf("interactive picker needs a terminal")
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return -1, fmt.Errorf("error switching terminal to raw mode: %v", err)
+	}
+	defer term.Restore(fd, state)
+
+	fmt.Print(ansi.AltScreenOn + ansi.CursorHide)
+	defer fmt.Print(ansi.CursorShow + ansi.AltScreenOff)
+
+	p := &picker{items: items, query: query, out: os.Stdout}
+	p.filter()
+
+	buf := make([]byte, 64)
+	for {
+		p.render()
+
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return -1, fmt.Errorf("error reading input: %v", err)
+		}
+
+		done, err := p.handle(buf[:n])
+		if err != nil {
+			return -1, err
+		}
+		if done {
+			return p.visible[p.cursor], nil
+		}
+	}
+}
+
+type picker struct {
+	items   []Item
+	query   string
+	visible []int
+	cursor  int
+	offset  int
+	out     io.Writer
+}
+
+// handle processes one read worth of input and reports whether a choice
+// has been made.
+func (p *picker) handle(input []byte) (bool, error) {
+	switch {
+	case string(input) == "\033[A", string(input) == "\033OA":
+		p.move(-1)
+		return false, nil
+	case string(input) == "\033[B", string(input) == "\033OB":
+		p.move(1)
+		return false, nil
+	case string(input) == "\033[5~":
+		p.move(-p.pageSize())
+		return false, nil
+	case string(input) == "\033[6~":
+		p.move(p.pageSize())
+		return false, nil
+	case len(input) > 1 && input[0] == '\033':
+		// Ignore any other escape sequence rather than typing it
+		return false, nil
+	}
+
+	for len(input) > 0 {
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+
+		switch r {
+		case 3, 27: // Ctrl-C, Esc
+			return false, ErrCancelled
+		case '\r', '\n':
+			if len(p.visible) == 0 {
+				continue
+			}
+			return true, nil
+		case 16: // Ctrl-P
+			p.move(-1)
+		case 14: // Ctrl-N
+			p.move(1)
+		case 127, 8: // Backspace
+			if p.query != "" {
+				_, last := utf8.DecodeLastRuneInString(p.query)
+				p.query = p.query[:len(p.query)-last]
+				p.filter()
+			}
+		case 21: // Ctrl-U
+			p.query = ""
+			p.filter()
+		default:
+			if r >= 32 && r != utf8.RuneError {
+				p.query += string(r)
+				p.filter()
+			}
+		}
+	}
+	return false, nil
+}
+
+func (p *picker) move(delta int) {
+	if len(p.visible) == 0 {
+		return
+	}
+	p.cursor += delta
+	if p.cursor < 0 {
+		p.cursor = 0
+	}
+	if p.cursor >= len(p.visible) {
+		p.cursor = len(p.visible) - 1
+	}
+}
+
+// filter recomputes the visible items for the current query. Every
+// whitespace-separated word has to fuzzy-match one of the item's fields.
+func (p *picker) filter() {
+	type scored struct {
+		index int
+		score int
+	}
+
+	words := strings.Fields(p.query)
+	var matches []scored
+	for i, item := range p.items {
+		total := 0
+		ok := true
+		for _, word := range words {
+			best := -1
+			for _, field := range []string{item.Name, item.Hostname, item.Description} {
+				if score, found := fuzzy.Score(word, field); found && (best < 0 || score < best) {
+					best = score
+				}
+			}
+			if best < 0 {
+				ok = false
+				break
+			}
+			total += best
+		}
+		if ok {
+			matches = append(matches, scored{i, total})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score < matches[j].score
+	})
+
+	p.visible = p.visible[:0]
+	for _, m := range matches {
+		p.visible = append(p.visible, m.index)
+	}
+	p.cursor = 0
+	p.offset = 0
+}
+
+func (p *picker) size() (int, int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 80, 24
+	}
+	return width, height
+}
+
+func (p *picker) pageSize() int {
+	_, height := p.size()
+	if height < 5 {
+		return 1
+	}
+	return height - 4
+}
+
+func (p *picker) render() {
+	width, _ := p.size()
+	page := p.pageSize()
+
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+page {
+		p.offset = p.cursor - page + 1
+	}
+
+	var b strings.Builder
+	b.WriteString(ansi.ClearScreen)
+	fmt.Fprintf(&b, "%sSelect server%s (%d/%d)  %s↑/↓ move, enter connect, esc cancel%s\r\n",
+		ansi.Bold, ansi.Reset, len(p.visible), len(p.items), ansi.Dim, ansi.Reset)
+	fmt.Fprintf(&b, "%s> %s%s%s\r\n\r\n", ansi.Cyan, ansi.Reset, p.query, "█")
+
+	nameWidth := 0
+	for _, i := range p.visible {
+		if n := utf8.RuneCountInString(p.items[i].Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+
+	end := p.offset + page
+	if end > len(p.visible) {
+		end = len(p.visible)
+	}
+	for row := p.offset; row < end; row++ {
+		item := p.items[p.visible[row]]
+		line := fmt.Sprintf("%s%-*s%s  %s%-15s%s  %s",
+			ansi.Green, nameWidth, item.Name, ansi.Reset,
+			ansi.Magenta, item.Hostname, ansi.Reset,
+			item.Description)
+		plain := fmt.Sprintf("%-*s  %-15s  %s", nameWidth, item.Name, item.Hostname, item.Description)
+		if utf8.RuneCountInString(plain) > width-2 {
+			line = ansi.Truncate(plain, width-2)
+		}
+		if row == p.cursor {
+			fmt.Fprintf(&b, "%s> %s%s\r\n", ansi.Reverse, ansi.Strip(line), ansi.Reset)
+		} else {
+			fmt.Fprintf(&b, "  %s\r\n", line)
+		}
+	}
+
+	io.WriteString(p.out, b.String())
+}
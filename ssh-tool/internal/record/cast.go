@@ -0,0 +1,108 @@
+package record
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Cast writes terminal output in the asciinema v2 format: a JSON header
+// line followed by one [elapsed, "o", data] event per write.
+type Cast struct {
+	mu      sync.Mutex
+	file    *os.File
+	start   time.Time
+	pending []byte
+}
+
+type header struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Create starts a new cast file for a terminal of the given size.
+func Create(path, title string, width, height int) (*Cast, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("error creating recording directory: %v", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("error creating recording: %v", err)
+	}
+
+	c := &Cast{file: f, start: time.Now()}
+	h := header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: c.start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": os.Getenv("TERM"), "SHELL": os.Getenv("SHELL")},
+	}
+	if err := c.writeLine(h); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Write records p as an output event. A multi-byte character split across
+// writes is held back until it is complete, since events must be valid
+// UTF-8 strings.
+func (c *Cast) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data := append(c.pending, p...)
+	cut := len(data)
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				cut = i
+			}
+			break
+		}
+	}
+	c.pending = append([]byte(nil), data[cut:]...)
+
+	if cut > 0 {
+		elapsed := time.Since(c.start).Seconds()
+		if err := c.writeLine([]interface{}{elapsed, "o", string(data[:cut])}); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes any held back output and closes the file.
+func (c *Cast) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.pending) > 0 {
+		elapsed := time.Since(c.start).Seconds()
+		c.writeLine([]interface{}{elapsed, "o", string(c.pending)})
+		c.pending = nil
+	}
+	return c.file.Close()
+}
+
+func (c *Cast) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := c.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("error writing recording: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package record
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCast(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recordings", "prod-api.cast")
+	cast, err := Create(path, "prod-api", 120, 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// "é" is split across two writes and "€" is cut off at the end
+	euro := []byte("€")
+	for _, p := range [][]byte{[]byte("hello\r\n"), {'c', 'a', 'f', 0xc3}, {0xa9, '\n'}, euro[:2]} {
+		if _, err := cast.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cast.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+
+	scanner.Scan()
+	var h header
+	if err := json.Unmarshal(scanner.Bytes(), &h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 2 || h.Width != 120 || h.Height != 40 || h.Title != "prod-api" || h.Timestamp == 0 {
+		t.Errorf("header %+v", h)
+	}
+
+	var output []string
+	for scanner.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("event %s: %v", scanner.Bytes(), err)
+		}
+		if len(event) != 3 || event[1] != "o" {
+			t.Fatalf("event %s is not an output event", scanner.Bytes())
+		}
+		if elapsed, ok := event[0].(float64); !ok || elapsed < 0 {
+			t.Errorf("event %s has no elapsed time", scanner.Bytes())
+		}
+		output = append(output, event[2].(string))
+	}
+	// The incomplete character is written on Close, each byte replaced
+	want := []string{"hello\r\n", "caf", "é\n", "\ufffd\ufffd"}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("events %q, want %q", output, want)
+	}
+
+	if _, err := Create(path, "prod-api", 80, 24); err == nil {
+		t.Error("Create overwrote an existing recording")
+	}
+}
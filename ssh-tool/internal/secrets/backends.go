@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// envBackend reads env://VAR.
+type envBackend struct{}
+
+func (envBackend) Fetch(ctx context.Context, ref *url.URL) ([]byte, error) {
+	name := refPath(ref)
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("environment variable %s is not set", name)
+	}
+	return []byte(value), nil
+}
+
+// fileBackend reads file:///absolute/path or file://~/path. It is mostly
+// useful to try references out and in tests.
+type fileBackend struct{}
+
+func (fileBackend) Fetch(ctx context.Context, ref *url.URL) ([]byte, error) {
+	path := ref.Path
+	if ref.Host == "~" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, path)
+	} else if ref.Host != "" {
+		return nil, fmt.Errorf("file references must be file:///path or file://~/path")
+	}
+	return os.ReadFile(path)
+}
+
+// vaultBackend reads vault://mount/path?field=name from HashiCorp Vault
+// over its HTTP API, using VAULT_ADDR, VAULT_TOKEN (or ~/.vault-token) and
+// VAULT_NAMESPACE like the vault CLI. KV version 2 mounts are tried first,
+// then version 1. The field defaults to private_key.
+type vaultBackend struct{}
+
+func (vaultBackend) Fetch(ctx context.Context, ref *url.URL) ([]byte, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return nil, fmt.Errorf("VAULT_ADDR is not set")
+	}
+	token, err := vaultToken()
+	if err != nil {
+		return nil, err
+	}
+
+	field := ref.Query().Get("field")
+	if field == "" {
+		field = "private_key"
+	}
+
+	path := refPath(ref)
+	mount, rest, _ := strings.Cut(path, "/")
+
+	// KV v2 nests the secret under data/ and the values under data.data
+	data, status, err := vaultGet(ctx, addr, token, mount+"/data/"+rest)
+	if err == nil && status == http.StatusOK {
+		var v2 struct {
+			Data struct {
+				Data map[string]interface{} `json:"data"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(data, &v2); err == nil && v2.Data.Data != nil {
+			return vaultField(v2.Data.Data, field)
+		}
+	}
+
+	data, status, err = vaultGet(ctx, addr, token, path)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("vault returned %d for %s: %s", status, path, strings.TrimSpace(string(data)))
+	}
+	var v1 struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &v1); err != nil {
+		return nil, fmt.Errorf("error parsing vault response: %v", err)
+	}
+	return vaultField(v1.Data, field)
+}
+
+func vaultToken() (string, error) {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".vault-token"))
+	if err != nil {
+		return "", fmt.Errorf("no VAULT_TOKEN and no ~/.vault-token, run 'vault login' first")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func vaultGet(ctx context.Context, addr, token, path string) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+path, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if ns := os.Getenv("VAULT_NAMESPACE"); ns != "" {
+		req.Header.Set("X-Vault-Namespace", ns)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("error contacting vault: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return data, resp.StatusCode, err
+}
+
+func vaultField(data map[string]interface{}, field string) ([]byte, error) {
+	value, ok := data[field].(string)
+	if !ok {
+		return nil, fmt.Errorf("secret has no string field %q", field)
+	}
+	return []byte(value), nil
+}
+
+// keychainBackend reads keychain://service/account from the macOS
+// keychain, or from the Secret Service (GNOME Keyring, KWallet) through
+// secret-tool elsewhere.
+type keychainBackend struct{}
+
+func (keychainBackend) Fetch(ctx context.Context, ref *url.URL) ([]byte, error) {
+	service := ref.Host
+	account := strings.Trim(ref.Path, "/")
+	if service == "" {
+		return nil, fmt.Errorf("keychain references must be keychain://service[/account]")
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "darwin" {
+		args := []string{"find-generic-password", "-s", service, "-w"}
+		if account != "" {
+			args = append(args, "-a", account)
+		}
+		cmd = exec.CommandContext(ctx, "security", args...)
+	} else {
+		args := []string{"lookup", "service", service}
+		if account != "" {
+			args = append(args, "account", account)
+		}
+		cmd = exec.CommandContext(ctx, "secret-tool", args...)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v %s", cmd.Path, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
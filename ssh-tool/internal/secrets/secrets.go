@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Backend fetches a private key for a reference such as
+// vault://secret/ssh/prod. The URL's scheme selects the backend.
+type Backend interface {
+	Fetch(ctx context.Context, ref *url.URL) ([]byte, error)
+}
+
+var backends = map[string]Backend{
+	"env":      envBackend{},
+	"file":     fileBackend{},
+	"vault":    vaultBackend{},
+	"keychain": keychainBackend{},
+}
+
+// Register adds or replaces the backend for scheme.
+func Register(scheme string, backend Backend) {
+	backends[scheme] = backend
+}
+
+// Schemes returns the registered backend schemes, sorted.
+func Schemes() []string {
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// IsReference reports whether pemFile names a secret rather than a path.
+func IsReference(pemFile string) bool {
+	return strings.Contains(pemFile, "://")
+}
+
+// Check validates a reference without fetching it.
+func Check(ref string) error {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return fmt.Errorf("invalid key reference %q: %v", ref, err)
+	}
+	if _, ok := backends[u.Scheme]; !ok {
+		return fmt.Errorf("unknown key backend %q, supported: %s", u.Scheme, strings.Join(Schemes(), ", "))
+	}
+	return nil
+}
+
+// Fetch returns the private key ref points to. Keys stored base64 encoded,
+// as is common for environment variables, are decoded.
+func Fetch(ctx context.Context, ref string) ([]byte, error) {
+	if err := Check(ref); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(ref)
+
+	key, err := backends[u.Scheme].Fetch(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching key %s: %v", ref, err)
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("key %s is empty", ref)
+	}
+
+	if !strings.Contains(string(key), "-----BEGIN") {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(key))); err == nil {
+			key = decoded
+		}
+	}
+	if !strings.HasSuffix(string(key), "\n") {
+		key = append(key, '\n')
+	}
+	return key, nil
+}
+
+// refPath joins host and path of a reference, so both vault://secret/x
+// and vault:///secret/x name "secret/x".
+func refPath(u *url.URL) string {
+	return strings.Trim(u.Host+u.Path, "/")
+}
@@ -0,0 +1,62 @@
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Agent is a private ssh-agent that lives only as long as one session, so
+// keys fetched from a secrets backend never touch the disk.
+type Agent struct {
+	Socket string
+
+	dir string
+	cmd *exec.Cmd
+}
+
+// StartAgent runs ssh-agent in the foreground on a socket in a fresh
+// private directory and waits for it to listen.
+func StartAgent() (*Agent, error) {
+	dir, err := os.MkdirTemp("", "ssh-tool-agent-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating agent directory: %v", err)
+	}
+
+	a := &Agent{Socket: filepath.Join(dir, "agent.sock"), dir: dir}
+	a.cmd = exec.Command("ssh-agent", "-D", "-a", a.Socket)
+	if err := a.cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("error starting ssh-agent: %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(a.Socket); err == nil {
+			return a, nil
+		}
+		if time.Now().After(deadline) {
+			a.Stop()
+			return nil, fmt.Errorf("ssh-agent did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Add loads a private key into the agent. ssh-add asks for the passphrase
+// of an encrypted key on the terminal; it is needed only once because the
+// agent keeps the decrypted key. With batch set it fails instead of asking.
+func (a *Agent) Add(key []byte, batch bool) error {
+	return addKey(a.Socket, []string{"-"}, key, 0, batch)
+}
+
+// Stop kills the agent, dropping every key it holds.
+func (a *Agent) Stop() {
+	if a.cmd.Process != nil {
+		a.cmd.Process.Kill()
+		a.cmd.Wait()
+	}
+	os.RemoveAll(a.dir)
+}
@@ -0,0 +1,304 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"ssh-tool/internal/config"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// renewBefore is how long before expiry a cached certificate is replaced.
+// Certificates are only checked at login, so a short margin is enough.
+const renewBefore = time.Minute
+
+// CertInfo is what ssh-keygen -L reports about a certificate.
+type CertInfo struct {
+	KeyID       string
+	Fingerprint string
+	Principals  []string
+	ValidAfter  time.Time
+	// ValidBefore is zero for certificates that never expire
+	ValidBefore time.Time
+}
+
+// Expires reports whether the certificate has an end date at all.
+func (c CertInfo) Expires() bool {
+	return !c.ValidBefore.IsZero()
+}
+
+// Valid reports whether the certificate can still be used at t plus margin.
+func (c CertInfo) Valid(t time.Time, margin time.Duration) bool {
+	if !c.ValidAfter.IsZero() && t.Before(c.ValidAfter) {
+		return false
+	}
+	return !c.Expires() || t.Add(margin).Before(c.ValidBefore)
+}
+
+// CertPath returns where the certificate for server is cached.
+func CertPath(server string) (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "certs", server+"-cert.pub"), nil
+}
+
+// InspectCert reads a certificate file.
+func InspectCert(path string) (CertInfo, error) {
+	out, err := exec.Command("ssh-keygen", "-L", "-f", path).CombinedOutput()
+	if err != nil {
+		return CertInfo{}, fmt.Errorf("%s", LastLine(string(out), err))
+	}
+
+	var info CertInfo
+	inPrincipals := false
+	for _, line := range strings.Split(string(out), "\n") {
+		trimmed := strings.TrimSpace(line)
+		key, value, isField := strings.Cut(trimmed, ": ")
+		if !isField {
+			key, isField = strings.CutSuffix(trimmed, ":")
+		}
+		if inPrincipals && !isField && trimmed != "" {
+			info.Principals = append(info.Principals, trimmed)
+			continue
+		}
+		inPrincipals = false
+
+		switch key {
+		case "Public key":
+			if fields := strings.Fields(value); len(fields) == 2 {
+				info.Fingerprint = fields[1]
+			}
+		case "Key ID":
+			info.KeyID = strings.Trim(value, `"`)
+		case "Valid":
+			info.ValidAfter, info.ValidBefore, err = parseValidity(value)
+			if err != nil {
+				return CertInfo{}, err
+			}
+		case "Principals":
+			inPrincipals = true
+		}
+	}
+	return info, nil
+}
+
+// parseValidity parses the Valid line of ssh-keygen -L, which is one of
+// "forever", "from T to T", "after T" or "before T" in local time.
+func parseValidity(s string) (after, before time.Time, err error) {
+	parse := func(v string) (time.Time, error) {
+		return time.ParseInLocation("2006-01-02T15:04:05", v, time.Local)
+	}
+
+	fields := strings.Fields(s)
+	switch {
+	case s == "forever":
+	case len(fields) == 4 && fields[0] == "from" && fields[2] == "to":
+		if after, err = parse(fields[1]); err == nil {
+			before, err = parse(fields[3])
+		}
+	case len(fields) == 2 && fields[0] == "after":
+		after, err = parse(fields[1])
+	case len(fields) == 2 && fields[0] == "before":
+		before, err = parse(fields[1])
+	default:
+		err = fmt.Errorf("unexpected certificate validity %q", s)
+	}
+	return after, before, err
+}
+
+// EnsureCert returns a certificate for the server's key, reusing the cached
+// one while it is valid for the same key and principals and signing a new
+// one through the server's CA otherwise. pubKey is the authorized_keys line
+// of the key to certify.
+func EnsureCert(ctx context.Context, server config.Server, pubKey []byte, batch bool) (string, error) {
+	ca := server.CA
+	principals := ca.Principals
+	if len(principals) == 0 {
+		principals = []string{server.User}
+	}
+
+	certPath, err := CertPath(server.Name)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(certPath), 0o700); err != nil {
+		return "", fmt.Errorf("error creating certificate directory: %v", err)
+	}
+
+	pubPath := strings.TrimSuffix(certPath, "-cert.pub") + ".pub"
+	if err := os.WriteFile(pubPath, pubKey, 0o600); err != nil {
+		return "", err
+	}
+	key, err := InspectKey(pubPath)
+	if err != nil {
+		return "", err
+	}
+
+	if cached, err := InspectCert(certPath); err == nil &&
+		cached.Fingerprint == key.Fingerprint &&
+		samePrincipals(cached.Principals, principals) &&
+		cached.Valid(time.Now(), renewBefore) {
+		return certPath, nil
+	}
+
+	keyID := server.Name
+	if u, err := user.Current(); err == nil {
+		keyID = u.Username + "@" + server.Name
+	}
+
+	if ca.Key != "" {
+		err = signLocal(ctx, ca, pubPath, keyID, principals, batch)
+	} else {
+		err = signRemote(ctx, ca, pubKey, certPath, keyID, principals)
+	}
+	if err != nil {
+		return "", fmt.Errorf("error signing certificate: %v", err)
+	}
+	return certPath, nil
+}
+
+// signLocal signs with a CA private key on disk; ssh-keygen writes the
+// certificate next to the public key. Validity starts a few minutes back to
+// allow for clock skew between here and the server.
+func signLocal(ctx context.Context, ca *config.CA, pubPath, keyID string, principals []string, batch bool) error {
+	caKey, err := config.ExpandPath(ca.Key)
+	if err != nil {
+		return err
+	}
+
+	validity := fmt.Sprintf("-5m:+%ds", int(ca.Lifetime().Seconds()))
+	cmd := exec.CommandContext(ctx, "ssh-keygen", "-q", "-s", caKey, "-I", keyID,
+		"-n", strings.Join(principals, ","), "-V", validity, pubPath)
+	cmd.Stdin = os.Stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if batch {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	} else {
+		cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	}
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s", LastLine(stderr.String(), err))
+	}
+	return nil
+}
+
+// signRequest is what a signing endpoint receives as JSON. It answers with
+// {"certificate": "<ssh-...-cert-v01@openssh.com line>"} or with the
+// certificate line as plain text. $SSH_TOOL_CA_TOKEN, if set, is sent as a
+// bearer token.
+type signRequest struct {
+	PublicKey  string   `json:"public_key"`
+	Principals []string `json:"principals"`
+	KeyID      string   `json:"key_id"`
+	TTL        int      `json:"ttl"`
+}
+
+func signRemote(ctx context.Context, ca *config.CA, pubKey []byte, certPath, keyID string, principals []string) error {
+	body, err := json.Marshal(signRequest{
+		PublicKey:  strings.TrimSpace(string(pubKey)),
+		Principals: principals,
+		KeyID:      keyID,
+		TTL:        int(ca.Lifetime().Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ca.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token := os.Getenv("SSH_TOOL_CA_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s: %s", ca.URL, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	cert := strings.TrimSpace(string(data))
+	var signed struct {
+		Certificate string `json:"certificate"`
+	}
+	if json.Unmarshal(data, &signed) == nil && signed.Certificate != "" {
+		cert = strings.TrimSpace(signed.Certificate)
+	}
+	if !strings.Contains(strings.SplitN(cert, " ", 2)[0], "-cert-v01@openssh.com") {
+		return fmt.Errorf("%s did not return an SSH certificate", ca.URL)
+	}
+	return os.WriteFile(certPath, []byte(cert+"\n"), 0o600)
+}
+
+// PublicKey returns the authorized_keys line for a private key file, from
+// its .pub file if there is one.
+func PublicKey(pemFile string, batch bool) ([]byte, error) {
+	if data, err := os.ReadFile(pemFile + ".pub"); err == nil {
+		return data, nil
+	}
+
+	cmd := exec.Command("ssh-keygen", "-y", "-f", pemFile)
+	cmd.Stdin = os.Stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if batch {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading public key of %s: %s", pemFile, LastLine(stderr.String(), err))
+	}
+	return out, nil
+}
+
+// agentPublicKey returns the first key the agent on sock holds.
+func agentPublicKey(sock string) ([]byte, error) {
+	cmd := exec.Command("ssh-add", "-L")
+	cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("error reading key from agent: %v", err)
+	}
+	line, _, _ := strings.Cut(string(out), "\n")
+	return []byte(line + "\n"), nil
+}
+
+func samePrincipals(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
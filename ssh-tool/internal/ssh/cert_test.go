@@ -0,0 +1,209 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-tool/internal/config"
+)
+
+func TestParseValidity(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02T15:04:05", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		value   string
+		after   time.Time
+		before  time.Time
+		wantErr bool
+	}{
+		{value: "forever"},
+		{value: "from 2024-05-01T09:00:00 to 2024-05-01T17:00:00", after: at("2024-05-01T09:00:00"), before: at("2024-05-01T17:00:00")},
+		{value: "after 2024-05-01T09:00:00", after: at("2024-05-01T09:00:00")},
+		{value: "before 2024-05-01T17:00:00", before: at("2024-05-01T17:00:00")},
+		{value: "from 2024-05-01 to later", wantErr: true},
+		{value: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		after, before, err := parseValidity(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseValidity(%q) error = %v, want error %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && (!after.Equal(tt.after) || !before.Equal(tt.before)) {
+			t.Errorf("parseValidity(%q) = %s, %s, want %s, %s", tt.value, after, before, tt.after, tt.before)
+		}
+	}
+}
+
+func TestCertValid(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		cert CertInfo
+		want bool
+	}{
+		{"forever", CertInfo{}, true},
+		{"current", CertInfo{ValidAfter: now.Add(-time.Hour), ValidBefore: now.Add(time.Hour)}, true},
+		{"expired", CertInfo{ValidAfter: now.Add(-2 * time.Hour), ValidBefore: now.Add(-time.Hour)}, false},
+		{"expiring within the margin", CertInfo{ValidBefore: now.Add(30 * time.Second)}, false},
+		{"not valid yet", CertInfo{ValidAfter: now.Add(time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.cert.Valid(now, time.Minute); got != tt.want {
+			t.Errorf("%s: Valid = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSamePrincipals(t *testing.T) {
+	tests := []struct {
+		a, b []string
+		want bool
+	}{
+		{nil, nil, true},
+		{[]string{"deploy", "admin"}, []string{"admin", "deploy"}, true},
+		{[]string{"deploy"}, []string{"deploy", "admin"}, false},
+		{[]string{"deploy", "deploy"}, []string{"deploy", "admin"}, false},
+	}
+	for _, tt := range tests {
+		a := append([]string(nil), tt.a...)
+		if got := samePrincipals(tt.a, tt.b); got != tt.want {
+			t.Errorf("samePrincipals(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if !reflect.DeepEqual(a, tt.a) {
+			t.Errorf("samePrincipals reordered its argument to %q", tt.a)
+		}
+	}
+}
+
+func keygen(t *testing.T, path string) []byte {
+	t.Helper()
+	if out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", "test", "-f", path).CombinedOutput(); err != nil {
+		t.Fatalf("ssh-keygen: %v: %s", err, out)
+	}
+	pub, err := os.ReadFile(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestEnsureCertLocal(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "state"))
+	keygen(t, filepath.Join(dir, "ca"))
+	pub := keygen(t, filepath.Join(dir, "id"))
+
+	server := config.Server{Name: "api", User: "deploy",
+		CA: &config.CA{Key: filepath.Join(dir, "ca"), Principals: []string{"deploy", "admin"}, TTL: "2h"}}
+	path, err := EnsureCert(context.Background(), server, pub, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := InspectCert(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !samePrincipals(cert.Principals, []string{"deploy", "admin"}) || !strings.HasSuffix(cert.KeyID, "@api") {
+		t.Errorf("certificate %+v", cert)
+	}
+	if lifetime := cert.ValidBefore.Sub(time.Now()); lifetime < 115*time.Minute || lifetime > 2*time.Hour {
+		t.Errorf("certificate valid for another %s, want 2h", lifetime)
+	}
+	signed, _ := os.ReadFile(path)
+
+	// The cached certificate is reused while it fits
+	if _, err := EnsureCert(context.Background(), server, pub, true); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.ReadFile(path); !bytes.Equal(again, signed) {
+		t.Error("a valid certificate was signed again")
+	}
+
+	// and replaced once the principals change
+	server.CA.Principals = []string{"deploy"}
+	if _, err := EnsureCert(context.Background(), server, pub, true); err != nil {
+		t.Fatal(err)
+	}
+	if cert, err := InspectCert(path); err != nil || !reflect.DeepEqual(cert.Principals, []string{"deploy"}) {
+		t.Errorf("principals %q, %v after re-signing, want [deploy]", cert.Principals, err)
+	}
+}
+
+func TestSignRemote(t *testing.T) {
+	const cert = "ssh-ed25519-cert-v01@openssh.com AAAAIHNzaC1lZDI1NTE5LWNlcnQ= api"
+	var got signRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		switch r.URL.Path {
+		case "/json":
+			json.NewEncoder(w).Encode(map[string]string{"certificate": cert})
+		case "/text":
+			w.Write([]byte(cert + "\n"))
+		default:
+			w.Write([]byte("ssh-ed25519 AAAA not-a-cert"))
+		}
+	}))
+	defer server.Close()
+	t.Setenv("SSH_TOOL_CA_TOKEN", "s3cret")
+
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{path: "/json"},
+		{path: "/text"},
+		{path: "/plain-key", wantErr: "did not return an SSH certificate"},
+	}
+	for _, tt := range tests {
+		certPath := filepath.Join(t.TempDir(), "api-cert.pub")
+		ca := &config.CA{URL: server.URL + tt.path, TTL: "8h"}
+		err := signRemote(context.Background(), ca, []byte("ssh-ed25519 AAAA test\n"), certPath, "alice@api", []string{"deploy"})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want one containing %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.path, err)
+			continue
+		}
+		if data, _ := os.ReadFile(certPath); string(data) != cert+"\n" {
+			t.Errorf("%s: wrote %q", tt.path, data)
+		}
+		want := signRequest{PublicKey: "ssh-ed25519 AAAA test", Principals: []string{"deploy"}, KeyID: "alice@api", TTL: 8 * 3600}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: request %+v, want %+v", tt.path, got, want)
+		}
+	}
+
+	t.Setenv("SSH_TOOL_CA_TOKEN", "")
+	err := signRemote(context.Background(), &config.CA{URL: server.URL + "/json"}, []byte("ssh-ed25519 AAAA"), filepath.Join(t.TempDir(), "c"), "alice@api", nil)
+	if err == nil || !strings.Contains(err.Error(), "401 Unauthorized: missing token") {
+		t.Errorf("error = %v, want the endpoint's 401", err)
+	}
+}
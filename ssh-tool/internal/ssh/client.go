@@ -1,16 +1,38 @@
 package ssh
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"ssh-tool/internal/config"
+	"ssh-tool/internal/secrets"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Client struct {
 	Server config.Server
+	// TTY forces a remote pseudo-terminal even when ssh would not ask
+	// for one, e.g. because stdout is being recorded through a pipe.
+	TTY bool
+	// Batch makes Prepare fail rather than prompt for a key passphrase.
+	Batch bool
+	// Mux shares one connection per server between invocations, unless
+	// the server turns it off with mux_idle.
+	Mux bool
+
+	agent      *Agent
+	certFile   string
+	knownHosts string
+	muxSocket  string
+	muxPersist time.Duration
+	// reuse is set when a shared connection is already up, for which the
+	// key and certificate aren't prepared again
+	reuse bool
 }
 
 func NewClient(server config.Server) *Client {
@@ -19,26 +41,268 @@ func NewClient(server config.Server) *Client {
 	}
 }
 
-func (c *Client) Connect() error {
-	// Expand the ~ in the pem file path
-	pemFile := c.Server.PemFile
-	if strings.HasPrefix(pemFile, "~") {
-		home, err := os.UserHomeDir()
+// Destination returns the user@host argument for ssh.
+func (c *Client) Destination() string {
+	return fmt.Sprintf("%s@%s", c.Server.User, c.Server.Hostname)
+}
+
+// Options returns the ssh command line options for the server, everything
+// before the destination. Dedicated fields such as port are passed first,
+// and ssh keeps the first value it sees, so they win over the same setting
+// in the free-form options map.
+func (c *Client) Options() ([]string, error) {
+	return c.options("-p")
+}
+
+// ScpOptions returns Options for scp and sftp, which take the port as -P.
+func (c *Client) ScpOptions() ([]string, error) {
+	return c.options("-P")
+}
+
+func (c *Client) options(portFlag string) ([]string, error) {
+	var args []string
+
+	if c.muxSocket != "" {
+		// A session reusing the connection must not become a master
+		// itself should the connection close, as its key isn't prepared
+		master := "auto"
+		if c.reuse {
+			master = "no"
+		}
+		args = append(args,
+			"-o", "ControlMaster="+master,
+			"-o", "ControlPath="+c.muxSocket,
+			"-o", fmt.Sprintf("ControlPersist=%ds", int(c.muxPersist.Seconds())))
+	}
+
+	auth, err := c.authOptions()
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, auth...)
+
+	if c.Server.Port != 0 {
+		args = append(args, portFlag, strconv.Itoa(c.Server.Port))
+	}
+	if c.Server.ProxyJump != "" {
+		args = append(args, "-J", c.Server.ProxyJump)
+	}
+	if c.Server.Transport == config.TransportSSM {
+		args = append(args, "-o", "ProxyCommand="+SSMProxyCommand(c.Server))
+	}
+	if c.Server.IdentityAgent != "" && c.agent == nil {
+		agent, err := config.ExpandPath(c.Server.IdentityAgent)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "-o", "IdentityAgent="+agent)
+	}
+	if len(c.Server.Env) > 0 {
+		args = append(args, "-o", "SetEnv="+setEnvValue(c.Server.Env))
+	}
+
+	for _, key := range sortedKeys(c.Server.Options) {
+		args = append(args, "-o", key+"="+c.Server.Options[key])
+	}
+
+	return args, nil
+}
+
+// authOptions selects the key, certificate and trusted host keys.
+func (c *Client) authOptions() ([]string, error) {
+	var args []string
+
+	if secrets.IsReference(c.Server.PemFile) {
+		// A reused connection is authenticated already
+		if c.agent == nil && !c.reuse {
+			return nil, fmt.Errorf("key %s is not loaded", c.Server.PemFile)
+		}
+		if c.agent != nil {
+			args = append(args, "-o", "IdentityAgent="+c.agent.Socket)
+		}
+	} else if c.Server.PemFile != "" {
+		// Expand the ~ in the pem file path
+		pemFile, err := config.ExpandPath(c.Server.PemFile)
+		if err != nil {
+			return nil, err
+		}
+
+		// Check if the pem file exists
+		if _, err := os.Stat(pemFile); err != nil {
+			return nil, fmt.Errorf("pem file not found: %v (see 'ssh-tool keys check')", err)
+		}
+		args = append(args, "-i", pemFile)
+
+		// Only offer the configured key, even if the agent holds others;
+		// servers drop the connection after a handful of failed keys.
+		// The agent is still used for this key if it's loaded there.
+		if !hasOption(c.Server.Options, "IdentitiesOnly") {
+			args = append(args, "-o", "IdentitiesOnly=yes")
+		}
+	}
+
+	if c.certFile != "" {
+		args = append(args, "-o", "CertificateFile="+c.certFile)
+	}
+
+	if len(c.Server.HostKeys) > 0 {
+		if c.knownHosts == "" {
+			return nil, fmt.Errorf("host keys of %s are not verified", c.Server.Name)
+		}
+		// Only the pinned keys are trusted and ssh never asks about others
+		args = append(args,
+			"-o", "HostKeyAlias="+c.Server.Name,
+			"-o", "UserKnownHostsFile="+c.knownHosts,
+			"-o", "GlobalKnownHostsFile=/dev/null",
+			"-o", "StrictHostKeyChecking=yes")
+	}
+
+	return args, nil
+}
+
+// Prepare gets the server's key ready before ssh runs. A pem_file that
+// refers to a secrets backend is fetched and loaded into a temporary agent
+// used only by this client, and servers with a CA get a fresh certificate
+// if the cached one is missing or about to expire. Pinned host keys are
+// checked against the server if they haven't been yet, and the tools for
+// an ssm transport are looked up. When a shared connection is up already
+// only the host keys are, so that ssh still trusts nothing but the pins if
+// it has to connect directly. The returned function stops the agent and
+// must be called once ssh has exited.
+func (c *Client) Prepare(ctx context.Context) (func(), error) {
+	cleanup := func() {}
+
+	if persist, ok := c.Server.MuxPersist(); c.Mux && ok {
+		socket, err := MuxSocket(c.Server)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(socket), 0o700); err != nil {
+			return nil, fmt.Errorf("error creating control socket directory: %v", err)
+		}
+		c.muxSocket, c.muxPersist = socket, persist
+
+		// The shared connection is authenticated already. Should it close
+		// before ssh gets to it, ssh falls back to connecting directly,
+		// with the cached certificate if there is one.
+		if _, running := MuxCheck(socket); running {
+			c.reuse = true
+			if c.Server.CA != nil {
+				if cert, err := CertPath(c.Server.Name); err == nil {
+					if _, err := os.Stat(cert); err == nil {
+						c.certFile = cert
+					}
+				}
+			}
+			if err := c.verifyHostKeys(ctx); err != nil {
+				return nil, err
+			}
+			return cleanup, nil
+		}
+	}
+
+	if c.Server.Transport == config.TransportSSM {
+		if err := CheckSSMTools(); err != nil {
+			return nil, err
+		}
+	}
+
+	if secrets.IsReference(c.Server.PemFile) {
+		key, err := secrets.Fetch(ctx, c.Server.PemFile)
+		if err != nil {
+			return nil, err
+		}
+
+		agent, err := StartAgent()
 		if err != nil {
-			return fmt.Errorf("error getting home directory: %v", err)
+			return nil, err
+		}
+		if err := agent.Add(key, c.Batch); err != nil {
+			agent.Stop()
+			return nil, fmt.Errorf("%s: %v", c.Server.PemFile, err)
 		}
-		pemFile = filepath.Join(home, pemFile[1:])
+
+		c.agent = agent
+		cleanup = func() {
+			agent.Stop()
+			c.agent = nil
+		}
+	}
+
+	if c.Server.CA != nil {
+		if err := c.prepareCert(ctx); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+
+	if err := c.verifyHostKeys(ctx); err != nil {
+		cleanup()
+		return nil, err
 	}
+	return cleanup, nil
+}
 
-	// Check if the pem file exists
-	if _, err := os.Stat(pemFile); err != nil {
-		return fmt.Errorf("pem file not found: %v", err)
+func (c *Client) verifyHostKeys(ctx context.Context) error {
+	if len(c.Server.HostKeys) == 0 {
+		return nil
+	}
+	knownHosts, err := VerifyHostKeys(ctx, c.Server)
+	if err != nil {
+		return err
 	}
+	c.knownHosts = knownHosts
+	return nil
+}
 
+func (c *Client) prepareCert(ctx context.Context) error {
+	var pubKey []byte
+	var err error
+	switch {
+	case c.agent != nil:
+		pubKey, err = agentPublicKey(c.agent.Socket)
+	case c.Server.PemFile != "":
+		var pemFile string
+		if pemFile, err = config.ExpandPath(c.Server.PemFile); err == nil {
+			pubKey, err = PublicKey(pemFile, c.Batch)
+		}
+	default:
+		err = fmt.Errorf("ca needs a pem_file to certify")
+	}
+	if err != nil {
+		return err
+	}
+
+	c.certFile, err = EnsureCert(ctx, c.Server, pubKey, c.Batch)
+	return err
+}
+
+// Command builds the ssh invocation for the server. With no remote command
+// the server's remote_command, if any, is run on a forced tty.
+func (c *Client) Command(remote ...string) (*exec.Cmd, error) {
+	args, err := c.Options()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(remote) == 0 && c.Server.RemoteCommand != "" {
+		remote = []string{c.Server.RemoteCommand}
+		args = append(args, "-t")
+	} else if c.TTY {
+		args = append(args, "-t")
+	}
+
+	args = append(args, c.Destination())
+	args = append(args, remote...)
+	return exec.Command("ssh", args...), nil
+}
+
+func (c *Client) Connect() error {
 	// Prepare the SSH command
-	cmd := exec.Command("ssh",
-		"-i", pemFile,
-		fmt.Sprintf("%s@%s", c.Server.User, c.Server.Hostname))
+	cmd, err := c.Command()
+	if err != nil {
+		return err
+	}
 
 	// Set up the command to use the current terminal
 	cmd.Stdin = os.Stdin
@@ -48,3 +312,37 @@ func (c *Client) Connect() error {
 	// Execute the SSH command
 	return cmd.Run()
 }
+
+// setEnvValue renders env as a single SetEnv option. Multiple -o SetEnv
+// flags don't combine on every OpenSSH version, one list always does.
+func setEnvValue(env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for _, key := range sortedKeys(env) {
+		value := env[key]
+		if strings.ContainsAny(value, " \t\"") {
+			value = `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
+// hasOption reports whether options sets name; ssh option names are case
+// insensitive.
+func hasOption(options map[string]string, name string) bool {
+	for key := range options {
+		if strings.EqualFold(key, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,120 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ssh-tool/internal/config"
+)
+
+func TestCommand(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.WriteFile(filepath.Join(home, "prod.pem"), []byte("key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	pem := filepath.Join(home, "prod.pem")
+
+	tests := []struct {
+		name    string
+		server  config.Server
+		tty     bool
+		remote  []string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "plain",
+			server: config.Server{User: "deploy", Hostname: "10.0.1.10"},
+			want:   []string{"deploy@10.0.1.10"},
+		},
+		{
+			name: "fields before options",
+			server: config.Server{
+				User: "deploy", Hostname: "10.0.1.10", PemFile: "~/prod.pem", Port: 2222, ProxyJump: "bastion",
+				IdentityAgent: "~/agent.sock",
+				Env:           map[string]string{"APP_ENV": "prod", "GREETING": `say "hi"`},
+				Options:       map[string]string{"ServerAliveInterval": "30", "Compression": "yes", "Port": "22"},
+			},
+			remote: []string{"uptime"},
+			want: []string{
+				"-i", pem, "-o", "IdentitiesOnly=yes",
+				"-p", "2222", "-J", "bastion",
+				"-o", "IdentityAgent=" + filepath.Join(home, "agent.sock"),
+				"-o", `SetEnv=APP_ENV=prod GREETING="say \"hi\""`,
+				"-o", "Compression=yes", "-o", "Port=22", "-o", "ServerAliveInterval=30",
+				"deploy@10.0.1.10", "uptime",
+			},
+		},
+		{
+			name:   "IdentitiesOnly set by the server",
+			server: config.Server{User: "deploy", Hostname: "10.0.1.10", PemFile: pem, Options: map[string]string{"identitiesonly": "no"}},
+			want:   []string{"-i", pem, "-o", "identitiesonly=no", "deploy@10.0.1.10"},
+		},
+		{
+			name:   "remote command gets a tty",
+			server: config.Server{User: "deploy", Hostname: "10.0.1.10", RemoteCommand: "tmux new -A -s main"},
+			want:   []string{"-t", "deploy@10.0.1.10", "tmux new -A -s main"},
+		},
+		{
+			name:   "command given replaces remote_command",
+			server: config.Server{User: "deploy", Hostname: "10.0.1.10", RemoteCommand: "tmux new -A -s main"},
+			remote: []string{"df", "-h"},
+			want:   []string{"deploy@10.0.1.10", "df", "-h"},
+		},
+		{
+			name:   "forced tty",
+			server: config.Server{User: "deploy", Hostname: "10.0.1.10"},
+			tty:    true,
+			want:   []string{"-t", "deploy@10.0.1.10"},
+		},
+		{
+			name:    "missing key",
+			server:  config.Server{User: "deploy", Hostname: "10.0.1.10", PemFile: "~/missing.pem"},
+			wantErr: "pem file not found",
+		},
+		{
+			name:    "secret key not loaded",
+			server:  config.Server{User: "deploy", Hostname: "10.0.1.10", PemFile: "vault://secret/ssh/prod"},
+			wantErr: "key vault://secret/ssh/prod is not loaded",
+		},
+		{
+			name:    "host keys not verified",
+			server:  config.Server{Name: "api", User: "deploy", Hostname: "10.0.1.10", HostKeys: []string{"ssh-ed25519 SHA256:abc"}},
+			wantErr: "host keys of api are not verified",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(tt.server)
+			client.TTY = tt.tty
+			cmd, err := client.Command(tt.remote...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cmd.Args[1:]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("args %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScpOptions(t *testing.T) {
+	client := NewClient(config.Server{User: "deploy", Hostname: "10.0.1.10", Port: 2222})
+	got, err := client.ScpOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"-P", "2222"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ScpOptions = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,259 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"ssh-tool/internal/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HostKey is one public host key of a server.
+type HostKey struct {
+	// Type is the key algorithm, e.g. ssh-ed25519
+	Type string
+	// Key is the base64 public key
+	Key         string
+	Fingerprint string
+}
+
+// Pin is the form host keys are stored in the config, "type SHA256:...".
+func (k HostKey) Pin() string {
+	return k.Type + " " + k.Fingerprint
+}
+
+// HostKeyMismatchError is returned when none of the keys a server presents
+// is one of its pinned keys.
+type HostKeyMismatchError struct {
+	Server    config.Server
+	Expected  []string
+	Presented []HostKey
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return e.Diff() + fmt.Sprintf("Refusing to connect. If the key was changed on purpose, run 'ssh-tool hostkeys scan %s'", e.Server.Name)
+}
+
+// Diff lists the pinned keys against the presented ones.
+func (e *HostKeyMismatchError) Diff() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "host key mismatch for %s (%s):\n", e.Server.Name, e.Server.Hostname)
+	for _, pin := range e.Expected {
+		fmt.Fprintf(&b, "  - %s  (expected, from config)\n", pin)
+	}
+	for _, key := range e.Presented {
+		fmt.Fprintf(&b, "  + %s  (presented by server)\n", key.Pin())
+	}
+	return b.String()
+}
+
+// KnownHostsPath returns the known_hosts file ssh-tool maintains for a
+// server with pinned host keys. It only ever holds keys matching the pins.
+func KnownHostsPath(server string) (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "known_hosts.d", server), nil
+}
+
+// ScanHostKeys asks the server for its host keys. Servers behind a jump
+// host can't be reached by ssh-keyscan, for those the key ssh negotiates is
+// recorded from a login attempt instead.
+func ScanHostKeys(ctx context.Context, server config.Server, timeout time.Duration) ([]HostKey, error) {
+	// ssh-keyscan can only connect directly
+	if server.ProxyJump != "" || server.Transport == config.TransportSSM {
+		return scanThroughProxy(ctx, server, timeout)
+	}
+
+	seconds := int(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	args := []string{"-T", strconv.Itoa(seconds)}
+	if server.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(server.Port))
+	}
+	args = append(args, server.Hostname)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "ssh-keyscan", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ssh-keyscan: %s", LastLine(stderr.String(), err))
+	}
+	keys, err := parseKnownHosts(out)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no host keys received from %s", server.Hostname)
+	}
+	return keys, nil
+}
+
+func scanThroughProxy(ctx context.Context, server config.Server, timeout time.Duration) ([]HostKey, error) {
+	tmp, err := os.CreateTemp("", "ssh-tool-known-hosts-")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	seconds := int(timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	var args []string
+	if server.Transport == config.TransportSSM {
+		if err := CheckSSMTools(); err != nil {
+			return nil, err
+		}
+		args = append(args, "-o", "ProxyCommand="+SSMProxyCommand(server))
+	} else {
+		args = append(args, "-J", server.ProxyJump)
+	}
+	args = append(args,
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout="+strconv.Itoa(seconds),
+		"-o", "StrictHostKeyChecking=accept-new",
+		"-o", "UserKnownHostsFile="+tmp.Name(),
+		"-o", "HashKnownHosts=no")
+	if server.Port != 0 {
+		args = append(args, "-p", strconv.Itoa(server.Port))
+	}
+	// The login itself may fail, the key is recorded before authentication
+	args = append(args, server.User+"@"+server.Hostname, "true")
+	exec.CommandContext(ctx, "ssh", args...).Run()
+
+	data, err := os.ReadFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseKnownHosts(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no host key received from %s through %s", server.Hostname, server.ProxyJump)
+	}
+	return keys, nil
+}
+
+// parseKnownHosts reads "host type key" lines and fingerprints each key.
+func parseKnownHosts(data []byte) ([]HostKey, error) {
+	var keys []HostKey
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		if len(fields) < 3 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, HostKey{Type: fields[1], Key: fields[2]})
+		lines = append(lines, "host "+fields[1]+" "+fields[2])
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	// ssh-keygen fingerprints every line of a known_hosts file in order
+	cmd := exec.Command("ssh-keygen", "-l", "-E", "sha256", "-f", "-")
+	cmd.Stdin = strings.NewReader(strings.Join(lines, "\n") + "\n")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("error fingerprinting host keys: %s", LastLine(string(out), err))
+	}
+	var infos []KeyInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		if info, ok := parseKeyLine(strings.TrimSpace(line)); ok {
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) != len(keys) {
+		return nil, fmt.Errorf("unexpected ssh-keygen output: %s", out)
+	}
+	for i := range keys {
+		keys[i].Fingerprint = infos[i].Fingerprint
+	}
+	return keys, nil
+}
+
+// MatchHostKeys returns the keys whose pin is one of pins.
+func MatchHostKeys(keys []HostKey, pins []string) []HostKey {
+	var matched []HostKey
+	for _, key := range keys {
+		for _, pin := range pins {
+			if samePin(key.Pin(), pin) {
+				matched = append(matched, key)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// samePin compares pins by fingerprint, so the type may be left out in the
+// config.
+func samePin(a, b string) bool {
+	fa := strings.Fields(a)
+	fb := strings.Fields(b)
+	return len(fa) > 0 && len(fb) > 0 && fa[len(fa)-1] == fb[len(fb)-1]
+}
+
+// VerifyHostKeys makes sure the known_hosts file of a server with pinned
+// keys holds keys matching the pins, scanning the server if it doesn't.
+// It returns the file's path, or a *HostKeyMismatchError.
+func VerifyHostKeys(ctx context.Context, server config.Server) (string, error) {
+	path, err := KnownHostsPath(server.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if data, err := os.ReadFile(path); err == nil {
+		if keys, err := parseKnownHosts(data); err == nil && len(keys) > 0 &&
+			len(MatchHostKeys(keys, server.HostKeys)) == len(keys) {
+			return path, nil
+		}
+	}
+
+	matched, err := CheckHostKeys(ctx, server)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", err
+	}
+	// Entries are stored under the server name, see HostKeyAlias in Options
+	var b strings.Builder
+	for _, key := range matched {
+		fmt.Fprintf(&b, "%s %s %s\n", server.Name, key.Type, key.Key)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// CheckHostKeys scans the server and returns the presented keys that match
+// its pins, or a *HostKeyMismatchError if none do.
+func CheckHostKeys(ctx context.Context, server config.Server) ([]HostKey, error) {
+	keys, err := ScanHostKeys(ctx, server, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("error verifying host key of %s: %v", server.Name, err)
+	}
+	matched := MatchHostKeys(keys, server.HostKeys)
+	if len(matched) == 0 {
+		return nil, &HostKeyMismatchError{Server: server, Expected: server.HostKeys, Presented: keys}
+	}
+	return matched, nil
+}
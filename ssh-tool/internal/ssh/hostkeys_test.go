@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"ssh-tool/internal/config"
+)
+
+// hostKey generates a key and returns it as ssh-keyscan prints it.
+func hostKey(t *testing.T) (HostKey, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "host_key")
+	fields := strings.Fields(string(keygen(t, path)))
+	info, err := InspectKey(path + ".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return HostKey{Type: fields[0], Key: fields[1], Fingerprint: info.Fingerprint}, fields[0] + " " + fields[1]
+}
+
+func TestSamePin(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"ssh-ed25519 SHA256:abc", "ssh-ed25519 SHA256:abc", true},
+		{"ssh-ed25519 SHA256:abc", "SHA256:abc", true},
+		{"ssh-ed25519 SHA256:abc", "ssh-ed25519 SHA256:abd", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := samePin(tt.a, tt.b); got != tt.want {
+			t.Errorf("samePin(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestParseKnownHosts(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	first, firstLine := hostKey(t)
+	second, secondLine := hostKey(t)
+
+	data := "# 10.0.1.10:22 SSH-2.0-OpenSSH_9.6\n10.0.1.10 " + firstLine + "\n\n10.0.1.10 " + secondLine + "\n"
+	keys, err := parseKnownHosts([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []HostKey{first, second}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %+v\nwant %+v", keys, want)
+	}
+	if keys, err := parseKnownHosts([]byte("# nothing\n")); keys != nil || err != nil {
+		t.Errorf("parseKnownHosts of no keys = %v, %v", keys, err)
+	}
+
+	matched := MatchHostKeys(keys, []string{second.Fingerprint, "ssh-rsa SHA256:other"})
+	if want := []HostKey{second}; !reflect.DeepEqual(matched, want) {
+		t.Errorf("MatchHostKeys = %+v, want %+v", matched, want)
+	}
+}
+
+func TestVerifyHostKeys(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	key, line := hostKey(t)
+	other, _ := hostKey(t)
+
+	scanned := filepath.Join(t.TempDir(), "scanned")
+	fakeCommand(t, "ssh-keyscan", "touch "+scanned+"\necho '10.0.1.10 "+line+"'")
+
+	// The server presents a key that isn't pinned
+	server := config.Server{Name: "api", Hostname: "10.0.1.10", HostKeys: []string{other.Pin()}}
+	_, err := VerifyHostKeys(context.Background(), server)
+	var mismatch *HostKeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("error = %v, want a host key mismatch", err)
+	}
+	want := "host key mismatch for api (10.0.1.10):\n" +
+		"  - " + other.Pin() + "  (expected, from config)\n" +
+		"  + " + key.Pin() + "  (presented by server)\n"
+	if mismatch.Diff() != want {
+		t.Errorf("diff:\n%s\nwant:\n%s", mismatch.Diff(), want)
+	}
+
+	// Once it matches, the key is stored under the server's name
+	server.HostKeys = []string{key.Pin()}
+	path, err := VerifyHostKeys(context.Background(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "api "+line+"\n" {
+		t.Errorf("known_hosts holds %q", data)
+	}
+
+	// and isn't scanned again while the file matches the pins
+	os.Remove(scanned)
+	if _, err := VerifyHostKeys(context.Background(), server); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(scanned); err == nil {
+		t.Error("verified keys were scanned again")
+	}
+}
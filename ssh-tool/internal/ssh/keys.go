@@ -0,0 +1,143 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// KeyInfo describes a key the way ssh-keygen -l and ssh-add -l print it.
+type KeyInfo struct {
+	Type        string
+	Bits        int
+	Fingerprint string
+	Comment     string
+}
+
+// InspectKey reads the type and SHA256 fingerprint of a key file. Private
+// keys work as well as public ones; ssh-keygen uses a .pub next to the key
+// if there is one, so encrypted keys don't need their passphrase.
+func InspectKey(path string) (KeyInfo, error) {
+	out, err := exec.Command("ssh-keygen", "-l", "-E", "sha256", "-f", path).CombinedOutput()
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("%s", LastLine(string(out), err))
+	}
+	info, ok := parseKeyLine(strings.TrimSpace(string(out)))
+	if !ok {
+		return KeyInfo{}, fmt.Errorf("unexpected ssh-keygen output: %s", out)
+	}
+	return info, nil
+}
+
+// AgentSocket returns the socket of the user's running ssh-agent.
+func AgentSocket() (string, error) {
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	if sock == "" {
+		return "", fmt.Errorf("no ssh-agent running (SSH_AUTH_SOCK is not set), start one with: eval $(ssh-agent)")
+	}
+	return sock, nil
+}
+
+// AgentKeys lists the keys held by the agent listening on sock.
+func AgentKeys(sock string) ([]KeyInfo, error) {
+	cmd := exec.Command("ssh-add", "-l", "-E", "sha256")
+	cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+	out, err := cmd.CombinedOutput()
+
+	// ssh-add exits 1 for an empty agent and 2 if it can't reach it
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing agent keys: %s", LastLine(string(out), err))
+	}
+
+	var keys []KeyInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		if info, ok := parseKeyLine(strings.TrimSpace(line)); ok {
+			keys = append(keys, info)
+		}
+	}
+	return keys, nil
+}
+
+// AddKeyFile loads the key at path into the agent on sock, asking for its
+// passphrase on the terminal if it has one. A non-zero lifetime makes the
+// agent forget the key after that long.
+func AddKeyFile(sock, path string, lifetime time.Duration) error {
+	return addKey(sock, []string{path}, nil, lifetime, false)
+}
+
+// AddKey loads a private key held in memory into the agent on sock.
+func AddKey(sock string, key []byte, lifetime time.Duration) error {
+	return addKey(sock, []string{"-"}, key, lifetime, false)
+}
+
+func addKey(sock string, args []string, key []byte, lifetime time.Duration, batch bool) error {
+	if lifetime > 0 {
+		args = append([]string{"-t", strconv.Itoa(int(lifetime.Seconds()))}, args...)
+	}
+	cmd := exec.Command("ssh-add", append([]string{"-q"}, args...)...)
+	if key != nil {
+		cmd.Stdin = bytes.NewReader(key)
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stdout = os.Stderr
+	cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if batch {
+		cmd.Env = append(cmd.Env, "SSH_ASKPASS_REQUIRE=never")
+		// Without a controlling terminal ssh-add can't open /dev/tty
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	} else {
+		cmd.Stderr = os.Stderr
+	}
+
+	if err := cmd.Run(); err != nil {
+		if batch && strings.Contains(stderr.String(), "passphrase") {
+			return fmt.Errorf("key is passphrase protected, connect interactively instead")
+		}
+		return fmt.Errorf("error loading key: %s", LastLine(stderr.String(), err))
+	}
+	return nil
+}
+
+// parseKeyLine parses "256 SHA256:abc comment (ED25519)".
+func parseKeyLine(line string) (KeyInfo, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return KeyInfo{}, false
+	}
+	bits, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return KeyInfo{}, false
+	}
+
+	info := KeyInfo{Bits: bits, Fingerprint: fields[1]}
+	last := fields[len(fields)-1]
+	if strings.HasPrefix(last, "(") && strings.HasSuffix(last, ")") {
+		info.Type = strings.Trim(last, "()")
+		fields = fields[:len(fields)-1]
+	}
+	info.Comment = strings.Join(fields[2:], " ")
+	return info, true
+}
+
+// LastLine returns the last line a failed command printed, which usually
+// says what went wrong, or err if it printed nothing.
+func LastLine(out string, err error) string {
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if line := strings.TrimSpace(lines[len(lines)-1]); line != "" {
+		return line
+	}
+	return err.Error()
+}
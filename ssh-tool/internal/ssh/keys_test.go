@@ -0,0 +1,86 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyLine(t *testing.T) {
+	tests := []struct {
+		line   string
+		want   KeyInfo
+		wantOK bool
+	}{
+		{"256 SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU alice@laptop (ED25519)",
+			KeyInfo{Type: "ED25519", Bits: 256, Fingerprint: "SHA256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU", Comment: "alice@laptop"}, true},
+		{"3072 SHA256:abc deploy key for prod (RSA)",
+			KeyInfo{Type: "RSA", Bits: 3072, Fingerprint: "SHA256:abc", Comment: "deploy key for prod"}, true},
+		{"256 SHA256:abc no comment", KeyInfo{Bits: 256, Fingerprint: "SHA256:abc", Comment: "no comment"}, true},
+		{"The agent has no identities.", KeyInfo{}, false},
+		{"256 SHA256:abc", KeyInfo{}, false},
+		{"", KeyInfo{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseKeyLine(tt.line)
+		if ok != tt.wantOK || got != tt.want {
+			t.Errorf("parseKeyLine(%q) = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+// fakeCommand puts an executable script called name first in PATH.
+func fakeCommand(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestAgentKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		want    []KeyInfo
+		wantErr string
+	}{
+		{
+			name: "keys",
+			script: `test "$SSH_AUTH_SOCK" = /tmp/agent.sock || exit 2
+echo "256 SHA256:abc alice@laptop (ED25519)"
+echo "3072 SHA256:def deploy (RSA)"`,
+			want: []KeyInfo{
+				{Type: "ED25519", Bits: 256, Fingerprint: "SHA256:abc", Comment: "alice@laptop"},
+				{Type: "RSA", Bits: 3072, Fingerprint: "SHA256:def", Comment: "deploy"},
+			},
+		},
+		{name: "empty agent", script: "echo 'The agent has no identities.'\nexit 1"},
+		{
+			name:    "agent unreachable",
+			script:  "echo 'Could not open a connection to your authentication agent.' >&2\nexit 2",
+			wantErr: "error listing agent keys: Could not open a connection to your authentication agent.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeCommand(t, "ssh-add", tt.script)
+			got, err := AgentKeys("/tmp/agent.sock")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
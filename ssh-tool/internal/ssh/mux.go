@@ -0,0 +1,119 @@
+package ssh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"ssh-tool/internal/config"
+	"strconv"
+)
+
+// maxSocketPath keeps control sockets below the unix socket path limit,
+// leaving room for the random suffix ssh adds while creating one.
+const maxSocketPath = 86
+
+var masterPIDPattern = regexp.MustCompile(`pid=(\d+)`)
+
+// MuxSocket returns the control socket of the shared connection to server.
+// Like ssh's %C it is keyed on a hash of user@host:port as well as the
+// name, so a server that now points elsewhere never reuses the connection
+// to its old address.
+func MuxSocket(server config.Server) (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	port := server.Port
+	if port == 0 {
+		port = 22
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s@%s:%d", server.User, server.Hostname, port)))
+	path := filepath.Join(dir, "mux", server.Name+"-"+hex.EncodeToString(sum[:8]))
+	if len(path) > maxSocketPath {
+		sum = sha256.Sum256([]byte(server.Name + "\x00" + hex.EncodeToString(sum[:])))
+		path = filepath.Join(os.TempDir(), "ssh-tool-mux-"+strconv.Itoa(os.Getuid()), hex.EncodeToString(sum[:8]))
+	}
+	return path, nil
+}
+
+// MuxCheck asks the master behind socket whether it is running and returns
+// its pid.
+func MuxCheck(socket string) (int, bool) {
+	if _, err := os.Stat(socket); err != nil {
+		return 0, false
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command("ssh", "-S", socket, "-O", "check", "ssh-tool")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return 0, false
+	}
+	pid := 0
+	if m := masterPIDPattern.FindStringSubmatch(stderr.String()); m != nil {
+		pid, _ = strconv.Atoi(m[1])
+	}
+	return pid, true
+}
+
+// MuxStop closes the shared connection behind socket, ending every session
+// that still uses it.
+func MuxStop(socket string) error {
+	out, err := exec.Command("ssh", "-S", socket, "-O", "exit", "ssh-tool").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", LastLine(string(out), err))
+	}
+	return nil
+}
+
+// Multiplexed reports whether the client shares a connection; only valid
+// after Prepare.
+func (c *Client) Multiplexed() bool {
+	return c.muxSocket != ""
+}
+
+// Running reports whether the client's shared connection is up.
+func (c *Client) Running() bool {
+	_, ok := MuxCheck(c.muxSocket)
+	return ok
+}
+
+// StartMaster opens the shared connection in the background if it isn't
+// running yet. Prepare must have been called with Mux set.
+func (c *Client) StartMaster() error {
+	if _, ok := MuxCheck(c.muxSocket); ok {
+		return nil
+	}
+	args, err := c.Options()
+	if err != nil {
+		return err
+	}
+	// -f backgrounds ssh once it has authenticated
+	args = append(args, "-f", "-N", c.Destination())
+
+	cmd := exec.Command("ssh", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error opening connection to %s: %v", c.Server.Name, err)
+	}
+	return nil
+}
+
+// Forward adds a port forward such as "-L 8080:localhost:80" to the
+// running shared connection, or removes it with cancel.
+func (c *Client) Forward(flag, spec string, cancel bool) error {
+	op := "forward"
+	if cancel {
+		op = "cancel"
+	}
+	out, err := exec.Command("ssh", "-S", c.muxSocket, "-O", op, flag, spec, c.Destination()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %s", flag, spec, LastLine(string(out), err))
+	}
+	return nil
+}
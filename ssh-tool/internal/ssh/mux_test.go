@@ -0,0 +1,108 @@
+package ssh
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"ssh-tool/internal/config"
+)
+
+func TestMuxSocket(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+
+	socket := func(server config.Server) string {
+		path, err := MuxSocket(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	api := config.Server{Name: "api", User: "deploy", Hostname: "10.0.1.10"}
+	path := socket(api)
+	if dir := filepath.Join(state, "ssh-tool", "mux"); filepath.Dir(path) != dir || !strings.HasPrefix(filepath.Base(path), "api-") {
+		t.Errorf("socket %s, want api-<hash> in %s", path, dir)
+	}
+	if socket(api) != path {
+		t.Error("the socket path isn't stable")
+	}
+	if socket(withPort(api, 22)) != path {
+		t.Error("port 22 and no port have different sockets")
+	}
+
+	// A server that points elsewhere gets another connection
+	for _, changed := range []config.Server{
+		{Name: "api", User: "root", Hostname: "10.0.1.10"},
+		{Name: "api", User: "deploy", Hostname: "10.0.1.11"},
+		{Name: "api", User: "deploy", Hostname: "10.0.1.10", Port: 2222},
+	} {
+		if socket(changed) == path {
+			t.Errorf("%+v shares the socket of %+v", changed, api)
+		}
+	}
+
+	// Paths too long for a unix socket move to the temp directory
+	t.Setenv("XDG_STATE_HOME", filepath.Join(state, strings.Repeat("x", 80)))
+	long := socket(api)
+	if len(long) > maxSocketPath || strings.HasPrefix(long, state) {
+		t.Errorf("socket %s is %d bytes long", long, len(long))
+	}
+	if socket(config.Server{Name: "web", User: "deploy", Hostname: "10.0.1.10"}) == long {
+		t.Error("servers share a shortened socket")
+	}
+}
+
+func withPort(server config.Server, port int) config.Server {
+	server.Port = port
+	return server
+}
+
+func TestMuxOptions(t *testing.T) {
+	tests := []struct {
+		reuse bool
+		want  []string
+	}{
+		{false, []string{"-o", "ControlMaster=auto", "-o", "ControlPath=/tmp/mux/api", "-o", "ControlPersist=600s", "deploy@10.0.1.10"}},
+		// A session on a running connection never becomes a master itself
+		{true, []string{"-o", "ControlMaster=no", "-o", "ControlPath=/tmp/mux/api", "-o", "ControlPersist=600s", "deploy@10.0.1.10"}},
+	}
+	for _, tt := range tests {
+		client := NewClient(config.Server{Name: "api", User: "deploy", Hostname: "10.0.1.10"})
+		client.muxSocket, client.muxPersist, client.reuse = "/tmp/mux/api", 10*time.Minute, tt.reuse
+		cmd, err := client.Command()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cmd.Args[1:]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("reuse %v: args %q\nwant %q", tt.reuse, got, tt.want)
+		}
+	}
+}
+
+func TestMuxCheck(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "api")
+	if _, ok := MuxCheck(socket); ok {
+		t.Error("MuxCheck found a master without a socket")
+	}
+
+	if err := os.WriteFile(socket, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fakeCommand(t, "ssh", `echo "Master running (pid=4242)" >&2`)
+	if pid, ok := MuxCheck(socket); !ok || pid != 4242 {
+		t.Errorf("MuxCheck = %d, %v, want 4242, true", pid, ok)
+	}
+
+	fakeCommand(t, "ssh", `echo "Control socket connect($2): Connection refused" >&2; exit 255`)
+	if _, ok := MuxCheck(socket); ok {
+		t.Error("MuxCheck reported a master that refused the connection")
+	}
+	if err := MuxStop(socket); err == nil || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("MuxStop error = %v, want ssh's message", err)
+	}
+}
@@ -0,0 +1,32 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Sftp runs sftp batch commands such as "get remote local" on the server,
+// stopping at the first one that fails. Paths are quoted with SftpQuote.
+func (c *Client) Sftp(commands ...string) error {
+	args, err := c.ScpOptions()
+	if err != nil {
+		return err
+	}
+	args = append(args, "-q", "-b", "-", c.Destination())
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("sftp", args...)
+	cmd.Stdin = strings.NewReader(strings.Join(commands, "\n") + "\n")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sftp: %s", LastLine(stderr.String(), err))
+	}
+	return nil
+}
+
+// SftpQuote quotes a path for an sftp batch command.
+func SftpQuote(path string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(path) + `"`
+}
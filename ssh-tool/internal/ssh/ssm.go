@@ -0,0 +1,107 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/panes"
+	"strings"
+)
+
+// ssmDocument is the Session Manager document that forwards a session to
+// the instance's sshd, so ssh runs over it exactly as over TCP.
+const ssmDocument = "AWS-StartSSHSession"
+
+const pluginInstallURL = "https://docs.aws.amazon.com/systems-manager/latest/userguide/session-manager-working-with-install-plugin.html"
+
+// SSMProxyCommand returns the ProxyCommand that tunnels ssh to server
+// through an SSM session. It runs the aws CLI, which hands the session to
+// the session-manager-plugin, so the usual profiles, SSO sessions and
+// credentials apply. ssh runs it with a shell after expanding its %
+// tokens, so the server's fields are quoted for both.
+func SSMProxyCommand(server config.Server) string {
+	args := []string{"aws", "ssm", "start-session",
+		"--target", server.InstanceID,
+		"--document-name", ssmDocument}
+	args = append(args, awsArgs(server)...)
+	for i, arg := range args {
+		args[i] = strings.ReplaceAll(arg, "%", "%%")
+	}
+	// %p is the port ssh would have connected to
+	args = append(args, "--parameters", "portNumber=%p")
+	return panes.ShellJoin(args)
+}
+
+func awsArgs(server config.Server) []string {
+	var args []string
+	if server.AWSProfile != "" {
+		args = append(args, "--profile", server.AWSProfile)
+	}
+	if server.AWSRegion != "" {
+		args = append(args, "--region", server.AWSRegion)
+	}
+	return args
+}
+
+// CheckSSMTools reports a missing aws CLI or session-manager-plugin, which
+// would otherwise only surface as a cryptic ProxyCommand failure.
+func CheckSSMTools() error {
+	if _, err := exec.LookPath("aws"); err != nil {
+		return fmt.Errorf("transport ssm needs the aws CLI, which is not in PATH, see https://aws.amazon.com/cli/")
+	}
+	if _, err := exec.LookPath("session-manager-plugin"); err != nil {
+		return fmt.Errorf("transport ssm needs the Session Manager plugin, which is not in PATH, see %s", pluginInstallURL)
+	}
+	return nil
+}
+
+// DiagnoseSSM finds out why an SSM session to server failed: missing
+// permissions, an instance that isn't registered with SSM or an agent that
+// is offline. It returns nil if SSM sees nothing wrong.
+func DiagnoseSSM(ctx context.Context, server config.Server) error {
+	if err := CheckSSMTools(); err != nil {
+		return err
+	}
+
+	args := append([]string{"ssm", "describe-instance-information",
+		"--filters", "Key=InstanceIds,Values=" + server.InstanceID,
+		"--output", "json"}, awsArgs(server)...)
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "aws", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := LastLine(stderr.String(), err)
+		switch {
+		case strings.Contains(msg, "AccessDenied"), strings.Contains(msg, "UnauthorizedOperation"):
+			return fmt.Errorf("your AWS identity is not allowed to use SSM (%s), it needs ssm:StartSession on %s with the %s document", msg, server.InstanceID, ssmDocument)
+		case strings.Contains(msg, "credentials"), strings.Contains(msg, "ExpiredToken"), strings.Contains(msg, "Token has expired"), strings.Contains(msg, "SSO"):
+			login := "aws sso login"
+			if server.AWSProfile != "" {
+				login += " --profile " + server.AWSProfile
+			}
+			return fmt.Errorf("no valid AWS credentials (%s), log in first, e.g. with '%s'", msg, login)
+		}
+		return fmt.Errorf("aws ssm describe-instance-information failed: %s", msg)
+	}
+
+	var out struct {
+		InstanceInformationList []struct {
+			InstanceId string
+			PingStatus string
+		}
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return fmt.Errorf("error parsing describe-instance-information output: %v", err)
+	}
+	if len(out.InstanceInformationList) == 0 {
+		return fmt.Errorf("%s is not managed by SSM: the SSM agent is not installed or running, or the instance profile lacks the AmazonSSMManagedInstanceCore policy", server.InstanceID)
+	}
+	if status := out.InstanceInformationList[0].PingStatus; status != "Online" {
+		return fmt.Errorf("the SSM agent on %s is %s rather than Online", server.InstanceID, status)
+	}
+	return nil
+}
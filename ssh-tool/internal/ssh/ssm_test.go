@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"context"
+	"os/exec"
+	"ssh-tool/internal/config"
+	"strings"
+	"testing"
+)
+
+func TestSSMProxyCommand(t *testing.T) {
+	tests := []struct {
+		name   string
+		server config.Server
+		want   string
+		// args is what aws receives once ssh has expanded the tokens, with
+		// %p as port 22, and the shell has run the command
+		args string
+	}{
+		{
+			name:   "instance",
+			server: config.Server{InstanceID: "i-0abc123"},
+			want:   "aws ssm start-session --target i-0abc123 --document-name AWS-StartSSHSession --parameters portNumber=%p",
+			args:   "ssm start-session --target i-0abc123 --document-name AWS-StartSSHSession --parameters portNumber=22",
+		},
+		{
+			name:   "profile and region",
+			server: config.Server{InstanceID: "i-0abc123", AWSProfile: "prod", AWSRegion: "eu-west-2"},
+			want:   "aws ssm start-session --target i-0abc123 --document-name AWS-StartSSHSession --profile prod --region eu-west-2 --parameters portNumber=%p",
+			args:   "ssm start-session --target i-0abc123 --document-name AWS-StartSSHSession --profile prod --region eu-west-2 --parameters portNumber=22",
+		},
+		{
+			name:   "shell and ssh tokens",
+			server: config.Server{InstanceID: "i-1; touch pwned", AWSProfile: "it's %h"},
+			want:   `aws ssm start-session --target 'i-1; touch pwned' --document-name AWS-StartSSHSession --profile 'it'\''s %%h' --parameters portNumber=%p`,
+			args:   "ssm start-session --target i-1; touch pwned --document-name AWS-StartSSHSession --profile it's %h --parameters portNumber=22",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SSMProxyCommand(tt.server)
+			if got != tt.want {
+				t.Fatalf("SSMProxyCommand = %s\nwant %s", got, tt.want)
+			}
+
+			fakeCommand(t, "aws", `echo "$@"`)
+			expanded := strings.NewReplacer("%p", "22", "%%", "%").Replace(got)
+			out, err := exec.Command("sh", "-c", expanded).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if args := strings.TrimSuffix(string(out), "\n"); args != tt.args {
+				t.Errorf("aws got %q, want %q", args, tt.args)
+			}
+		})
+	}
+}
+
+func TestCheckSSMTools(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if err := CheckSSMTools(); err == nil || !strings.Contains(err.Error(), "aws CLI") {
+		t.Errorf("CheckSSMTools without aws = %v, want the aws CLI missing", err)
+	}
+	fakeCommand(t, "aws", "")
+	if err := CheckSSMTools(); err == nil || !strings.Contains(err.Error(), "Session Manager plugin") {
+		t.Errorf("CheckSSMTools without the plugin = %v, want the plugin missing", err)
+	}
+	fakeCommand(t, "session-manager-plugin", "")
+	if err := CheckSSMTools(); err != nil {
+		t.Errorf("CheckSSMTools = %v, want nil", err)
+	}
+}
+
+func TestDiagnoseSSM(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr string
+	}{
+		{
+			name: "online",
+			script: `test "$4" = Key=InstanceIds,Values=i-0abc123 || exit 2
+test "$7 $8" = "--profile prod" || exit 2
+echo '{"InstanceInformationList": [{"InstanceId": "i-0abc123", "PingStatus": "Online"}]}'`,
+		},
+		{
+			name:    "not managed",
+			script:  `echo '{"InstanceInformationList": []}'`,
+			wantErr: "i-0abc123 is not managed by SSM",
+		},
+		{
+			name:    "offline",
+			script:  `echo '{"InstanceInformationList": [{"InstanceId": "i-0abc123", "PingStatus": "ConnectionLost"}]}'`,
+			wantErr: "the SSM agent on i-0abc123 is ConnectionLost rather than Online",
+		},
+		{
+			name:    "access denied",
+			script:  `echo "An error occurred (AccessDeniedException) when calling the DescribeInstanceInformation operation" >&2; exit 254`,
+			wantErr: "your AWS identity is not allowed to use SSM",
+		},
+		{
+			name:    "expired credentials",
+			script:  `echo "Error when retrieving token from sso: Token has expired and refresh failed" >&2; exit 255`,
+			wantErr: "log in first, e.g. with 'aws sso login --profile prod'",
+		},
+		{
+			name:    "other failure",
+			script:  `echo "Could not connect to the endpoint URL" >&2; exit 255`,
+			wantErr: "aws ssm describe-instance-information failed: Could not connect to the endpoint URL",
+		},
+		{
+			name:    "bad output",
+			script:  `echo 'not json'`,
+			wantErr: "error parsing describe-instance-information output",
+		},
+	}
+
+	server := config.Server{Name: "bastion", InstanceID: "i-0abc123", AWSProfile: "prod"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PATH", t.TempDir())
+			fakeCommand(t, "session-manager-plugin", "")
+			fakeCommand(t, "aws", tt.script)
+
+			err := DiagnoseSSM(context.Background(), server)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("DiagnoseSSM = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DiagnoseSSM = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
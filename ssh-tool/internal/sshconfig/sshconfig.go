@@ -0,0 +1,413 @@
+package sshconfig
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Host is the subset of an OpenSSH Host block that maps onto a server entry.
+type Host struct {
+	Alias        string
+	HostName     string
+	User         string
+	IdentityFile string
+	ProxyJump    string
+	Port         int
+	// ProxyCommand runs through a shell and is written unquoted
+	ProxyCommand string
+
+	IdentityAgent string
+	RemoteCommand string
+	SetEnv        map[string]string
+	// Options holds any other keywords, written as-is on export
+	Options map[string]string
+}
+
+// block is a raw Host section: its patterns and keyword/value pairs in the
+// order they appeared, keywords as written. scope holds the patterns of
+// the Host blocks an Include was in, which the alias must match as well.
+type block struct {
+	patterns []string
+	scope    [][]string
+	options  [][2]string
+}
+
+// matches reports whether the block applies to alias.
+func (b block) matches(alias string) bool {
+	for _, patterns := range b.scope {
+		if !matchPatterns(patterns, alias) {
+			return false
+		}
+	}
+	return matchPatterns(b.patterns, alias)
+}
+
+// ParseFile reads an OpenSSH client config, following Include directives,
+// and returns one Host per concrete alias.
+func ParseFile(path string) ([]Host, error) {
+	blocks, err := readBlocks(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resolve(blocks), nil
+}
+
+// Parse is like ParseFile for an already opened config. Relative Include
+// paths are resolved against ~/.ssh.
+func Parse(r io.Reader) ([]Host, error) {
+	blocks, err := parseBlocks(r, 0)
+	if err != nil {
+		return nil, err
+	}
+	return resolve(blocks), nil
+}
+
+func readBlocks(path string, depth int) ([]block, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocks, err := parseBlocks(f, depth)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return blocks, nil
+}
+
+func parseBlocks(r io.Reader, depth int) ([]block, error) {
+	if depth > 16 {
+		return nil, fmt.Errorf("too many nested Include directives")
+	}
+
+	// Options before the first Host line apply to every host
+	blocks := []block{{patterns: []string{"*"}}}
+	skipping := false
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		keyword, value, ok := splitLine(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		switch strings.ToLower(keyword) {
+		case "host":
+			blocks = append(blocks, block{patterns: splitValues(value)})
+			skipping = false
+		case "match":
+			// Match criteria can't be evaluated statically, skip the section
+			skipping = true
+		case "include":
+			if skipping {
+				continue
+			}
+			for _, pattern := range splitValues(value) {
+				included, err := includeBlocks(pattern, depth)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", line, err)
+				}
+				// Included lines only apply where the Host block holding
+				// the Include does. Included Host blocks end the current
+				// section, options after the Include still belong to it
+				current := blocks[len(blocks)-1]
+				for _, b := range included {
+					scope := append(append([][]string(nil), current.scope...), current.patterns)
+					b.scope = append(scope, b.scope...)
+					blocks = append(blocks, b)
+				}
+				blocks = append(blocks, block{patterns: current.patterns, scope: current.scope})
+			}
+		default:
+			if skipping {
+				continue
+			}
+			last := &blocks[len(blocks)-1]
+			last.options = append(last.options, [2]string{keyword, unquote(value)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func includeBlocks(pattern string, depth int) ([]block, error) {
+	pattern = expandHome(pattern)
+	if !filepath.IsAbs(pattern) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		pattern = filepath.Join(home, ".ssh", pattern)
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []block
+	for _, path := range matches {
+		included, err := readBlocks(path, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, included...)
+	}
+	return blocks, nil
+}
+
+// resolve turns blocks into hosts. Like ssh, the first value seen for a
+// keyword wins, including values from earlier wildcard blocks.
+func resolve(blocks []block) []Host {
+	var aliases []string
+	seen := make(map[string]bool)
+	for _, b := range blocks {
+		for _, p := range b.patterns {
+			if strings.HasPrefix(p, "!") || strings.ContainsAny(p, "*?") || seen[p] || !b.matches(p) {
+				continue
+			}
+			seen[p] = true
+			aliases = append(aliases, p)
+		}
+	}
+
+	hosts := make([]Host, 0, len(aliases))
+	for _, alias := range aliases {
+		host := Host{Alias: alias}
+		set := make(map[string]bool)
+		for _, b := range blocks {
+			if !b.matches(alias) {
+				continue
+			}
+			for _, opt := range b.options {
+				key := strings.ToLower(opt[0])
+				if set[key] {
+					continue
+				}
+				if host.apply(opt[0], opt[1]) {
+					set[key] = true
+				}
+			}
+		}
+		if host.HostName == "" {
+			host.HostName = alias
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// apply sets the field keyword maps onto. Keywords without a field are
+// kept in Options, spelt as written.
+func (h *Host) apply(keyword, value string) bool {
+	switch strings.ToLower(keyword) {
+	case "hostname":
+		h.HostName = strings.ReplaceAll(value, "%h", h.Alias)
+	case "user":
+		h.User = value
+	case "identityfile":
+		h.IdentityFile = value
+	case "proxyjump":
+		if !strings.EqualFold(value, "none") {
+			h.ProxyJump = value
+		}
+	case "identityagent":
+		h.IdentityAgent = value
+	case "remotecommand":
+		h.RemoteCommand = value
+	case "setenv":
+		h.SetEnv = parseSetEnv(value)
+	case "port":
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return false
+		}
+		h.Port = port
+	default:
+		if h.Options == nil {
+			h.Options = make(map[string]string)
+		}
+		h.Options[keyword] = value
+	}
+	return true
+}
+
+// matchPatterns reports whether alias matches a Host pattern list. A
+// matching negated pattern excludes the alias regardless of the others.
+func matchPatterns(patterns []string, alias string) bool {
+	matched := false
+	for _, p := range patterns {
+		negate := strings.HasPrefix(p, "!")
+		if negate {
+			p = p[1:]
+		}
+		if ok, _ := filepath.Match(p, alias); ok {
+			if negate {
+				return false
+			}
+			matched = true
+		}
+	}
+	return matched
+}
+
+// parseSetEnv splits a SetEnv value into variables. Values may be double
+// quoted to contain spaces.
+func parseSetEnv(value string) map[string]string {
+	env := make(map[string]string)
+	for len(value) > 0 {
+		value = strings.TrimLeft(value, " \t")
+		i := strings.Index(value, "=")
+		if i <= 0 {
+			break
+		}
+		key := value[:i]
+		value = value[i+1:]
+
+		var v string
+		if strings.HasPrefix(value, `"`) {
+			end := 1
+			for end < len(value) && (value[end] != '"' || value[end-1] == '\\') {
+				end++
+			}
+			v = strings.ReplaceAll(value[1:end], `\"`, `"`)
+			value = value[min(end+1, len(value)):]
+		} else {
+			end := strings.IndexAny(value, " \t")
+			if end < 0 {
+				end = len(value)
+			}
+			v = value[:end]
+			value = value[end:]
+		}
+		env[key] = v
+	}
+	return env
+}
+
+func splitLine(text string) (string, string, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.HasPrefix(text, "#") {
+		return "", "", false
+	}
+
+	i := strings.IndexAny(text, " \t=")
+	if i < 0 {
+		return text, "", true
+	}
+	key := text[:i]
+	value := strings.TrimLeft(text[i:], " \t")
+	value = strings.TrimPrefix(value, "=")
+	return key, strings.TrimSpace(value), true
+}
+
+func splitValues(value string) []string {
+	var values []string
+	for _, v := range strings.Fields(value) {
+		values = append(values, unquote(v))
+	}
+	return values
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// Write renders hosts as OpenSSH Host blocks. comments maps an alias to a
+// comment line written above its block.
+func Write(w io.Writer, hosts []Host, comments map[string]string) error {
+	bw := bufio.NewWriter(w)
+	for i, h := range hosts {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		if comment := comments[h.Alias]; comment != "" {
+			fmt.Fprintf(bw, "# %s\n", strings.ReplaceAll(comment, "\n", " "))
+		}
+		fmt.Fprintf(bw, "Host %s\n", h.Alias)
+		fmt.Fprintf(bw, "    HostName %s\n", h.HostName)
+		if h.User != "" {
+			fmt.Fprintf(bw, "    User %s\n", h.User)
+		}
+		if h.Port != 0 {
+			fmt.Fprintf(bw, "    Port %d\n", h.Port)
+		}
+		if h.IdentityFile != "" {
+			fmt.Fprintf(bw, "    IdentityFile %s\n", quote(h.IdentityFile))
+			fmt.Fprintf(bw, "    IdentitiesOnly yes\n")
+		}
+		if h.ProxyJump != "" {
+			fmt.Fprintf(bw, "    ProxyJump %s\n", h.ProxyJump)
+		}
+		if h.ProxyCommand != "" {
+			fmt.Fprintf(bw, "    ProxyCommand %s\n", h.ProxyCommand)
+		}
+		if h.IdentityAgent != "" {
+			fmt.Fprintf(bw, "    IdentityAgent %s\n", quote(h.IdentityAgent))
+		}
+		if len(h.SetEnv) > 0 {
+			fmt.Fprintf(bw, "    SetEnv %s\n", formatSetEnv(h.SetEnv))
+		}
+		if h.RemoteCommand != "" {
+			fmt.Fprintf(bw, "    RequestTTY yes\n")
+			fmt.Fprintf(bw, "    RemoteCommand %s\n", h.RemoteCommand)
+		}
+		for _, key := range sortedKeys(h.Options) {
+			fmt.Fprintf(bw, "    %s %s\n", key, quote(h.Options[key]))
+		}
+	}
+	return bw.Flush()
+}
+
+func quote(value string) string {
+	if strings.ContainsAny(value, " \t") {
+		return `"` + value + `"`
+	}
+	return value
+}
+
+func formatSetEnv(env map[string]string) string {
+	pairs := make([]string, 0, len(env))
+	for _, key := range sortedKeys(env) {
+		value := env[key]
+		if strings.ContainsAny(value, " \t\"") {
+			value = `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+		}
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, " ")
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
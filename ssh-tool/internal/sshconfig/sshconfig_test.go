@@ -0,0 +1,164 @@
+package sshconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	const config = `# Global options apply to every host
+ServerAliveInterval 30
+
+Host prod-api prod-db
+    HostName %h.prod.internal
+    User deploy
+    Port=2222
+    IdentityFile "~/.ssh/prod key"
+    SetEnv APP_ENV=prod GREETING="hello world"
+
+Host prod-db
+    # The first value wins, so this is ignored
+    User postgres
+    ForwardAgent yes
+
+Host bastion
+    HostName 3.8.1.10
+    ProxyJump none
+    RemoteCommand tmux attach
+
+Match host prod-api
+    User root
+
+# bastion is excluded, so it gets neither the jump nor the user
+Host * !bastion
+    ProxyJump bastion
+    User ubuntu
+
+Host *.example.com
+    User nobody
+`
+	hosts, err := Parse(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Host{
+		{
+			Alias: "prod-api", HostName: "prod-api.prod.internal", User: "deploy", Port: 2222,
+			IdentityFile: "~/.ssh/prod key", ProxyJump: "bastion",
+			SetEnv:  map[string]string{"APP_ENV": "prod", "GREETING": "hello world"},
+			Options: map[string]string{"ServerAliveInterval": "30"},
+		},
+		{
+			Alias: "prod-db", HostName: "prod-db.prod.internal", User: "deploy", Port: 2222,
+			IdentityFile: "~/.ssh/prod key", ProxyJump: "bastion",
+			SetEnv:  map[string]string{"APP_ENV": "prod", "GREETING": "hello world"},
+			Options: map[string]string{"ServerAliveInterval": "30", "ForwardAgent": "yes"},
+		},
+		{
+			Alias: "bastion", HostName: "3.8.1.10", RemoteCommand: "tmux attach",
+			Options: map[string]string{"ServerAliveInterval": "30"},
+		},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("got  %+v\nwant %+v", hosts, want)
+	}
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	write("work.conf", `User deploy
+
+Host work-db
+    HostName 10.0.1.20
+`)
+	config := write("config", `Host work-*
+    Include `+filepath.Join(dir, "*.conf")+`
+    IdentityFile ~/.ssh/work
+
+Host home
+    HostName 192.168.1.2
+`)
+
+	hosts, err := ParseFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The included User only applies inside the Host work-* block, and the
+	// IdentityFile after the Include still belongs to it
+	want := []Host{
+		{Alias: "work-db", HostName: "10.0.1.20", User: "deploy", IdentityFile: "~/.ssh/work"},
+		{Alias: "home", HostName: "192.168.1.2"},
+	}
+	if !reflect.DeepEqual(hosts, want) {
+		t.Errorf("got  %+v\nwant %+v", hosts, want)
+	}
+}
+
+func TestParseFileIncludeLoop(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config")
+	if err := os.WriteFile(path, []byte("Include "+path+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseFile(path); err == nil || !strings.Contains(err.Error(), "too many nested Include directives") {
+		t.Errorf("error = %v, want too many nested Include directives", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	hosts := []Host{
+		{
+			Alias: "prod-api", HostName: "10.0.1.10", User: "deploy", Port: 2222,
+			IdentityFile: "~/.ssh/prod key", ProxyJump: "bastion",
+			SetEnv:        map[string]string{"APP_ENV": "prod", "GREETING": `say "hi"`},
+			RemoteCommand: "tmux attach",
+			Options:       map[string]string{"ServerAliveInterval": "30", "Compression": "yes"},
+		},
+		{Alias: "bastion", HostName: "3.8.1.10", ProxyCommand: "aws ssm start-session --target %h"},
+	}
+	var out strings.Builder
+	if err := Write(&out, hosts, map[string]string{"prod-api": "Payments API\nprimary"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# Payments API primary
+Host prod-api
+    HostName 10.0.1.10
+    User deploy
+    Port 2222
+    IdentityFile "~/.ssh/prod key"
+    IdentitiesOnly yes
+    ProxyJump bastion
+    SetEnv APP_ENV=prod GREETING="say \"hi\""
+    RequestTTY yes
+    RemoteCommand tmux attach
+    Compression yes
+    ServerAliveInterval 30
+
+Host bastion
+    HostName 3.8.1.10
+    ProxyCommand aws ssm start-session --target %h
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+
+	// What Write produces reads back the same
+	parsed, err := Parse(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parsed[0].SetEnv; !reflect.DeepEqual(got, hosts[0].SetEnv) {
+		t.Errorf("SetEnv read back as %q, want %q", got, hosts[0].SetEnv)
+	}
+}
@@ -0,0 +1,198 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"ssh-tool/internal/config"
+	"syscall"
+	"time"
+)
+
+// maxRecent caps how many servers the recent list remembers.
+const maxRecent = 50
+
+// Visit is the last connection to a server.
+type Visit struct {
+	Server string    `json:"server"`
+	Time   time.Time `json:"time"`
+	Count  int       `json:"count"`
+}
+
+// State is per-user data that changes as the tool is used, kept apart
+// from the server configuration.
+type State struct {
+	Recent    []Visit  `json:"recent"`
+	Favorites []string `json:"favorites"`
+
+	path string
+}
+
+// DefaultPath returns the state file location in the state directory.
+func DefaultPath() (string, error) {
+	dir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// Load reads the state file, returning empty state if it doesn't exist.
+func Load() (*State, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return load(path)
+}
+
+func load(path string) (*State, error) {
+	s := &State{path: path}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("%s: error parsing state: %v", path, err)
+	}
+	return s, nil
+}
+
+// Update loads the state, lets change modify it and saves it, holding a
+// lock throughout so that concurrent runs, such as two connects finishing
+// at once, don't drop each other's changes.
+func Update(change func(*State) error) error {
+	path, err := DefaultPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+
+	lock, err := os.OpenFile(path+".lock", os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("error locking state: %v", err)
+	}
+	// Closing the file releases the lock
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("error locking state: %v", err)
+	}
+
+	s, err := load(path)
+	if err != nil {
+		return err
+	}
+	if err := change(s); err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+// Save writes the state file atomically. Use Update to change the state,
+// Save alone would overwrite changes made since it was loaded.
+func (s *State) Save() error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("error creating state directory: %v", err)
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".state-*.json")
+	if err != nil {
+		return fmt.Errorf("error writing state: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing state: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state: %v", err)
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// RecordVisit moves server to the front of the recent list.
+func (s *State) RecordVisit(server string, at time.Time) {
+	visit := Visit{Server: server, Time: at, Count: 1}
+	recent := []Visit{visit}
+	for _, v := range s.Recent {
+		if v.Server == server {
+			recent[0].Count = v.Count + 1
+			continue
+		}
+		recent = append(recent, v)
+	}
+	if len(recent) > maxRecent {
+		recent = recent[:maxRecent]
+	}
+	s.Recent = recent
+}
+
+// Last returns the most recently used server.
+func (s *State) Last() (string, bool) {
+	if len(s.Recent) == 0 {
+		return "", false
+	}
+	return s.Recent[0].Server, true
+}
+
+// LastVisit returns when server was last connected to.
+func (s *State) LastVisit(server string) (Visit, bool) {
+	for _, v := range s.Recent {
+		if v.Server == server {
+			return v, true
+		}
+	}
+	return Visit{}, false
+}
+
+func (s *State) IsFavorite(server string) bool {
+	for _, f := range s.Favorites {
+		if f == server {
+			return true
+		}
+	}
+	return false
+}
+
+// AddFavorite pins server and reports whether it wasn't pinned already.
+func (s *State) AddFavorite(server string) bool {
+	if s.IsFavorite(server) {
+		return false
+	}
+	s.Favorites = append(s.Favorites, server)
+	sort.Strings(s.Favorites)
+	return true
+}
+
+// RemoveFavorite unpins server and reports whether it was pinned.
+func (s *State) RemoveFavorite(server string) bool {
+	for i, f := range s.Favorites {
+		if f == server {
+			s.Favorites = append(s.Favorites[:i], s.Favorites[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SortFavoritesFirst reorders servers so pinned ones come first, keeping
+// the existing order within both halves.
+func (s *State) SortFavoritesFirst(servers []config.Server) {
+	sort.SliceStable(servers, func(i, j int) bool {
+		return s.IsFavorite(servers[i].Name) && !s.IsFavorite(servers[j].Name)
+	})
+}
@@ -0,0 +1,113 @@
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"ssh-tool/internal/config"
+)
+
+func recentNames(s *State) []string {
+	var names []string
+	for _, v := range s.Recent {
+		names = append(names, v.Server)
+	}
+	return names
+}
+
+func TestRecordVisit(t *testing.T) {
+	s := &State{}
+	if _, ok := s.Last(); ok {
+		t.Error("Last reported a server before any visit")
+	}
+
+	start := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	for i, name := range []string{"prod-api", "prod-db", "prod-api", "staging"} {
+		s.RecordVisit(name, start.Add(time.Duration(i)*time.Minute))
+	}
+	if want := []string{"staging", "prod-api", "prod-db"}; !reflect.DeepEqual(recentNames(s), want) {
+		t.Errorf("recent %q, want %q", recentNames(s), want)
+	}
+	if last, _ := s.Last(); last != "staging" {
+		t.Errorf("Last = %s, want staging", last)
+	}
+	visit, ok := s.LastVisit("prod-api")
+	if want := (Visit{Server: "prod-api", Time: start.Add(2 * time.Minute), Count: 2}); !ok || visit != want {
+		t.Errorf("LastVisit = %+v, want %+v", visit, want)
+	}
+
+	for i := 0; i < maxRecent+10; i++ {
+		s.RecordVisit(fmt.Sprintf("web-%d", i), start)
+	}
+	if len(s.Recent) != maxRecent || s.Recent[0].Server != fmt.Sprintf("web-%d", maxRecent+9) {
+		t.Errorf("recent holds %d visits starting with %s, want the newest %d", len(s.Recent), s.Recent[0].Server, maxRecent)
+	}
+}
+
+func TestFavorites(t *testing.T) {
+	s := &State{}
+	if !s.AddFavorite("prod-db") || !s.AddFavorite("prod-api") || s.AddFavorite("prod-db") {
+		t.Error("AddFavorite reported the wrong result")
+	}
+	if want := []string{"prod-api", "prod-db"}; !reflect.DeepEqual(s.Favorites, want) {
+		t.Errorf("favourites %q, want %q", s.Favorites, want)
+	}
+	if !s.RemoveFavorite("prod-api") || s.RemoveFavorite("prod-api") {
+		t.Error("RemoveFavorite reported the wrong result")
+	}
+
+	servers := []config.Server{{Name: "api"}, {Name: "cache"}, {Name: "prod-db"}, {Name: "web"}}
+	s.AddFavorite("web")
+	s.SortFavoritesFirst(servers)
+	var names []string
+	for _, server := range servers {
+		names = append(names, server.Name)
+	}
+	if want := []string{"prod-db", "web", "api", "cache"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("sorted %q, want %q", names, want)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+
+	// Every concurrent update must survive, none may overwrite another
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			err := Update(func(s *State) error {
+				s.RecordVisit(fmt.Sprintf("web-%d", i), time.Now())
+				return nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Recent) != 20 {
+		t.Errorf("%d visits saved, want 20: %q", len(s.Recent), recentNames(s))
+	}
+
+	// A failing change saves nothing
+	err = Update(func(s *State) error {
+		s.AddFavorite("web-1")
+		return fmt.Errorf("no such server")
+	})
+	if err == nil {
+		t.Error("Update swallowed the error")
+	}
+	if s, _ := Load(); len(s.Favorites) != 0 {
+		t.Errorf("favourites %q saved after a failed change", s.Favorites)
+	}
+}
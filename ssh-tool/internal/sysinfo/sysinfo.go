@@ -0,0 +1,261 @@
+// Package sysinfo gathers a snapshot of a server's state, OS, uptime, load,
+// memory, disks and busiest processes, with one ssh command and standard
+// tools, so nothing has to be installed on the server.
+package sysinfo
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"ssh-tool/internal/config"
+	"ssh-tool/internal/panes"
+	"ssh-tool/internal/ssh"
+)
+
+// script prints one "key value" line per fact, with sizes in KiB. It reads
+// /proc where there is one and falls back to sysctl and BSD ps elsewhere;
+// what can't be read is left out. %d is the number of processes to list.
+const script = `LC_ALL=C; export LC_ALL
+if [ -r /etc/os-release ]; then
+	echo "os $(. /etc/os-release && echo "${PRETTY_NAME:-$NAME}")"
+elif command -v sw_vers >/dev/null 2>&1; then
+	echo "os $(sw_vers -productName) $(sw_vers -productVersion)"
+else
+	echo "os $(uname -s)"
+fi
+echo "kernel $(uname -sr)"
+echo "arch $(uname -m)"
+echo "cpus $(getconf _NPROCESSORS_ONLN 2>/dev/null || nproc 2>/dev/null)"
+if [ -r /proc/uptime ]; then
+	echo "uptime $(cut -d' ' -f1 /proc/uptime)"
+	echo "load $(cut -d' ' -f1-3 /proc/loadavg)"
+	awk '/^MemTotal:/ { t = $2 } /^MemAvailable:/ { a = $2 } END { print "mem", t, a }' /proc/meminfo
+else
+	boot=$(sysctl -n kern.boottime 2>/dev/null | sed 's/.*sec = \([0-9]*\).*/\1/')
+	[ -n "$boot" ] && echo "uptime $(( $(date +%%s) - boot ))"
+	echo "load $(sysctl -n vm.loadavg 2>/dev/null | tr -d '{}')"
+fi
+df -P -k 2>/dev/null | awk 'NR > 1 && $1 ~ /^\// && !seen[$1]++ { m = $0; for (i = 0; i < 5; i++) sub(/^ *[^ ]+ +/, "", m); print "disk", $2, $3, m }'
+{ ps -eo pid=,pcpu=,pmem=,comm= --sort=-pcpu 2>/dev/null || ps -Ao pid=,pcpu=,pmem=,comm= -r; } | head -n %d | sed 's/^ */proc /'`
+
+// Info is the snapshot of one server. Sizes are in bytes.
+type Info struct {
+	Server        config.Server `json:"-"`
+	OS            string        `json:"os,omitempty"`
+	Kernel        string        `json:"kernel,omitempty"`
+	Arch          string        `json:"arch,omitempty"`
+	CPUs          int           `json:"cpus,omitempty"`
+	Uptime        time.Duration `json:"-"`
+	UptimeSeconds int64         `json:"uptime_seconds,omitempty"`
+	Load          []float64     `json:"load,omitempty"`
+	MemTotal      uint64        `json:"mem_total,omitempty"`
+	MemAvailable  uint64        `json:"mem_available,omitempty"`
+	Disks         []Disk        `json:"disks,omitempty"`
+	Processes     []Process     `json:"processes,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// Disk is a mounted local filesystem.
+type Disk struct {
+	Mount string `json:"mount"`
+	Size  uint64 `json:"size"`
+	Used  uint64 `json:"used"`
+}
+
+// Process is one of the processes using the most CPU.
+type Process struct {
+	PID     int     `json:"pid"`
+	CPU     float64 `json:"cpu_percent"`
+	Mem     float64 `json:"mem_percent"`
+	Command string  `json:"command"`
+}
+
+// MemUsed returns the share of memory in use, from 0 to 1.
+func (i Info) MemUsed() (float64, bool) {
+	if i.MemTotal == 0 || i.MemAvailable > i.MemTotal {
+		return 0, false
+	}
+	return float64(i.MemTotal-i.MemAvailable) / float64(i.MemTotal), true
+}
+
+// FullestDisk returns the disk with the largest share in use.
+func (i Info) FullestDisk() (Disk, bool) {
+	var fullest Disk
+	for _, d := range i.Disks {
+		if fullest.Size == 0 || d.UsedShare() > fullest.UsedShare() {
+			fullest = d
+		}
+	}
+	return fullest, fullest.Size > 0
+}
+
+// UsedShare returns the share of the disk in use, from 0 to 1.
+func (d Disk) UsedShare() float64 {
+	if d.Size == 0 {
+		return 0
+	}
+	return float64(d.Used) / float64(d.Size)
+}
+
+// Options control a gathering run.
+type Options struct {
+	// Timeout bounds connecting and running the script on each server.
+	Timeout time.Duration
+	// Concurrency limits the number of servers queried at once.
+	Concurrency int
+	// Processes is how many of the busiest processes to list.
+	Processes int
+}
+
+// Gather queries all servers concurrently and returns the snapshots in the
+// same order as servers.
+func Gather(ctx context.Context, servers []config.Server, opts Options) []Info {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 16
+	}
+
+	infos := make([]Info, len(servers))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server config.Server) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			infos[i] = GatherServer(ctx, server, opts)
+		}(i, server)
+	}
+	wg.Wait()
+	return infos
+}
+
+// GatherServer runs the script on the server through ssh in batch mode, so
+// no password or passphrase prompt can block it, with the same keys,
+// certificates and transport as a connection.
+func GatherServer(ctx context.Context, server config.Server, opts Options) Info {
+	info := Info{Server: server}
+	if opts.Processes <= 0 {
+		opts.Processes = 5
+	}
+
+	client := ssh.NewClient(server)
+	client.Batch = true
+	cleanup, err := client.Prepare(ctx)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	defer cleanup()
+
+	args, err := client.Options()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	seconds := int(opts.Timeout.Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	args = append(args,
+		"-o", "BatchMode=yes",
+		"-o", "ConnectTimeout="+strconv.Itoa(seconds),
+		// sh, whatever the login shell is
+		client.Destination(), panes.ShellJoin([]string{"sh", "-c", fmt.Sprintf(script, opts.Processes)}))
+
+	ctx, cancel := context.WithTimeout(ctx, 2*opts.Timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	// Don't wait for children of a killed ssh, such as a ProxyCommand
+	cmd.WaitDelay = time.Second
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	switch {
+	case ctx.Err() != nil:
+		info.Error = "timed out"
+		return info
+	case err != nil && len(out) == 0:
+		info.Error = ssh.LastLine(stderr.String(), err)
+		return info
+	}
+	parse(&info, string(out))
+	return info
+}
+
+// parse fills info from the script's output; lines it doesn't understand
+// are skipped.
+func parse(info *Info, out string) {
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), " ")
+		value = strings.TrimSpace(value)
+		fields := strings.Fields(value)
+		if value == "" {
+			continue
+		}
+
+		switch key {
+		case "os":
+			info.OS = value
+		case "kernel":
+			info.Kernel = value
+		case "arch":
+			info.Arch = value
+		case "cpus":
+			info.CPUs, _ = strconv.Atoi(value)
+		case "uptime":
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+				info.Uptime = time.Duration(seconds) * time.Second
+				info.UptimeSeconds = int64(seconds)
+			}
+		case "load":
+			info.Load = nil
+			for _, f := range fields {
+				if load, err := strconv.ParseFloat(f, 64); err == nil {
+					info.Load = append(info.Load, load)
+				}
+			}
+		case "mem":
+			if len(fields) == 2 {
+				info.MemTotal = parseKiB(fields[0])
+				info.MemAvailable = parseKiB(fields[1])
+			}
+		case "disk":
+			// The mount point is the rest of the line, spaces and all
+			if parts := strings.SplitN(value, " ", 3); len(parts) == 3 {
+				info.Disks = append(info.Disks, Disk{
+					Size:  parseKiB(parts[0]),
+					Used:  parseKiB(parts[1]),
+					Mount: parts[2],
+				})
+			}
+		case "proc":
+			if len(fields) >= 4 {
+				var p Process
+				p.PID, _ = strconv.Atoi(fields[0])
+				p.CPU, _ = strconv.ParseFloat(fields[1], 64)
+				p.Mem, _ = strconv.ParseFloat(fields[2], 64)
+				p.Command = strings.Join(fields[3:], " ")
+				info.Processes = append(info.Processes, p)
+			}
+		}
+	}
+}
+
+// parseKiB returns the size in bytes of a count of KiB.
+func parseKiB(s string) uint64 {
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n * 1024
+}
@@ -0,0 +1,186 @@
+package sysinfo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"ssh-tool/internal/config"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want Info
+	}{
+		{
+			name: "linux",
+			out: `os Ubuntu 22.04.4 LTS
+kernel Linux 5.15.0-105-generic
+arch x86_64
+cpus 4
+uptime 93784.52
+load 0.52 0.48 0.40
+mem 8046312 5123456
+disk 50620216 20123456 /
+disk 1048576 524288 /mnt/backup drive
+proc 1234 87.5 12.1 postgres
+proc    1  0.1  0.2 systemd --user
+`,
+			want: Info{
+				OS: "Ubuntu 22.04.4 LTS", Kernel: "Linux 5.15.0-105-generic", Arch: "x86_64", CPUs: 4,
+				Uptime: 93784 * time.Second, UptimeSeconds: 93784,
+				Load:     []float64{0.52, 0.48, 0.40},
+				MemTotal: 8046312 * 1024, MemAvailable: 5123456 * 1024,
+				Disks: []Disk{
+					{Mount: "/", Size: 50620216 * 1024, Used: 20123456 * 1024},
+					{Mount: "/mnt/backup drive", Size: 1048576 * 1024, Used: 524288 * 1024},
+				},
+				Processes: []Process{
+					{PID: 1234, CPU: 87.5, Mem: 12.1, Command: "postgres"},
+					{PID: 1, CPU: 0.1, Mem: 0.2, Command: "systemd --user"},
+				},
+			},
+		},
+		{
+			name: "macos",
+			out: `os macOS 14.4
+kernel Darwin 23.4.0
+arch arm64
+cpus 10
+uptime 3600
+load  1.94 2.10 2.05
+disk 482797652 10511360 /
+`,
+			want: Info{
+				OS: "macOS 14.4", Kernel: "Darwin 23.4.0", Arch: "arm64", CPUs: 10,
+				Uptime: time.Hour, UptimeSeconds: 3600,
+				Load:  []float64{1.94, 2.10, 2.05},
+				Disks: []Disk{{Mount: "/", Size: 482797652 * 1024, Used: 10511360 * 1024}},
+			},
+		},
+		{
+			name: "missing and malformed",
+			out: `os
+cpus
+uptime soon
+mem 8046312
+disk 1024 512
+proc 1 0.1 0.2
+motd Welcome to the bastion
+`,
+			want: Info{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Info
+			parse(&got, tt.out)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemUsedAndFullestDisk(t *testing.T) {
+	info := Info{
+		MemTotal: 1000, MemAvailable: 250,
+		Disks: []Disk{
+			{Mount: "/", Size: 100, Used: 50},
+			{Mount: "/var", Size: 100, Used: 90},
+			{Mount: "/boot", Size: 10, Used: 1},
+		},
+	}
+	if used, ok := info.MemUsed(); !ok || used != 0.75 {
+		t.Errorf("MemUsed = %v, %v, want 0.75", used, ok)
+	}
+	if disk, ok := info.FullestDisk(); !ok || disk.Mount != "/var" {
+		t.Errorf("FullestDisk = %+v, %v, want /var", disk, ok)
+	}
+
+	if _, ok := (Info{MemTotal: 100, MemAvailable: 200}).MemUsed(); ok {
+		t.Error("MemUsed with more available than total reported a share")
+	}
+	if _, ok := (Info{}).FullestDisk(); ok {
+		t.Error("FullestDisk without disks reported one")
+	}
+}
+
+func fakeCommand(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+// fakeDF lists a root disk, the same device mounted again, a mount point
+// with spaces and a filesystem that isn't a local device.
+const fakeDF = `cat <<'EOF'
+Filesystem     1024-blocks     Used Available Capacity Mounted on
+/dev/sda1         50620216 20123456  30496760      40% /
+/dev/sda1         50620216 20123456  30496760      40% /var/lib/docker
+/dev/sdb1          1048576   524288    524288      50% /mnt/backup  drive
+tmpfs              1024000        0   1024000       0% /run
+EOF`
+
+func TestScriptDisks(t *testing.T) {
+	fakeCommand(t, "df", fakeDF)
+	out, err := exec.Command("sh", "-c", fmt.Sprintf(script, 3)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info Info
+	parse(&info, string(out))
+	want := []Disk{
+		{Mount: "/", Size: 50620216 * 1024, Used: 20123456 * 1024},
+		{Mount: "/mnt/backup  drive", Size: 1048576 * 1024, Used: 524288 * 1024},
+	}
+	if !reflect.DeepEqual(info.Disks, want) {
+		t.Errorf("disks = %+v\nwant %+v", info.Disks, want)
+	}
+	if info.Kernel == "" || info.CPUs == 0 {
+		t.Errorf("script output %q lacks the kernel or cpus", out)
+	}
+}
+
+func TestGatherServer(t *testing.T) {
+	server := config.Server{Name: "api", Hostname: "10.0.1.10", User: "deploy"}
+	opts := Options{Timeout: 5 * time.Second, Processes: 2}
+
+	// Run the remote command, the last argument, locally instead
+	fakeCommand(t, "ssh", `for arg; do remote=$arg; done
+test "$remote" != "$1" || exit 2
+eval "$remote"`)
+	fakeCommand(t, "df", fakeDF)
+	info := GatherServer(context.Background(), server, opts)
+	if info.Error != "" {
+		t.Fatalf("GatherServer error = %s", info.Error)
+	}
+	if info.Server.Name != "api" || info.Kernel == "" || len(info.Disks) != 2 {
+		t.Errorf("GatherServer = %+v, want the local kernel and two disks", info)
+	}
+
+	fakeCommand(t, "ssh", `echo "Warning: Permanently added '10.0.1.10' to the list of known hosts." >&2
+echo "deploy@10.0.1.10: Permission denied (publickey)." >&2
+exit 255`)
+	info = GatherServer(context.Background(), server, opts)
+	if want := "deploy@10.0.1.10: Permission denied (publickey)."; info.Error != want {
+		t.Errorf("GatherServer error = %q, want %q", info.Error, want)
+	}
+
+	fakeCommand(t, "ssh", "exit 255")
+	if info = GatherServer(context.Background(), server, opts); info.Error != "exit status 255" {
+		t.Errorf("GatherServer error = %q, want the exit status when ssh prints nothing", info.Error)
+	}
+}